@@ -1,17 +1,34 @@
 package main
 
 import (
+	"context"
 	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"hmdp-Go/src/cache"
 	"hmdp-Go/src/config"
 	"hmdp-Go/src/handler"
 	"hmdp-Go/src/service"
+	"hmdp-Go/src/utils"
 )
 
 func main() {
 	r := gin.Default()
+	if err := r.SetTrustedProxies(utils.TRUSTED_PROXIES); err != nil {
+		logrus.Fatalf("set trusted proxies failed: %v", err)
+	}
 	config.Init()
+	cache.StartInvalidationListener(context.Background())
 	handler.ConfigRouter(r)
+	service.InitIdGenerator()
+	service.InitRoleLoader()
+	service.InitSensitiveFilter()
 	service.InitOrderHandler()
+	service.InitShopHotKeyDetector()
+	service.InitCommentHotKeyDetector()
+	service.InitShopCacheStrategy()
+	service.InitBloomFilters()
+	service.InitOutboxRelay()
+	service.InitFeedFanout()
 
 	r.Run(":8081")
 
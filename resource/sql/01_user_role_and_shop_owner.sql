@@ -0,0 +1,15 @@
+-- 用户角色和商家与店铺的归属关系
+ALTER TABLE `tb_user`
+    ADD COLUMN `role` varchar(16) NOT NULL DEFAULT 'user' COMMENT '角色: user 普通用户, merchant 商家, admin 管理员' AFTER `icon`;
+
+CREATE TABLE IF NOT EXISTS `tb_shop_owner`
+(
+    `id`          bigint(20) unsigned NOT NULL AUTO_INCREMENT COMMENT '主键',
+    `shop_id`     bigint(20) unsigned NOT NULL COMMENT '店铺id',
+    `user_id`     bigint(20) unsigned NOT NULL COMMENT '商家的用户id',
+    `create_time` timestamp           NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
+    PRIMARY KEY (`id`),
+    UNIQUE KEY `uk_user_shop` (`user_id`, `shop_id`),
+    KEY `idx_shop_id` (`shop_id`)
+) ENGINE = InnoDB
+  DEFAULT CHARSET = utf8mb4 COMMENT ='商家与店铺的归属关系';
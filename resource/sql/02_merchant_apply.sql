@@ -0,0 +1,18 @@
+-- 商家入驻申请
+CREATE TABLE IF NOT EXISTS `tb_merchant_apply`
+(
+    `id`          bigint(20) unsigned NOT NULL AUTO_INCREMENT COMMENT '主键',
+    `user_id`     bigint(20) unsigned NOT NULL COMMENT '申请人的用户id',
+    `name`        varchar(128)        NOT NULL COMMENT '商家名称',
+    `contact`     varchar(128)        NOT NULL DEFAULT '' COMMENT '联系方式',
+    `description` varchar(1024)       NOT NULL DEFAULT '' COMMENT '商家介绍',
+    `status`      tinyint(1)          NOT NULL DEFAULT 0 COMMENT '0 待审核, 1 审核通过, 2 审核拒绝',
+    `reviewer_id` bigint(20) unsigned NOT NULL DEFAULT 0 COMMENT '审核的管理员id',
+    `remark`      varchar(255)        NOT NULL DEFAULT '' COMMENT '审核意见',
+    `create_time` timestamp           NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
+    `update_time` timestamp           NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP COMMENT '更新时间',
+    PRIMARY KEY (`id`),
+    KEY `idx_user_id` (`user_id`),
+    KEY `idx_status` (`status`, `id`)
+) ENGINE = InnoDB
+  DEFAULT CHARSET = utf8mb4 COMMENT ='商家入驻申请';
@@ -0,0 +1,17 @@
+-- 事务发件箱
+CREATE TABLE IF NOT EXISTS `tb_outbox`
+(
+    `id`              bigint(20) unsigned NOT NULL AUTO_INCREMENT COMMENT '主键',
+    `event_type`      varchar(32)         NOT NULL COMMENT '事件类型',
+    `payload`         text                NOT NULL COMMENT '事件内容(json)',
+    `status`          tinyint(1)          NOT NULL DEFAULT 0 COMMENT '0 等待投递, 1 投递成功, 2 超过最大重试次数',
+    `attempts`        int(8)              NOT NULL DEFAULT 0 COMMENT '已经失败的次数',
+    `next_retry_time` timestamp           NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '下一次投递的时间',
+    `last_error`      varchar(1024)       NOT NULL DEFAULT '' COMMENT '最近一次失败的原因',
+    `create_time`     timestamp           NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
+    `update_time`     timestamp           NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP COMMENT '更新时间',
+    PRIMARY KEY (`id`),
+    KEY `idx_status_retry` (`status`, `next_retry_time`),
+    KEY `idx_status_update` (`status`, `update_time`)
+) ENGINE = InnoDB
+  DEFAULT CHARSET = utf8mb4 COMMENT ='事务发件箱';
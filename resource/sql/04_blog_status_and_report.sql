@@ -0,0 +1,23 @@
+-- 博客状态和内容举报
+ALTER TABLE `tb_blog`
+    ADD COLUMN `status` tinyint(1) NOT NULL DEFAULT 0 COMMENT '0 正常, 1 被多人举报等待审核, 2 被禁止, 3 被作者删除' AFTER `comments`,
+    ADD KEY `idx_status_liked` (`status`, `liked`);
+
+CREATE TABLE IF NOT EXISTS `tb_report`
+(
+    `id`          bigint(20) unsigned NOT NULL AUTO_INCREMENT COMMENT '主键',
+    `user_id`     bigint(20) unsigned NOT NULL COMMENT '举报人',
+    `target_type` tinyint(1)          NOT NULL COMMENT '1 博客, 2 评论',
+    `target_id`   bigint(20) unsigned NOT NULL COMMENT '被举报的博客或评论的id',
+    `reason`      varchar(255)        NOT NULL DEFAULT '' COMMENT '举报理由',
+    `status`      tinyint(1)          NOT NULL DEFAULT 0 COMMENT '0 待处理, 1 举报成立, 2 举报不成立',
+    `reviewer_id` bigint(20) unsigned NOT NULL DEFAULT 0 COMMENT '处理的管理员',
+    `pending`     tinyint(1) GENERATED ALWAYS AS (IF(`status` = 0, 1, NULL)) VIRTUAL COMMENT '待处理时为 1，否则为 NULL，用于限制同一用户对同一内容只有一个待处理的举报',
+    `create_time` timestamp           NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
+    `update_time` timestamp           NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP COMMENT '更新时间',
+    PRIMARY KEY (`id`),
+    KEY `idx_target_status` (`target_type`, `target_id`, `status`),
+    UNIQUE KEY `uk_user_target_pending` (`user_id`, `target_type`, `target_id`, `pending`),
+    KEY `idx_status_id` (`status`, `id`)
+) ENGINE = InnoDB
+  DEFAULT CHARSET = utf8mb4 COMMENT ='内容举报';
@@ -0,0 +1,34 @@
+-- 滑动窗口限流
+-- KEYS[1]: 限流的key
+-- ARGV[1]: 窗口大小(毫秒)
+-- ARGV[2]: 窗口内允许的最大请求数
+-- ARGV[3]: 本次请求的唯一标识
+-- 返回 0 表示放行，否则返回还需要等待的毫秒数
+local key = KEYS[1]
+local window = tonumber(ARGV[1])
+local limit = tonumber(ARGV[2])
+
+-- 使用Redis服务器的时间，保证所有实例看到的时间一致
+local time = redis.call("time")
+local now = tonumber(time[1]) * 1000 + math.floor(tonumber(time[2]) / 1000)
+
+-- 1. 移除窗口之外的请求记录
+redis.call("zremrangebyscore", key, 0, now - window)
+
+-- 2. 窗口内的请求数没有达到上限，记录本次请求
+if redis.call("zcard", key) < limit then
+	redis.call("zadd", key, now, ARGV[3])
+	redis.call("pexpire", key, window)
+	return 0
+end
+
+-- 3. 达到上限，计算最早的请求滑出窗口还需要多久
+local oldest = redis.call("zrange", key, 0, 0, "withscores")
+local retryAfter = window
+if #oldest > 0 then
+	retryAfter = tonumber(oldest[2]) + window - now
+end
+if retryAfter <= 0 then
+	retryAfter = 1
+end
+return retryAfter
@@ -0,0 +1,9 @@
+// Package script 编译时嵌入Redis Lua脚本，部署时不依赖工作目录下的脚本文件
+package script
+
+import _ "embed"
+
+// RateLimit 滑动窗口限流脚本
+//
+//go:embed rate_limit.lua
+var RateLimit string
@@ -0,0 +1,365 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+	redisClient "hmdp-Go/src/config/redis"
+	"hmdp-Go/src/utils"
+)
+
+// ErrNotFound 数据在数据库中不存在，Loader 查询不到数据时也应返回该错误
+var ErrNotFound = errors.New("cache: record not found")
+
+// Strategy 缓存策略
+type Strategy int
+
+const (
+	StrategyCacheAside    Strategy = iota // 旁路缓存：未命中时查询数据库并回填
+	StrategyNullValue                     // 缓存空对象：解决缓存穿透
+	StrategyMutex                         // 互斥锁重建：解决缓存击穿，同时缓存空对象
+	StrategyLogicalExpire                 // 逻辑过期：解决缓存击穿，过期后返回旧数据并异步重建
+)
+
+// Loader 缓存未命中时从数据库加载数据
+type Loader[K comparable, V any] func(ctx context.Context, key K) (V, error)
+
+// Client 通用的缓存客户端，K 为业务主键，V 为缓存的数据
+// 开启本地缓存后为两级缓存：进程内LRU(L1) + Redis(L2)
+type Client[K comparable, V any] struct {
+	prefix   string
+	loader   Loader[K, V]
+	opts     options
+	local    *localCache[V]
+	counters counters
+}
+
+// New 创建缓存客户端，prefix 为Redis key的前缀，loader 用于缓存未命中时加载数据
+func New[K comparable, V any](prefix string, loader Loader[K, V], opts ...Option) *Client[K, V] {
+	o := defaultOptions()
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.lockPrefix == "" {
+		o.lockPrefix = "lock:" + prefix
+	}
+	c := &Client[K, V]{
+		prefix: prefix,
+		loader: loader,
+		opts:   o,
+	}
+	if o.localSize > 0 {
+		c.local = newLocalCache[V](o.localSize, o.localTTL)
+	}
+	register(c)
+	return c
+}
+
+// Key 返回业务主键对应的Redis key
+func (c *Client[K, V]) Key(key K) string {
+	return c.prefix + fmt.Sprint(key)
+}
+
+// Get 按照客户端的缓存策略查询数据，数据不存在时返回 ErrNotFound
+func (c *Client[K, V]) Get(ctx context.Context, key K) (V, error) {
+	if c.opts.guard != nil && !c.opts.guard(fmt.Sprint(key)) {
+		c.counters.rejected.Add(1)
+		var v V
+		return v, ErrNotFound
+	}
+	if c.local == nil {
+		return c.getRemote(ctx, key)
+	}
+
+	redisKey := c.Key(key)
+	if v, isNull, ok := c.local.get(redisKey); ok {
+		c.counters.l1Hits.Add(1)
+		if isNull {
+			return v, ErrNotFound
+		}
+		return v, nil
+	}
+	c.counters.l1Misses.Add(1)
+
+	v, err := c.getRemote(ctx, key)
+	if err == nil {
+		c.local.set(redisKey, v, false)
+	} else if errors.Is(err, ErrNotFound) {
+		c.local.set(redisKey, v, true)
+	}
+	return v, err
+}
+
+func (c *Client[K, V]) getRemote(ctx context.Context, key K) (V, error) {
+	switch c.opts.strategy {
+	case StrategyLogicalExpire:
+		return c.getWithLogicalExpire(ctx, key)
+	case StrategyMutex:
+		return c.getWithMutex(ctx, key)
+	default:
+		return c.getWithPassThrough(ctx, key)
+	}
+}
+
+// Set 主动写入缓存，并通知所有实例删除旧的本地缓存
+func (c *Client[K, V]) Set(ctx context.Context, key K, value V) error {
+	if err := c.store(ctx, key, value); err != nil {
+		return err
+	}
+	evictLocal(c.Key(key))
+	return publishInvalidation(ctx, c.redis(), c.Key(key))
+}
+
+// store 写入Redis，逻辑过期策略下会同时写入逻辑过期时间
+func (c *Client[K, V]) store(ctx context.Context, key K, value V) error {
+	if c.opts.strategy == StrategyLogicalExpire {
+		return c.setLogical(ctx, key, value)
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return c.redis().Set(ctx, c.Key(key), string(data), c.ttl()).Err()
+}
+
+// Warm 从数据库加载数据并写入缓存，用于逻辑过期的数据预热；被过滤器拒绝的key返回 ErrNotFound
+func (c *Client[K, V]) Warm(ctx context.Context, key K) error {
+	if c.opts.guard != nil && !c.opts.guard(fmt.Sprint(key)) {
+		return ErrNotFound
+	}
+	unlock, err := c.lockLoad(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	value, err := c.loader(ctx, key)
+	if err != nil {
+		return err
+	}
+	return c.Set(ctx, key, value)
+}
+
+// lockLoad 获取加载数据的锁，没有设置时返回空操作
+func (c *Client[K, V]) lockLoad(ctx context.Context, key K) (func(), error) {
+	if c.opts.loadLock == nil {
+		return func() {}, nil
+	}
+	return c.opts.loadLock(ctx, fmt.Sprint(key))
+}
+
+// Delete 删除缓存，所有实例的本地缓存都会被删除
+func (c *Client[K, V]) Delete(ctx context.Context, keys ...K) error {
+	redisKeys := make([]string, len(keys))
+	for i, key := range keys {
+		redisKeys[i] = c.Key(key)
+	}
+	return invalidate(ctx, c.redis(), redisKeys...)
+}
+
+// Stats 返回两级缓存的命中统计
+func (c *Client[K, V]) Stats() Stats {
+	stats := Stats{
+		Name:     c.prefix,
+		Strategy: c.opts.strategy.String(),
+		L1Hits:   c.counters.l1Hits.Load(),
+		L1Misses: c.counters.l1Misses.Load(),
+		L2Hits:   c.counters.l2Hits.Load(),
+		L2Misses: c.counters.l2Misses.Load(),
+		Rejected: c.counters.rejected.Load(),
+	}
+	stats.L1HitRatio = hitRatio(stats.L1Hits, stats.L1Misses)
+	stats.L2HitRatio = hitRatio(stats.L2Hits, stats.L2Misses)
+	if c.local != nil {
+		stats.L1Size = c.local.len()
+	}
+	return stats
+}
+
+func (c *Client[K, V]) evictLocal(redisKey string) {
+	if c.local != nil && strings.HasPrefix(redisKey, c.prefix) {
+		c.local.evict(redisKey)
+	}
+}
+
+// lookup 查询Redis，found 表示Redis中存在该key，value为空字符串表示缓存的空对象
+func (c *Client[K, V]) lookup(ctx context.Context, key K) (value string, found bool, err error) {
+	value, err = c.redis().Get(ctx, c.Key(key)).Result()
+	if errors.Is(err, redis.Nil) {
+		c.counters.l2Misses.Add(1)
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	c.counters.l2Hits.Add(1)
+	return value, true, nil
+}
+
+func (c *Client[K, V]) decode(value string) (V, error) {
+	var v V
+	if value == "" {
+		return v, ErrNotFound
+	}
+	err := json.Unmarshal([]byte(value), &v)
+	return v, err
+}
+
+// getWithPassThrough 旁路缓存和缓存空对象
+func (c *Client[K, V]) getWithPassThrough(ctx context.Context, key K) (V, error) {
+	value, found, err := c.lookup(ctx, key)
+	if err != nil {
+		// Redis不可用时直接查询数据库
+		logrus.Warnf("cache get %s failed: %v", c.Key(key), err)
+		return c.loader(ctx, key)
+	}
+	if found {
+		return c.decode(value)
+	}
+	return c.loadAndCache(ctx, key)
+}
+
+// loadAndCache 查询数据库并回填缓存，数据不存在时按策略决定是否缓存空对象
+func (c *Client[K, V]) loadAndCache(ctx context.Context, key K) (V, error) {
+	unlock, err := c.lockLoad(ctx, key)
+	if err != nil {
+		var v V
+		return v, err
+	}
+	defer unlock()
+	v, err := c.loader(ctx, key)
+	if errors.Is(err, ErrNotFound) {
+		if c.opts.strategy != StrategyCacheAside {
+			if setErr := c.redis().Set(ctx, c.Key(key), "", c.opts.nullTTL).Err(); setErr != nil {
+				logrus.Warnf("cache set null %s failed: %v", c.Key(key), setErr)
+			}
+		}
+		return v, err
+	}
+	if err != nil {
+		return v, err
+	}
+	if err = c.store(ctx, key, v); err != nil {
+		logrus.Warnf("cache set %s failed: %v", c.Key(key), err)
+	}
+	return v, nil
+}
+
+// getWithMutex 利用互斥锁解决缓存击穿：只有拿到锁的请求才会查询数据库重建缓存
+// 其余请求等待解锁通知后重新查询缓存，等待超时后直接查询数据库
+func (c *Client[K, V]) getWithMutex(ctx context.Context, key K) (V, error) {
+	lockKey := c.opts.lockPrefix + fmt.Sprint(key)
+	lock := utils.NewDistributedLock(c.redis())
+	waitCtx, cancel := context.WithTimeout(ctx, c.opts.lockWait)
+	defer cancel()
+
+	for {
+		value, found, err := c.lookup(ctx, key)
+		if err != nil {
+			logrus.Warnf("cache get %s failed: %v", c.Key(key), err)
+			return c.loader(ctx, key)
+		}
+		if found {
+			return c.decode(value)
+		}
+
+		acquired, token, err := lock.LockWithWatchDog(ctx, lockKey, c.opts.lockTTL)
+		if err != nil {
+			var v V
+			return v, err
+		}
+		if acquired {
+			defer lock.UnlockWithWatchDog(context.Background(), lockKey, token)
+			// 拿到锁之后再检查一次，缓存可能已经被其他请求重建
+			value, found, err = c.lookup(ctx, key)
+			if err == nil && found {
+				return c.decode(value)
+			}
+			return c.loadAndCache(ctx, key)
+		}
+
+		err = lock.WaitUnlock(waitCtx, lockKey)
+		if errors.Is(err, utils.ErrLockTimeout) && ctx.Err() == nil {
+			return c.loader(ctx, key)
+		}
+		if err != nil {
+			var v V
+			return v, err
+		}
+	}
+}
+
+// getWithLogicalExpire 逻辑过期：缓存不设置TTL，过期后由拿到锁的请求异步重建，其余请求返回旧数据
+func (c *Client[K, V]) getWithLogicalExpire(ctx context.Context, key K) (V, error) {
+	value, found, err := c.lookup(ctx, key)
+	if err != nil {
+		logrus.Warnf("cache get %s failed: %v", c.Key(key), err)
+		return c.loader(ctx, key)
+	}
+	// 没有预热的数据同步加载一次
+	if !found {
+		return c.loadAndCache(ctx, key)
+	}
+	if value == "" {
+		var v V
+		return v, ErrNotFound
+	}
+
+	var redisData utils.RedisData[V]
+	if err = json.Unmarshal([]byte(value), &redisData); err != nil {
+		var v V
+		return v, err
+	}
+	if redisData.ExpireTime.After(time.Now()) {
+		return redisData.Data, nil
+	}
+
+	// 已经过期，获取锁后异步重建缓存
+	lockKey := c.opts.lockPrefix + fmt.Sprint(key)
+	lock := utils.NewDistributedLock(c.redis())
+	acquired, token, err := lock.LockWithWatchDog(context.Background(), lockKey, c.opts.lockTTL)
+	if err != nil || !acquired {
+		return redisData.Data, nil
+	}
+	go func() {
+		rebuildCtx := context.Background()
+		defer lock.UnlockWithWatchDog(rebuildCtx, lockKey, token)
+		if _, err := c.loadAndCache(rebuildCtx, key); err != nil && !errors.Is(err, ErrNotFound) {
+			logrus.Warnf("cache rebuild %s failed: %v", c.Key(key), err)
+		}
+	}()
+	return redisData.Data, nil
+}
+
+func (c *Client[K, V]) setLogical(ctx context.Context, key K, value V) error {
+	redisData := utils.RedisData[V]{
+		ExpireTime: time.Now().Add(c.ttl()),
+		Data:       value,
+	}
+	data, err := json.Marshal(redisData)
+	if err != nil {
+		return err
+	}
+	return c.redis().Set(ctx, c.Key(key), string(data), 0).Err()
+}
+
+// ttl 在基础过期时间上增加随机抖动，避免大量key同时过期造成缓存雪崩
+func (c *Client[K, V]) ttl() time.Duration {
+	if c.opts.jitter <= 0 {
+		return c.opts.ttl
+	}
+	return c.opts.ttl + time.Duration(rand.Int63n(int64(c.opts.jitter)))
+}
+
+func (c *Client[K, V]) redis() *redis.Client {
+	if c.opts.client != nil {
+		return c.opts.client
+	}
+	return redisClient.GetRedisClient()
+}
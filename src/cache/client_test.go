@@ -0,0 +1,197 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+type testShop struct {
+	Id   int64  `json:"id"`
+	Name string `json:"name"`
+}
+
+func newTestRedis(t *testing.T) (*miniredis.Miniredis, *redis.Client) {
+	mr := miniredis.RunT(t)
+	return mr, redis.NewClient(&redis.Options{Addr: mr.Addr()})
+}
+
+// newCountingLoader 模拟数据库，只有 id <= 100 的记录存在
+func newCountingLoader(loads *int64, delay time.Duration) Loader[int64, testShop] {
+	return func(_ context.Context, id int64) (testShop, error) {
+		atomic.AddInt64(loads, 1)
+		time.Sleep(delay)
+		if id > 100 {
+			return testShop{}, ErrNotFound
+		}
+		return testShop{Id: id, Name: "shop"}, nil
+	}
+}
+
+func TestCacheAside(t *testing.T) {
+	mr, rdb := newTestRedis(t)
+	var loads int64
+	c := New[int64, testShop]("cache:shop:", newCountingLoader(&loads, 0),
+		WithRedis(rdb), WithStrategy(StrategyCacheAside), WithTTL(time.Minute, 10*time.Second))
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		shop, err := c.Get(ctx, 1)
+		if err != nil || shop.Id != 1 {
+			t.Fatalf("expected shop 1, but get %v %v", shop, err)
+		}
+	}
+	if loads != 1 {
+		t.Fatalf("expected 1 load, but get %d", loads)
+	}
+	ttl := mr.TTL("cache:shop:1")
+	if ttl < time.Minute || ttl >= time.Minute+10*time.Second {
+		t.Fatalf("unexpected ttl %v", ttl)
+	}
+
+	// 旁路缓存不缓存空对象
+	for i := 0; i < 2; i++ {
+		if _, err := c.Get(ctx, 101); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("expected ErrNotFound, but get %v", err)
+		}
+	}
+	if loads != 3 {
+		t.Fatalf("expected 3 loads, but get %d", loads)
+	}
+}
+
+func TestCacheNullValue(t *testing.T) {
+	mr, rdb := newTestRedis(t)
+	var loads int64
+	c := New[int64, testShop]("cache:shop:", newCountingLoader(&loads, 0),
+		WithRedis(rdb), WithNullTTL(30*time.Second))
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		if _, err := c.Get(ctx, 101); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("expected ErrNotFound, but get %v", err)
+		}
+	}
+	if loads != 1 {
+		t.Fatalf("expected 1 load, but get %d", loads)
+	}
+	if ttl := mr.TTL("cache:shop:101"); ttl != 30*time.Second {
+		t.Fatalf("unexpected null ttl %v", ttl)
+	}
+
+	if err := c.Delete(ctx, 101); err != nil {
+		t.Fatal(err)
+	}
+	if mr.Exists("cache:shop:101") {
+		t.Fatal("expected key to be deleted")
+	}
+}
+
+func TestCacheMutexStampede(t *testing.T) {
+	_, rdb := newTestRedis(t)
+	var loads int64
+	c := New[int64, testShop]("cache:shop:", newCountingLoader(&loads, 50*time.Millisecond),
+		WithRedis(rdb), WithStrategy(StrategyMutex), WithLockWait(time.Second))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			shop, err := c.Get(context.Background(), 7)
+			if err != nil || shop.Id != 7 {
+				t.Errorf("expected shop 7, but get %v %v", shop, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if loads != 1 {
+		t.Fatalf("expected 1 load under stampede, but get %d", loads)
+	}
+}
+
+func TestCacheLogicalExpire(t *testing.T) {
+	mr, rdb := newTestRedis(t)
+	var loads int64
+	c := New[int64, testShop]("cache:shop:logic:", newCountingLoader(&loads, 0),
+		WithRedis(rdb), WithStrategy(StrategyLogicalExpire), WithTTL(50*time.Millisecond, 0))
+	ctx := context.Background()
+
+	if err := c.Warm(ctx, 3); err != nil {
+		t.Fatal(err)
+	}
+	if ttl := mr.TTL("cache:shop:logic:3"); ttl != 0 {
+		t.Fatalf("logical expire key should not have ttl, but get %v", ttl)
+	}
+
+	time.Sleep(80 * time.Millisecond)
+	// 过期后仍然返回旧数据，并在后台重建
+	shop, err := c.Get(ctx, 3)
+	if err != nil || shop.Id != 3 {
+		t.Fatalf("expected stale shop 3, but get %v %v", shop, err)
+	}
+	deadline := time.Now().Add(time.Second)
+	for atomic.LoadInt64(&loads) < 2 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if atomic.LoadInt64(&loads) != 2 {
+		t.Fatalf("expected async rebuild, loads=%d", loads)
+	}
+}
+
+func TestCacheGuard(t *testing.T) {
+	mr, rdb := newTestRedis(t)
+	var loads int64
+	c := New[int64, testShop]("cache:shop:", newCountingLoader(&loads, 0),
+		WithRedis(rdb), WithGuard(func(key string) bool { return key != "404" }))
+	ctx := context.Background()
+
+	if _, err := c.Get(ctx, 404); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, but get %v", err)
+	}
+	if loads != 0 || mr.Exists("cache:shop:404") {
+		t.Fatal("guard should reject the key before touching redis and loader")
+	}
+	if _, err := c.Get(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	if stats := c.Stats(); stats.Rejected != 1 {
+		t.Fatalf("expected 1 rejected request, but get %d", stats.Rejected)
+	}
+}
+
+func TestCacheLoadLock(t *testing.T) {
+	mr, rdb := newTestRedis(t)
+	var loads int64
+	var locked []string
+	cachedOnUnlock := false
+	c := New[int64, testShop]("cache:shop:", newCountingLoader(&loads, 0),
+		WithRedis(rdb), WithLoadLock(func(_ context.Context, key string) (func(), error) {
+			locked = append(locked, key)
+			return func() { cachedOnUnlock = mr.Exists("cache:shop:" + key) }, nil
+		}))
+
+	if _, err := c.Get(context.Background(), 1); err != nil {
+		t.Fatal(err)
+	}
+	// 写入缓存之后才释放锁
+	if len(locked) != 1 || locked[0] != "1" || !cachedOnUnlock {
+		t.Fatalf("lock should be held until the cache is written, locked=%v cached=%v", locked, cachedOnUnlock)
+	}
+
+	lockErr := errors.New("lock timeout")
+	failing := New[int64, testShop]("cache:shop:fail:", newCountingLoader(&loads, 0),
+		WithRedis(rdb), WithLoadLock(func(context.Context, string) (func(), error) { return nil, lockErr }))
+	if _, err := failing.Get(context.Background(), 2); !errors.Is(err, lockErr) {
+		t.Fatalf("expected lock error, but get %v", err)
+	}
+	if loads != 1 {
+		t.Fatalf("loader should not run without the lock, loads=%d", loads)
+	}
+}
@@ -0,0 +1,190 @@
+package cache
+
+import (
+	"context"
+	"encoding/binary"
+	"hash/fnv"
+	"sort"
+	"sync"
+	"time"
+)
+
+// HotKey 当前的热点key
+type HotKey struct {
+	Key   string    `json:"key"`
+	Count uint64    `json:"count"` // 滑动窗口内的访问次数(估计值)
+	Since time.Time `json:"since"` // 成为热点的时间
+}
+
+// HotKeyConfig 热点探测的配置
+// 滑动窗口由 Buckets 个时间片组成，每个时间片使用一个 Count-Min Sketch 计数
+// 窗口内访问次数达到 HotThreshold 时成为热点，低于 CoolThreshold 时降级
+type HotKeyConfig struct {
+	Window        time.Duration
+	Buckets       int
+	HotThreshold  uint64
+	CoolThreshold uint64
+}
+
+// HotKeyDetector 基于滑动窗口 Count-Min Sketch 的热点key探测器
+type HotKeyDetector struct {
+	config   HotKeyConfig
+	mutex    sync.Mutex
+	sketches []*countMinSketch
+	current  int
+	hot      map[string]time.Time
+	onHot    func(key string)
+	onCool   func(key string)
+}
+
+// NewHotKeyDetector 创建热点探测器，onHot/onCool 在key升级为热点和降级时异步调用
+func NewHotKeyDetector(config HotKeyConfig, onHot func(key string), onCool func(key string)) *HotKeyDetector {
+	if config.Buckets <= 0 {
+		config.Buckets = 6
+	}
+	sketches := make([]*countMinSketch, config.Buckets)
+	for i := range sketches {
+		sketches[i] = newCountMinSketch(4, 2048)
+	}
+	return &HotKeyDetector{
+		config:   config,
+		sketches: sketches,
+		hot:      make(map[string]time.Time),
+		onHot:    onHot,
+		onCool:   onCool,
+	}
+}
+
+// Start 启动时间片轮转，直到 ctx 被取消
+func (d *HotKeyDetector) Start(ctx context.Context) {
+	ticker := time.NewTicker(d.config.Window / time.Duration(d.config.Buckets))
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				d.Rotate()
+			}
+		}
+	}()
+}
+
+// Record 记录一次访问，返回该key当前是否为热点
+func (d *HotKeyDetector) Record(key string) bool {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.sketches[d.current].add(key)
+	if _, ok := d.hot[key]; ok {
+		return true
+	}
+	if d.estimate(key) < d.config.HotThreshold {
+		return false
+	}
+
+	d.hot[key] = time.Now()
+	if d.onHot != nil {
+		go d.onHot(key)
+	}
+	return true
+}
+
+// IsHot 判断key当前是否为热点
+func (d *HotKeyDetector) IsHot(key string) bool {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	_, ok := d.hot[key]
+	return ok
+}
+
+// Rotate 丢弃最旧的时间片，并把访问量下降的热点key降级
+func (d *HotKeyDetector) Rotate() {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.current = (d.current + 1) % len(d.sketches)
+	d.sketches[d.current].reset()
+
+	for key := range d.hot {
+		if d.estimate(key) >= d.config.CoolThreshold {
+			continue
+		}
+		delete(d.hot, key)
+		if d.onCool != nil {
+			go d.onCool(key)
+		}
+	}
+}
+
+// HotKeys 返回当前所有热点key，按访问次数从高到低排序
+func (d *HotKeyDetector) HotKeys() []HotKey {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	keys := make([]HotKey, 0, len(d.hot))
+	for key, since := range d.hot {
+		keys = append(keys, HotKey{Key: key, Count: d.estimate(key), Since: since})
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].Count > keys[j].Count
+	})
+	return keys
+}
+
+// estimate 整个滑动窗口内的访问次数，调用方需要持有锁
+func (d *HotKeyDetector) estimate(key string) uint64 {
+	var total uint64
+	for _, sketch := range d.sketches {
+		total += sketch.estimate(key)
+	}
+	return total
+}
+
+// countMinSketch 用固定的内存估计每个key的出现次数，估计值只会偏大不会偏小
+type countMinSketch struct {
+	depth    int
+	width    uint64
+	counters [][]uint32
+}
+
+func newCountMinSketch(depth int, width uint64) *countMinSketch {
+	counters := make([][]uint32, depth)
+	for i := range counters {
+		counters[i] = make([]uint32, width)
+	}
+	return &countMinSketch{depth: depth, width: width, counters: counters}
+}
+
+func (s *countMinSketch) add(key string) {
+	for i := 0; i < s.depth; i++ {
+		s.counters[i][s.index(key, i)]++
+	}
+}
+
+func (s *countMinSketch) estimate(key string) uint64 {
+	min := uint32(0)
+	for i := 0; i < s.depth; i++ {
+		v := s.counters[i][s.index(key, i)]
+		if i == 0 || v < min {
+			min = v
+		}
+	}
+	return uint64(min)
+}
+
+func (s *countMinSketch) reset() {
+	for i := range s.counters {
+		clear(s.counters[i])
+	}
+}
+
+func (s *countMinSketch) index(key string, row int) uint64 {
+	hasher := fnv.New64a()
+	seed := make([]byte, 4)
+	binary.BigEndian.PutUint32(seed, uint32(row))
+	hasher.Write(seed)
+	hasher.Write([]byte(key))
+	return hasher.Sum64() % s.width
+}
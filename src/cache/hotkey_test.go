@@ -0,0 +1,56 @@
+package cache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHotKeyDetector(t *testing.T) {
+	hotCh := make(chan string, 10)
+	coolCh := make(chan string, 10)
+	d := NewHotKeyDetector(HotKeyConfig{
+		Window:        time.Minute,
+		Buckets:       3,
+		HotThreshold:  100,
+		CoolThreshold: 10,
+	}, func(key string) { hotCh <- key }, func(key string) { coolCh <- key })
+
+	for i := 0; i < 99; i++ {
+		if d.Record("shop:1") {
+			t.Fatalf("shop:1 should not be hot after %d accesses", i+1)
+		}
+		d.Record("shop:2")
+	}
+	if !d.Record("shop:1") {
+		t.Fatal("shop:1 should be hot after 100 accesses")
+	}
+	select {
+	case key := <-hotCh:
+		if key != "shop:1" {
+			t.Fatalf("unexpected hot key %s", key)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected onHot to be called")
+	}
+
+	hotKeys := d.HotKeys()
+	if len(hotKeys) != 1 || hotKeys[0].Key != "shop:1" || hotKeys[0].Count < 100 {
+		t.Fatalf("unexpected hot keys %+v", hotKeys)
+	}
+
+	// 整个窗口滑过之后访问量归零，热点被降级
+	for i := 0; i < 3; i++ {
+		d.Rotate()
+	}
+	select {
+	case key := <-coolCh:
+		if key != "shop:1" {
+			t.Fatalf("unexpected cool key %s", key)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected onCool to be called")
+	}
+	if d.IsHot("shop:1") {
+		t.Fatal("shop:1 should not be hot any more")
+	}
+}
@@ -0,0 +1,87 @@
+package cache
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+	redisClient "hmdp-Go/src/config/redis"
+	"hmdp-Go/src/utils"
+)
+
+// registered 所有创建过的缓存客户端，用于跨实例失效本地缓存和统计命中率
+type registered interface {
+	evictLocal(redisKey string)
+	Stats() Stats
+}
+
+var (
+	registryMutex sync.RWMutex
+	registry      []registered
+)
+
+func register(c registered) {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+	registry = append(registry, c)
+}
+
+// evictLocal 删除所有客户端中该Redis key对应的本地缓存
+func evictLocal(redisKey string) {
+	registryMutex.RLock()
+	defer registryMutex.RUnlock()
+	for _, c := range registry {
+		c.evictLocal(redisKey)
+	}
+}
+
+// Invalidate 删除Redis中的缓存，并通过Pub/Sub通知所有实例删除本地缓存
+func Invalidate(ctx context.Context, keys ...string) error {
+	return invalidate(ctx, redisClient.GetRedisClient(), keys...)
+}
+
+func invalidate(ctx context.Context, rdb *redis.Client, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	for _, key := range keys {
+		evictLocal(key)
+	}
+	if err := rdb.Del(ctx, keys...).Err(); err != nil {
+		return err
+	}
+	return publishInvalidation(ctx, rdb, keys...)
+}
+
+func publishInvalidation(ctx context.Context, rdb *redis.Client, keys ...string) error {
+	return rdb.Publish(ctx, utils.CACHE_INVALIDATE_CHANNEL, strings.Join(keys, "\n")).Err()
+}
+
+// StartInvalidationListener 订阅缓存失效消息，收到消息后删除本实例的本地缓存
+func StartInvalidationListener(ctx context.Context) {
+	go ListenInvalidation(ctx, redisClient.GetRedisClient())
+}
+
+// ListenInvalidation 阻塞地处理缓存失效消息，直到 ctx 被取消
+func ListenInvalidation(ctx context.Context, rdb *redis.Client) {
+	pubsub := rdb.Subscribe(ctx, utils.CACHE_INVALIDATE_CHANNEL)
+	defer pubsub.Close()
+
+	ch := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-ch:
+			if !ok {
+				logrus.Warn("cache invalidation channel closed")
+				return
+			}
+			for _, key := range strings.Split(msg.Payload, "\n") {
+				evictLocal(key)
+			}
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package cache
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// localCache 进程内的LRU缓存，条目过期或超出容量后被淘汰
+type localCache[V any] struct {
+	size  int
+	ttl   time.Duration
+	mutex sync.Mutex
+	ll    *list.List
+	items map[string]*list.Element
+}
+
+type localEntry[V any] struct {
+	key        string
+	value      V
+	notFound   bool // 缓存的空对象
+	expireTime time.Time
+}
+
+func newLocalCache[V any](size int, ttl time.Duration) *localCache[V] {
+	return &localCache[V]{
+		size:  size,
+		ttl:   ttl,
+		ll:    list.New(),
+		items: make(map[string]*list.Element),
+	}
+}
+
+// get 返回缓存的值，notFound 为 true 表示缓存的是空对象
+func (lc *localCache[V]) get(key string) (value V, notFound bool, ok bool) {
+	lc.mutex.Lock()
+	defer lc.mutex.Unlock()
+
+	elem, exists := lc.items[key]
+	if !exists {
+		return value, false, false
+	}
+	entry := elem.Value.(*localEntry[V])
+	if time.Now().After(entry.expireTime) {
+		lc.removeElement(elem)
+		return value, false, false
+	}
+	lc.ll.MoveToFront(elem)
+	return entry.value, entry.notFound, true
+}
+
+func (lc *localCache[V]) set(key string, value V, notFound bool) {
+	lc.mutex.Lock()
+	defer lc.mutex.Unlock()
+
+	expireTime := time.Now().Add(lc.ttl)
+	if elem, exists := lc.items[key]; exists {
+		entry := elem.Value.(*localEntry[V])
+		entry.value = value
+		entry.notFound = notFound
+		entry.expireTime = expireTime
+		lc.ll.MoveToFront(elem)
+		return
+	}
+
+	elem := lc.ll.PushFront(&localEntry[V]{key: key, value: value, notFound: notFound, expireTime: expireTime})
+	lc.items[key] = elem
+	for lc.ll.Len() > lc.size {
+		lc.removeElement(lc.ll.Back())
+	}
+}
+
+func (lc *localCache[V]) evict(key string) {
+	lc.mutex.Lock()
+	defer lc.mutex.Unlock()
+
+	if elem, exists := lc.items[key]; exists {
+		lc.removeElement(elem)
+	}
+}
+
+func (lc *localCache[V]) len() int {
+	lc.mutex.Lock()
+	defer lc.mutex.Unlock()
+	return lc.ll.Len()
+}
+
+func (lc *localCache[V]) removeElement(elem *list.Element) {
+	lc.ll.Remove(elem)
+	delete(lc.items, elem.Value.(*localEntry[V]).key)
+}
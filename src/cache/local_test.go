@@ -0,0 +1,77 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"hmdp-Go/src/utils"
+)
+
+func TestLocalCacheLRU(t *testing.T) {
+	lc := newLocalCache[int](2, time.Minute)
+	lc.set("a", 1, false)
+	lc.set("b", 2, false)
+	// 访问a之后b成为最久未使用的条目
+	if v, _, ok := lc.get("a"); !ok || v != 1 {
+		t.Fatalf("expected a=1, but get %v %v", v, ok)
+	}
+	lc.set("c", 3, false)
+
+	if _, _, ok := lc.get("b"); ok {
+		t.Fatal("expected b to be evicted")
+	}
+	if lc.len() != 2 {
+		t.Fatalf("expected size 2, but get %d", lc.len())
+	}
+}
+
+func TestLocalCacheExpire(t *testing.T) {
+	lc := newLocalCache[int](10, 20*time.Millisecond)
+	lc.set("a", 1, false)
+	time.Sleep(30 * time.Millisecond)
+	if _, _, ok := lc.get("a"); ok {
+		t.Fatal("expected a to be expired")
+	}
+}
+
+func TestTwoLevelCacheInvalidation(t *testing.T) {
+	_, rdb := newTestRedis(t)
+	var loads int64
+	c := New[int64, testShop]("cache:two-level:", newCountingLoader(&loads, 0),
+		WithRedis(rdb), WithLocalCache(100, time.Minute))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go ListenInvalidation(ctx, rdb)
+	time.Sleep(20 * time.Millisecond)
+
+	for i := 0; i < 5; i++ {
+		if _, err := c.Get(ctx, 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stats := c.Stats()
+	if stats.L1Hits != 4 || stats.L1Misses != 1 || stats.L2Misses != 1 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+
+	// 模拟其他实例更新了数据并发布失效消息
+	if err := rdb.Publish(ctx, utils.CACHE_INVALIDATE_CHANNEL, c.Key(1)).Err(); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(time.Second)
+	for c.Stats().L1Size != 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if size := c.Stats().L1Size; size != 0 {
+		t.Fatalf("expected local cache to be evicted, size=%d", size)
+	}
+
+	if _, err := c.Get(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	if stats = c.Stats(); stats.L2Hits != 1 {
+		t.Fatalf("expected to read from redis after eviction, stats %+v", stats)
+	}
+}
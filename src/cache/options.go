@@ -0,0 +1,105 @@
+package cache
+
+import (
+	"context"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+type options struct {
+	strategy   Strategy
+	ttl        time.Duration
+	jitter     time.Duration
+	nullTTL    time.Duration
+	lockPrefix string
+	lockTTL    time.Duration
+	lockWait   time.Duration
+	localSize  int
+	localTTL   time.Duration
+	guard      func(key string) bool
+	loadLock   func(ctx context.Context, key string) (func(), error)
+	client     *redis.Client
+}
+
+func defaultOptions() options {
+	return options{
+		strategy: StrategyNullValue,
+		ttl:      30 * time.Minute,
+		nullTTL:  2 * time.Minute,
+		lockTTL:  10 * time.Second,
+		lockWait: time.Second,
+	}
+}
+
+// Option 缓存客户端的配置项
+type Option func(*options)
+
+// WithStrategy 设置缓存策略，默认为缓存空对象
+func WithStrategy(strategy Strategy) Option {
+	return func(o *options) {
+		o.strategy = strategy
+	}
+}
+
+// WithTTL 设置缓存的过期时间，实际过期时间为 ttl + [0, jitter) 之间的随机值
+// 逻辑过期策略下 ttl 为逻辑过期时间
+func WithTTL(ttl time.Duration, jitter time.Duration) Option {
+	return func(o *options) {
+		o.ttl = ttl
+		o.jitter = jitter
+	}
+}
+
+// WithNullTTL 设置空对象的过期时间
+func WithNullTTL(ttl time.Duration) Option {
+	return func(o *options) {
+		o.nullTTL = ttl
+	}
+}
+
+// WithLock 设置重建缓存时使用的锁前缀和锁的过期时间
+func WithLock(prefix string, ttl time.Duration) Option {
+	return func(o *options) {
+		o.lockPrefix = prefix
+		o.lockTTL = ttl
+	}
+}
+
+// WithLockWait 设置互斥锁策略下等待锁的最长时间，超时后直接查询数据库
+func WithLockWait(wait time.Duration) Option {
+	return func(o *options) {
+		o.lockWait = wait
+	}
+}
+
+// WithLocalCache 开启进程内的本地缓存，size 为最多缓存的条目数，ttl 为本地缓存的过期时间
+// 数据更新时通过Pub/Sub通知所有实例删除本地缓存，ttl 作为消息丢失时的兜底
+func WithLocalCache(size int, ttl time.Duration) Option {
+	return func(o *options) {
+		o.localSize = size
+		o.localTTL = ttl
+	}
+}
+
+// WithGuard 设置前置过滤器(如布隆过滤器)，guard 返回 false 表示数据一定不存在，直接返回 ErrNotFound
+func WithGuard(guard func(key string) bool) Option {
+	return func(o *options) {
+		o.guard = guard
+	}
+}
+
+// WithLoadLock 设置加载数据时使用的锁(如读写锁的读锁)，从查询数据库到写入缓存的整个过程都持有该锁，
+// 返回的函数用于释放锁；修改数据的一方持有对应的写锁直到删除缓存，就不会有旧数据在删除之后被写回缓存
+func WithLoadLock(lock func(ctx context.Context, key string) (unlock func(), err error)) Option {
+	return func(o *options) {
+		o.loadLock = lock
+	}
+}
+
+// WithRedis 指定Redis客户端，默认使用全局的Redis客户端
+func WithRedis(client *redis.Client) Option {
+	return func(o *options) {
+		o.client = client
+	}
+}
@@ -0,0 +1,59 @@
+package cache
+
+import "sync/atomic"
+
+// Stats 缓存客户端的命中统计，L1 为进程内缓存，L2 为Redis
+type Stats struct {
+	Name       string  `json:"name"`
+	Strategy   string  `json:"strategy"`
+	L1Size     int     `json:"l1Size"`
+	L1Hits     uint64  `json:"l1Hits"`
+	L1Misses   uint64  `json:"l1Misses"`
+	L1HitRatio float64 `json:"l1HitRatio"`
+	L2Hits     uint64  `json:"l2Hits"`
+	L2Misses   uint64  `json:"l2Misses"`
+	L2HitRatio float64 `json:"l2HitRatio"`
+	Rejected   uint64  `json:"rejected"` // 被前置过滤器拦截的请求数
+}
+
+type counters struct {
+	l1Hits   atomic.Uint64
+	l1Misses atomic.Uint64
+	l2Hits   atomic.Uint64
+	l2Misses atomic.Uint64
+	rejected atomic.Uint64
+}
+
+// AllStats 返回所有缓存客户端的命中统计
+func AllStats() []Stats {
+	registryMutex.RLock()
+	defer registryMutex.RUnlock()
+
+	stats := make([]Stats, 0, len(registry))
+	for _, c := range registry {
+		stats = append(stats, c.Stats())
+	}
+	return stats
+}
+
+func hitRatio(hits, misses uint64) float64 {
+	if hits+misses == 0 {
+		return 0
+	}
+	return float64(hits) / float64(hits+misses)
+}
+
+func (s Strategy) String() string {
+	switch s {
+	case StrategyCacheAside:
+		return "cache-aside"
+	case StrategyNullValue:
+		return "null-cache"
+	case StrategyMutex:
+		return "mutex"
+	case StrategyLogicalExpire:
+		return "logical-expire"
+	default:
+		return "unknown"
+	}
+}
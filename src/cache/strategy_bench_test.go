@@ -0,0 +1,125 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"hmdp-Go/src/utils"
+)
+
+// 缓存策略的压测：模拟数据库查询耗时，统计每种策略下的延迟和数据库查询次数
+// go test ./src/cache -run '^$' -bench Strategy -benchtime 2000x
+
+const benchDBDelay = 2 * time.Millisecond
+
+type benchStrategy struct {
+	name string
+	// newGet 创建一次查询的函数，loads 统计数据库查询次数
+	newGet func(b *testing.B, rdb *redis.Client, loads *int64) func(ctx context.Context, id int64) (testShop, error)
+}
+
+var benchStrategies = []benchStrategy{
+	{"none", func(_ *testing.B, _ *redis.Client, loads *int64) func(context.Context, int64) (testShop, error) {
+		return newCountingLoader(loads, benchDBDelay)
+	}},
+	{"cache-aside", benchClient(WithStrategy(StrategyCacheAside))},
+	{"null-cache", benchClient(WithStrategy(StrategyNullValue))},
+	{"mutex", benchClient(WithStrategy(StrategyMutex), WithLockWait(time.Second))},
+	{"logical-expire", benchClient(WithStrategy(StrategyLogicalExpire))},
+	{"bloom-null", func(b *testing.B, rdb *redis.Client, loads *int64) func(context.Context, int64) (testShop, error) {
+		bloom := utils.NewBloomFilter(1000, 0.001)
+		for id := 1; id <= 100; id++ {
+			bloom.Add([]byte(strconv.Itoa(id)))
+		}
+		guard := func(key string) bool { return bloom.Contains([]byte(key)) }
+		return benchClient(WithStrategy(StrategyNullValue), WithGuard(guard))(b, rdb, loads)
+	}},
+}
+
+func benchClient(opts ...Option) func(*testing.B, *redis.Client, *int64) func(context.Context, int64) (testShop, error) {
+	return func(_ *testing.B, rdb *redis.Client, loads *int64) func(context.Context, int64) (testShop, error) {
+		clientOpts := append(append([]Option{}, opts...), WithRedis(rdb), WithTTL(20*time.Millisecond, 0), WithNullTTL(20*time.Millisecond))
+		return New[int64, testShop]("bench:shop:", newCountingLoader(loads, benchDBDelay), clientOpts...).Get
+	}
+}
+
+// BenchmarkStrategyStampede 热点key过期瞬间大量并发请求同时到达
+func BenchmarkStrategyStampede(b *testing.B) {
+	for _, s := range benchStrategies {
+		b.Run(s.name, func(b *testing.B) {
+			mr, rdb := newBenchRedis(b)
+			var loads int64
+			get := s.newGet(b, rdb, &loads)
+			ctx := context.Background()
+			if _, err := get(ctx, 1); err != nil {
+				b.Fatal(err)
+			}
+			atomic.StoreInt64(&loads, 0)
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				// 缓存过期后 50 个请求同时查询同一个店铺
+				b.StopTimer()
+				time.Sleep(25 * time.Millisecond)
+				mr.FastForward(time.Second)
+				b.StartTimer()
+
+				var wg sync.WaitGroup
+				for j := 0; j < 50; j++ {
+					wg.Add(1)
+					go func() {
+						defer wg.Done()
+						if _, err := get(ctx, 1); err != nil {
+							b.Error(err)
+						}
+					}()
+				}
+				wg.Wait()
+			}
+			b.StopTimer()
+			// 等待逻辑过期的异步重建结束，避免在Redis关闭后写入
+			time.Sleep(10 * benchDBDelay)
+			b.ReportMetric(float64(atomic.LoadInt64(&loads))/float64(b.N), "db-loads/op")
+		})
+	}
+}
+
+// BenchmarkStrategyMixed 90% 的请求访问存在的热点店铺，10% 的请求访问不存在的店铺(缓存穿透)
+func BenchmarkStrategyMixed(b *testing.B) {
+	for _, s := range benchStrategies {
+		b.Run(s.name, func(b *testing.B) {
+			_, rdb := newBenchRedis(b)
+			var loads int64
+			get := s.newGet(b, rdb, &loads)
+			ctx := context.Background()
+
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				r := rand.New(rand.NewSource(time.Now().UnixNano()))
+				for pb.Next() {
+					id := int64(r.Intn(10) + 1)
+					if r.Intn(10) == 0 {
+						id = int64(r.Intn(1_000_000) + 1000)
+					}
+					if _, err := get(ctx, id); err != nil && !errors.Is(err, ErrNotFound) {
+						b.Error(err)
+					}
+				}
+			})
+			b.ReportMetric(float64(atomic.LoadInt64(&loads))/float64(b.N), "db-loads/op")
+		})
+	}
+}
+
+func newBenchRedis(b *testing.B) (*miniredis.Miniredis, *redis.Client) {
+	mr := miniredis.RunT(b)
+	return mr, redis.NewClient(&redis.Options{Addr: mr.Addr(), PoolSize: 128})
+}
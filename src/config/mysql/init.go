@@ -33,3 +33,8 @@ func Init() {
 func GetMysqlDB() *gorm.DB {
 	return _defalutDB
 }
+
+// SetMysqlDB 替换默认的连接，用于测试
+func SetMysqlDB(db *gorm.DB) {
+	_defalutDB = db
+}
@@ -11,9 +11,19 @@ const (
 	PORT     string = "6379"
 	PASSWORD string = "8888.216"
 	DBINDEX  int    = 0
+
+	// 分布式锁的模式: single 使用主Redis；redlock 使用 REDLOCK_ADDRS 中相互独立的Redis节点，
+	// 主从切换时不会出现两个持有者
+	LOCK_MODE string = "single"
 )
 
-var _defaultRDB *redis.Client
+// REDLOCK_ADDRS redlock 模式下的独立节点(非主从)，必须是不少于 3 的奇数个
+var REDLOCK_ADDRS = []string{"127.0.0.1:6380", "127.0.0.1:6381", "127.0.0.1:6382"}
+
+var (
+	_defaultRDB  *redis.Client
+	_lockClients []*redis.Client
+)
 
 func Init() {
 	addr := fmt.Sprintf("%s:%s", ADDR, PORT)
@@ -28,8 +38,30 @@ func Init() {
 	}
 	_defaultRDB = rdb
 
+	if LOCK_MODE == "redlock" {
+		if len(REDLOCK_ADDRS) < 3 || len(REDLOCK_ADDRS)%2 == 0 {
+			logrus.Fatalf("redlock mode requires an odd number of at least 3 independent redis nodes, got %d", len(REDLOCK_ADDRS))
+		}
+		for _, lockAddr := range REDLOCK_ADDRS {
+			_lockClients = append(_lockClients, redis.NewClient(&redis.Options{
+				Addr:     lockAddr,
+				Password: PASSWORD,
+				DB:       DBINDEX,
+			}))
+		}
+	}
 }
 
 func GetRedisClient() *redis.Client {
 	return _defaultRDB
 }
+
+// SetRedisClient 替换默认的客户端，用于测试
+func SetRedisClient(rdb *redis.Client) {
+	_defaultRDB = rdb
+}
+
+// GetLockClients 返回 redlock 模式下的节点，single 模式下为空
+func GetLockClients() []*redis.Client {
+	return _lockClients
+}
@@ -4,4 +4,5 @@ type UserDTO struct {
 	Id       int64  `json:"id"`
 	NickName string `json:"nickName"`
 	Icon     string `json:"icon"`
+	Role     string `json:"role,omitempty"`
 }
@@ -0,0 +1,102 @@
+package handler
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"hmdp-Go/src/dto"
+	"hmdp-Go/src/middleware"
+	"hmdp-Go/src/service"
+	"hmdp-Go/src/utils"
+	"net/http"
+)
+
+type AdminHandler struct {
+}
+
+var adminHandler *AdminHandler
+
+// @Description: list the current hot shop keys
+// @Router: /admin/cache/hot-keys [GET]
+func (*AdminHandler) QueryHotKeys(c *gin.Context) {
+	c.JSON(http.StatusOK, dto.OkWithData(service.ShopManager.QueryHotShops()))
+}
+
+// @Description: query the shop cache strategy of each request class
+// @Router: /admin/cache/strategy [GET]
+func (*AdminHandler) QueryCacheStrategy(c *gin.Context) {
+	c.JSON(http.StatusOK, dto.OkWithData(service.ShopManager.QueryShopCacheStrategies()))
+}
+
+// @Description: switch the shop cache strategy, an empty class means the default strategy
+// @Router: /admin/cache/strategy?class=xxx&strategy=xxx [PUT]
+func (*AdminHandler) SetCacheStrategy(c *gin.Context) {
+	err := service.ShopManager.SetShopCacheStrategy(c.Query("class"), c.Query("strategy"))
+	if errors.Is(err, service.ErrUnknownCacheStrategy) || errors.Is(err, service.ErrUnknownRequestClass) {
+		c.JSON(http.StatusOK, dto.Fail[string](err.Error()))
+		return
+	}
+	if err != nil {
+		logrus.Error(err.Error())
+		c.JSON(http.StatusOK, dto.Fail[string]("set cache strategy failed!"))
+		return
+	}
+	c.JSON(http.StatusOK, dto.Ok[string]())
+}
+
+// @Description: list the active distributed locks with ttl and holders, or a single lock if key is given
+// @Router: /admin/locks?key=xxx [GET]
+func (*AdminHandler) QueryLocks(c *gin.Context) {
+	if key := c.Query("key"); key != "" {
+		lock, err := service.LockManager.QueryLock(key)
+		if errors.Is(err, utils.ErrLockNotFound) {
+			c.JSON(http.StatusOK, dto.Fail[string]("lock not found"))
+			return
+		}
+		if err != nil {
+			logrus.Error(err.Error())
+			c.JSON(http.StatusOK, dto.Fail[string]("query lock failed!"))
+			return
+		}
+		c.JSON(http.StatusOK, dto.OkWithData(lock))
+		return
+	}
+
+	locks, err := service.LockManager.QueryLocks()
+	if err != nil {
+		logrus.Error(err.Error())
+		c.JSON(http.StatusOK, dto.Fail[string]("query locks failed!"))
+		return
+	}
+	c.JSON(http.StatusOK, dto.OkWithData(locks))
+}
+
+// @Description: force release a stuck lock, the previous holders are written to the audit stream
+// @Router: /admin/locks?key=xxx&reason=xxx [DELETE]
+func (*AdminHandler) ReleaseLock(c *gin.Context) {
+	admin, err := middleware.GetUserInfo(c)
+	if err != nil {
+		logrus.Error(err.Error())
+		c.JSON(http.StatusOK, dto.Fail[string]("get user info failed!"))
+		return
+	}
+
+	lock, err := service.LockManager.ForceRelease(admin, c.Query("key"), c.Query("reason"))
+	if errors.Is(err, service.ErrInvalidLockKey) || errors.Is(err, utils.ErrLockNotFound) ||
+		errors.Is(err, utils.ErrLockChanged) {
+		c.JSON(http.StatusOK, dto.Fail[string](err.Error()))
+		return
+	}
+	if err != nil {
+		logrus.Error(err.Error())
+		c.JSON(http.StatusOK, dto.Fail[string]("release lock failed!"))
+		return
+	}
+	c.JSON(http.StatusOK, dto.OkWithData(lock))
+}
+
+// @Description: lock contention metrics of this instance
+// @Router: /admin/locks/metrics [GET]
+func (*AdminHandler) QueryLockMetrics(c *gin.Context) {
+	c.JSON(http.StatusOK, dto.OkWithData(service.LockManager.QueryLockMetrics()))
+}
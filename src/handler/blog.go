@@ -1,7 +1,9 @@
 package handler
 
 import (
+	"errors"
 	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
 	"github.com/sirupsen/logrus"
 	"hmdp-Go/src/dto"
 	"hmdp-Go/src/middleware"
@@ -37,6 +39,10 @@ func (*BlogHandler) SaveBlog(c *gin.Context) {
 	userId := user.Id
 
 	id, err := service.BlogManager.SaveBlog(userId, &blog)
+	if errors.Is(err, service.ErrSensitiveContent) {
+		c.JSON(http.StatusOK, dto.Fail[string](err.Error()))
+		return
+	}
 	if err != nil {
 		logrus.Error("[Blog handler] insert data into database failed!")
 		c.JSON(http.StatusOK, dto.Fail[string]("insert failed!"))
@@ -45,6 +51,78 @@ func (*BlogHandler) SaveBlog(c *gin.Context) {
 	c.JSON(http.StatusOK, dto.OkWithData(id))
 }
 
+// @Description: update the blog, only the author can update it
+// @Router:  /blog [PUT]
+func (*BlogHandler) UpdateBlog(c *gin.Context) {
+	var blog model.Blog
+	if err := c.ShouldBindJSON(&blog); err != nil {
+		logrus.Error("[Blog handler] bind json failed!")
+		c.JSON(http.StatusOK, dto.Fail[string]("update failed!"))
+		return
+	}
+
+	user, err := middleware.GetUserInfo(c)
+	if err != nil {
+		logrus.Error(err.Error())
+		c.JSON(http.StatusOK, dto.Fail[string]("get user info failed!"))
+		return
+	}
+
+	err = service.BlogManager.UpdateBlog(user, &blog)
+	writeBlogResult(c, err, "update failed!")
+}
+
+// @Description: delete the blog, only the author can delete it
+// @Router:  /blog/:id [DELETE]
+func (*BlogHandler) DeleteBlog(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		logrus.Error("id is not a number")
+		c.JSON(http.StatusOK, dto.Fail[string]("id is not a number"))
+		return
+	}
+
+	user, err := middleware.GetUserInfo(c)
+	if err != nil {
+		logrus.Error(err.Error())
+		c.JSON(http.StatusOK, dto.Fail[string]("get user info failed!"))
+		return
+	}
+
+	err = service.BlogManager.DeleteBlog(user, id)
+	writeBlogResult(c, err, "delete failed!")
+}
+
+// @Description: restore a deleted blog
+// @Router:  /admin/blogs/:id/restore [PUT]
+func (*BlogHandler) RestoreBlog(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		logrus.Error("id is not a number")
+		c.JSON(http.StatusOK, dto.Fail[string]("id is not a number"))
+		return
+	}
+
+	err = service.BlogManager.RestoreBlog(id)
+	writeBlogResult(c, err, "restore failed!")
+}
+
+func writeBlogResult(c *gin.Context, err error, failMsg string) {
+	switch {
+	case err == nil:
+		c.JSON(http.StatusOK, dto.Ok[string]())
+	case errors.Is(err, service.ErrNoBlogPermission):
+		c.JSON(http.StatusOK, dto.Fail[string](err.Error()))
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusOK, dto.Fail[string]("blog not found"))
+	case errors.Is(err, service.ErrSensitiveContent) || errors.Is(err, service.ErrBlogNotDeleted):
+		c.JSON(http.StatusOK, dto.Fail[string](err.Error()))
+	default:
+		logrus.Error(err.Error())
+		c.JSON(http.StatusOK, dto.Fail[string](failMsg))
+	}
+}
+
 // @Description: modify the number of linked
 // @Router:  /blog/like/:id  [PUT]
 func (*BlogHandler) LikeBlog(c *gin.Context) {
@@ -71,7 +149,10 @@ func (*BlogHandler) LikeBlog(c *gin.Context) {
 	userId := user.Id
 
 	err = service.BlogManager.LikeBlog(id, userId)
-
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusOK, dto.Fail[string]("blog not found"))
+		return
+	}
 	if err != nil {
 		logrus.Error(err.Error())
 		c.JSON(http.StatusOK, dto.Fail[string]("like failed!"))
@@ -1,6 +1,153 @@
 package handler
 
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+	"github.com/sirupsen/logrus"
+	"hmdp-Go/src/dto"
+	"hmdp-Go/src/middleware"
+	"hmdp-Go/src/model"
+	"hmdp-Go/src/service"
+)
+
 type BlogCommentsHandler struct {
 }
 
 var blogCommentsHandle *BlogCommentsHandler
+
+// @Description: comment on a blog, or reply to a comment when answerId is given
+// @Router: /blog-comments [POST]
+func (*BlogCommentsHandler) SaveComment(c *gin.Context) {
+	var comment model.BlogComments
+	if err := c.ShouldBindJSON(&comment); err != nil {
+		logrus.Error("[BlogComments handler] bind json failed!")
+		c.JSON(http.StatusOK, dto.Fail[string]("comment failed!"))
+		return
+	}
+
+	user, err := middleware.GetUserInfo(c)
+	if err != nil {
+		logrus.Error(err.Error())
+		c.JSON(http.StatusOK, dto.Fail[string]("get user info failed!"))
+		return
+	}
+
+	id, err := service.BlogCommentsManager.SaveComment(user.Id, &comment)
+	if errors.Is(err, service.ErrInvalidComment) || errors.Is(err, service.ErrCommentNotFound) ||
+		errors.Is(err, service.ErrSensitiveContent) {
+		c.JSON(http.StatusOK, dto.Fail[string](err.Error()))
+		return
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusOK, dto.Fail[string]("blog not found"))
+		return
+	}
+	if err != nil {
+		logrus.Error(err.Error())
+		c.JSON(http.StatusOK, dto.Fail[string]("comment failed!"))
+		return
+	}
+	c.JSON(http.StatusOK, dto.OkWithData(id))
+}
+
+// @Description: query the top level comments of a blog, sorted by time or likes
+// @Router: /blog-comments/of/blog/:id [GET]
+func (*BlogCommentsHandler) QueryComments(c *gin.Context) {
+	blogId, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		logrus.Error("blog id is not a number")
+		c.JSON(http.StatusOK, dto.Fail[string]("blog id is not a number"))
+		return
+	}
+	current, err := queryCurrent(c)
+	if err != nil {
+		c.JSON(http.StatusOK, dto.Fail[string]("current is not a number"))
+		return
+	}
+
+	page, err := service.BlogCommentsManager.QueryComments(blogId, c.Query("sort"), current)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusOK, dto.Fail[string]("blog not found"))
+		return
+	}
+	if err != nil {
+		logrus.Error(err.Error())
+		c.JSON(http.StatusOK, dto.Fail[string]("query comments failed!"))
+		return
+	}
+	c.JSON(http.StatusOK, dto.OkWithList(page.List, page.Total))
+}
+
+// @Description: query the replies under a top level comment
+// @Router: /blog-comments/replies/:id [GET]
+func (*BlogCommentsHandler) QueryReplies(c *gin.Context) {
+	parentId, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		logrus.Error("comment id is not a number")
+		c.JSON(http.StatusOK, dto.Fail[string]("comment id is not a number"))
+		return
+	}
+	current, err := queryCurrent(c)
+	if err != nil {
+		c.JSON(http.StatusOK, dto.Fail[string]("current is not a number"))
+		return
+	}
+
+	page, err := service.BlogCommentsManager.QueryReplies(parentId, current)
+	if errors.Is(err, service.ErrCommentNotFound) {
+		c.JSON(http.StatusOK, dto.Fail[string](err.Error()))
+		return
+	}
+	if err != nil {
+		logrus.Error(err.Error())
+		c.JSON(http.StatusOK, dto.Fail[string]("query replies failed!"))
+		return
+	}
+	c.JSON(http.StatusOK, dto.OkWithList(page.List, page.Total))
+}
+
+// @Description: delete a comment and its replies
+// @Router: /blog-comments/:id [DELETE]
+func (*BlogCommentsHandler) DeleteComment(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		logrus.Error("comment id is not a number")
+		c.JSON(http.StatusOK, dto.Fail[string]("comment id is not a number"))
+		return
+	}
+
+	user, err := middleware.GetUserInfo(c)
+	if err != nil {
+		logrus.Error(err.Error())
+		c.JSON(http.StatusOK, dto.Fail[string]("get user info failed!"))
+		return
+	}
+
+	err = service.BlogCommentsManager.DeleteComment(user, id)
+	if errors.Is(err, service.ErrNoCommentPermission) {
+		c.JSON(http.StatusOK, dto.Fail[string](err.Error()))
+		return
+	}
+	if errors.Is(err, service.ErrCommentNotFound) {
+		c.JSON(http.StatusOK, dto.Fail[string](err.Error()))
+		return
+	}
+	if err != nil {
+		logrus.Error(err.Error())
+		c.JSON(http.StatusOK, dto.Fail[string]("delete comment failed!"))
+		return
+	}
+	c.JSON(http.StatusOK, dto.Ok[string]())
+}
+
+func queryCurrent(c *gin.Context) (int, error) {
+	currentStr := c.Query("current")
+	if currentStr == "" {
+		return 1, nil
+	}
+	return strconv.Atoi(currentStr)
+}
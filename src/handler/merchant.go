@@ -0,0 +1,199 @@
+package handler
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+	"github.com/sirupsen/logrus"
+	"hmdp-Go/src/dto"
+	"hmdp-Go/src/middleware"
+	"hmdp-Go/src/model"
+	"hmdp-Go/src/service"
+	"net/http"
+	"strconv"
+)
+
+type MerchantHandler struct {
+}
+
+var merchantHandler *MerchantHandler
+
+// @Description: apply to become a merchant
+// @Router: /merchant/apply [POST]
+func (*MerchantHandler) Apply(c *gin.Context) {
+	var apply model.MerchantApply
+	err := c.ShouldBindJSON(&apply)
+	if err != nil {
+		logrus.Error("bind json failed")
+		c.JSON(http.StatusOK, dto.Fail[string]("bind json failed!"))
+		return
+	}
+
+	user, err := middleware.GetUserInfo(c)
+	if err != nil {
+		logrus.Error(err.Error())
+		c.JSON(http.StatusOK, dto.Fail[string]("get user info failed!"))
+		return
+	}
+
+	err = service.MerchantManager.Apply(user, &apply)
+	if err != nil {
+		logrus.Warnf("user %d apply merchant failed: %v", user.Id, err)
+		c.JSON(http.StatusOK, dto.Fail[string](err.Error()))
+		return
+	}
+	c.JSON(http.StatusOK, dto.OkWithData(apply.Id))
+}
+
+// @Description: query my latest merchant apply
+// @Router: /merchant/apply/of/me [GET]
+func (*MerchantHandler) QueryMyApply(c *gin.Context) {
+	user, err := middleware.GetUserInfo(c)
+	if err != nil {
+		logrus.Error(err.Error())
+		c.JSON(http.StatusOK, dto.Fail[string]("get user info failed!"))
+		return
+	}
+
+	apply, err := service.MerchantManager.QueryMyApply(user.Id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusOK, dto.Fail[string]("no apply found"))
+		return
+	}
+	if err != nil {
+		logrus.Error(err.Error())
+		c.JSON(http.StatusOK, dto.Fail[string]("query apply failed!"))
+		return
+	}
+	c.JSON(http.StatusOK, dto.OkWithData(apply))
+}
+
+// @Description: query the shops of current merchant
+// @Router: /merchant/shops [GET]
+func (*MerchantHandler) QueryMyShops(c *gin.Context) {
+	user, err := middleware.GetUserInfo(c)
+	if err != nil {
+		logrus.Error(err.Error())
+		c.JSON(http.StatusOK, dto.Fail[string]("get user info failed!"))
+		return
+	}
+
+	shops, err := service.MerchantManager.QueryMyShops(user.Id)
+	if err != nil {
+		logrus.Error(err.Error())
+		c.JSON(http.StatusOK, dto.Fail[string]("query shops failed!"))
+		return
+	}
+	c.JSON(http.StatusOK, dto.OkWithData(shops))
+}
+
+// @Description: query the voucher orders of a shop owned by current merchant
+// @Router: /merchant/orders [GET]
+func (*MerchantHandler) QueryShopOrders(c *gin.Context) {
+	shopId, err := strconv.ParseInt(c.Query("shopId"), 10, 64)
+	if err != nil {
+		logrus.Error("shopId is not a number")
+		c.JSON(http.StatusOK, dto.Fail[string]("shopId is not a number"))
+		return
+	}
+
+	currentStr := c.Query("current")
+	if currentStr == "" {
+		currentStr = "1"
+	}
+	current, err := strconv.Atoi(currentStr)
+	if err != nil {
+		logrus.Error("current is not a number")
+		c.JSON(http.StatusOK, dto.Fail[string]("current is not a number"))
+		return
+	}
+
+	user, err := middleware.GetUserInfo(c)
+	if err != nil {
+		logrus.Error(err.Error())
+		c.JSON(http.StatusOK, dto.Fail[string]("get user info failed!"))
+		return
+	}
+
+	orders, err := service.MerchantManager.QueryShopOrders(user, shopId, current)
+	if errors.Is(err, service.ErrNoShopPermission) {
+		c.JSON(http.StatusOK, dto.Fail[string](err.Error()))
+		return
+	}
+	if err != nil {
+		logrus.Error(err.Error())
+		c.JSON(http.StatusOK, dto.Fail[string]("query orders failed!"))
+		return
+	}
+	c.JSON(http.StatusOK, dto.OkWithData(orders))
+}
+
+// @Description: list the merchant applies by status
+// @Router: /admin/merchant/apply [GET]
+func (*MerchantHandler) QueryApplies(c *gin.Context) {
+	statusStr := c.Query("status")
+	if statusStr == "" {
+		statusStr = strconv.Itoa(model.APPLY_PENDING)
+	}
+	status, err := strconv.Atoi(statusStr)
+	if err != nil {
+		logrus.Error("status is not a number")
+		c.JSON(http.StatusOK, dto.Fail[string]("status is not a number"))
+		return
+	}
+
+	currentStr := c.Query("current")
+	if currentStr == "" {
+		currentStr = "1"
+	}
+	current, err := strconv.Atoi(currentStr)
+	if err != nil {
+		logrus.Error("current is not a number")
+		c.JSON(http.StatusOK, dto.Fail[string]("current is not a number"))
+		return
+	}
+
+	applies, err := service.MerchantManager.QueryApplies(status, current)
+	if err != nil {
+		logrus.Error(err.Error())
+		c.JSON(http.StatusOK, dto.Fail[string]("query applies failed!"))
+		return
+	}
+	c.JSON(http.StatusOK, dto.OkWithData(applies))
+}
+
+// @Description: approve the merchant apply
+// @Router: /admin/merchant/apply/:id/approve [PUT]
+func (*MerchantHandler) ApproveApply(c *gin.Context) {
+	reviewApply(c, service.MerchantManager.ApproveApply)
+}
+
+// @Description: reject the merchant apply
+// @Router: /admin/merchant/apply/:id/reject [PUT]
+func (*MerchantHandler) RejectApply(c *gin.Context) {
+	reviewApply(c, service.MerchantManager.RejectApply)
+}
+
+func reviewApply(c *gin.Context, review func(adminId int64, applyId int64, remark string) error) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		logrus.Error("id is not a number")
+		c.JSON(http.StatusOK, dto.Fail[string]("id is not a number"))
+		return
+	}
+
+	admin, err := middleware.GetUserInfo(c)
+	if err != nil {
+		logrus.Error(err.Error())
+		c.JSON(http.StatusOK, dto.Fail[string]("get user info failed!"))
+		return
+	}
+
+	err = review(admin.Id, id, c.Query("remark"))
+	if err != nil {
+		logrus.Warnf("admin %d review apply %d failed: %v", admin.Id, id, err)
+		c.JSON(http.StatusOK, dto.Fail[string](err.Error()))
+		return
+	}
+	c.JSON(http.StatusOK, dto.Ok[string]())
+}
@@ -0,0 +1,115 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"hmdp-Go/src/dto"
+	"hmdp-Go/src/middleware"
+	"hmdp-Go/src/model"
+	"hmdp-Go/src/service"
+)
+
+type ReportHandler struct {
+}
+
+var reportHandler *ReportHandler
+
+// @Description: report a blog or a comment
+// @Router: /report [POST]
+func (*ReportHandler) Report(c *gin.Context) {
+	var report model.Report
+	if err := c.ShouldBindJSON(&report); err != nil {
+		logrus.Error("[Report handler] bind json failed!")
+		c.JSON(http.StatusOK, dto.Fail[string]("report failed!"))
+		return
+	}
+
+	user, err := middleware.GetUserInfo(c)
+	if err != nil {
+		logrus.Error(err.Error())
+		c.JSON(http.StatusOK, dto.Fail[string]("get user info failed!"))
+		return
+	}
+
+	err = service.ReportManager.Report(user.Id, &report)
+	if errors.Is(err, service.ErrInvalidReport) || errors.Is(err, service.ErrReportTargetNotFound) ||
+		errors.Is(err, service.ErrAlreadyReported) {
+		c.JSON(http.StatusOK, dto.Fail[string](err.Error()))
+		return
+	}
+	if err != nil {
+		logrus.Error(err.Error())
+		c.JSON(http.StatusOK, dto.Fail[string]("report failed!"))
+		return
+	}
+	c.JSON(http.StatusOK, dto.OkWithData(report.Id))
+}
+
+// @Description: list the reports by status
+// @Router: /admin/reports [GET]
+func (*ReportHandler) QueryReports(c *gin.Context) {
+	statusStr := c.Query("status")
+	if statusStr == "" {
+		statusStr = strconv.Itoa(model.REPORT_PENDING)
+	}
+	status, err := strconv.Atoi(statusStr)
+	if err != nil {
+		logrus.Error("status is not a number")
+		c.JSON(http.StatusOK, dto.Fail[string]("status is not a number"))
+		return
+	}
+	current, err := queryCurrent(c)
+	if err != nil {
+		logrus.Error("current is not a number")
+		c.JSON(http.StatusOK, dto.Fail[string]("current is not a number"))
+		return
+	}
+
+	reports, err := service.ReportManager.QueryReports(status, current)
+	if err != nil {
+		logrus.Error(err.Error())
+		c.JSON(http.StatusOK, dto.Fail[string]("query reports failed!"))
+		return
+	}
+	c.JSON(http.StatusOK, dto.OkWithData(reports))
+}
+
+// @Description: approve the report and prohibit the content
+// @Router: /admin/reports/:id/approve [PUT]
+func (*ReportHandler) ApproveReport(c *gin.Context) {
+	reviewReport(c, service.ReportManager.ApproveReport)
+}
+
+// @Description: dismiss the report and restore the content
+// @Router: /admin/reports/:id/dismiss [PUT]
+func (*ReportHandler) DismissReport(c *gin.Context) {
+	reviewReport(c, service.ReportManager.DismissReport)
+}
+
+func reviewReport(c *gin.Context, review func(adminId int64, reportId int64) error) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		logrus.Error("id is not a number")
+		c.JSON(http.StatusOK, dto.Fail[string]("id is not a number"))
+		return
+	}
+
+	admin, err := middleware.GetUserInfo(c)
+	if err != nil {
+		logrus.Error(err.Error())
+		c.JSON(http.StatusOK, dto.Fail[string]("get user info failed!"))
+		return
+	}
+
+	err = review(admin.Id, id)
+	if err != nil {
+		logrus.Warnf("admin %d review report %d failed: %v", admin.Id, id, err)
+		c.JSON(http.StatusOK, dto.Fail[string](err.Error()))
+		return
+	}
+	c.JSON(http.StatusOK, dto.Ok[string]())
+}
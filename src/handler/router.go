@@ -3,7 +3,9 @@ package handler
 import (
 	"github.com/gin-gonic/gin"
 	"hmdp-Go/src/middleware"
+	"hmdp-Go/src/model"
 	"net/http"
+	"time"
 )
 
 func ConfigRouter(r *gin.Engine) {
@@ -16,6 +18,21 @@ func ConfigRouter(r *gin.Engine) {
 		ctx.JSON(http.StatusOK, "pong")
 	})
 
+	// 限流规则：验证码、登录和秒杀接口严格限流，店铺查询宽松限流
+	codeRateLimit := middleware.RateLimit(
+		middleware.RateLimitRule{Name: "user:code", Limit: 5, Window: time.Minute, KeyFunc: middleware.LimitByIP},
+	)
+	loginRateLimit := middleware.RateLimit(
+		middleware.RateLimitRule{Name: "user:login", Limit: 20, Window: time.Minute, KeyFunc: middleware.LimitByIP},
+	)
+	seckillRateLimit := middleware.RateLimit(
+		middleware.RateLimitRule{Name: "seckill:user", Limit: 5, Window: time.Second, KeyFunc: middleware.LimitByUser},
+		middleware.RateLimitRule{Name: "seckill:ip", Limit: 50, Window: time.Second, KeyFunc: middleware.LimitByIP},
+	)
+	shopRateLimit := middleware.RateLimit(
+		middleware.RateLimitRule{Name: "shop", Limit: 300, Window: time.Minute, KeyFunc: middleware.LimitByUser},
+	)
+
 	// 需要认证的路由组
 	authGroup := r.Group("/")
 	authGroup.Use(middleware.AuthRequired())
@@ -26,16 +43,20 @@ func ConfigRouter(r *gin.Engine) {
 			userController.POST("/logout", userHandler.Logout)
 			userController.GET("/me", userHandler.Me)
 			userController.GET("/info/:id", userHandler.Info)
+			userController.PUT("/nickname", userHandler.UpdateNickName)
 			userController.GET("/sign", userHandler.sign)
 			userController.GET("/sign/count", userHandler.SignCount)
 		}
 
-		shopController := authGroup.Group("/shop")
+		// 商家和管理员才能管理店铺和优惠券
+		shopManageRole := middleware.RequireRole(model.ROLE_MERCHANT, model.ROLE_ADMIN)
 
+		shopController := authGroup.Group("/shop")
+		shopController.Use(shopRateLimit)
 		{
 			shopController.GET("/:id", shopHandler.QueryShopById)
-			shopController.POST("", shopHandler.SaveShop)
-			shopController.PUT("", shopHandler.UpdateShop)
+			shopController.POST("", shopManageRole, shopHandler.SaveShop)
+			shopController.PUT("", shopManageRole, shopHandler.UpdateShop)
 			shopController.GET("/of/type", shopHandler.QueryShopByType)
 			shopController.GET("/of/name", shopHandler.QueryShopByName)
 		}
@@ -43,13 +64,13 @@ func ConfigRouter(r *gin.Engine) {
 		voucherController := authGroup.Group("/voucher")
 
 		{
-			voucherController.POST("", voucherHandler.AddVoucher)
-			voucherController.POST("/seckill", voucherHandler.AddSecKillVoucher)
+			voucherController.POST("", shopManageRole, voucherHandler.AddVoucher)
+			voucherController.POST("/seckill", shopManageRole, voucherHandler.AddSecKillVoucher)
 			voucherController.GET("/list/:shopId", voucherHandler.QueryVoucherOfShop)
 		}
 
 		voucherOrderController := authGroup.Group("/voucher-order")
-
+		voucherOrderController.Use(seckillRateLimit)
 		{
 			voucherOrderController.POST("/seckill/:id", voucherOrderHandler.SeckillVoucher)
 		}
@@ -58,6 +79,8 @@ func ConfigRouter(r *gin.Engine) {
 
 		{
 			blogController.POST("", blogHandler.SaveBlog)
+			blogController.PUT("", blogHandler.UpdateBlog)
+			blogController.DELETE("/:id", blogHandler.DeleteBlog)
 			blogController.PUT("/like/:id", blogHandler.LikeBlog)
 			blogController.GET("/of/me", blogHandler.QueryMyBlog)
 			blogController.GET("/:id", blogHandler.GetBlogById)
@@ -65,6 +88,21 @@ func ConfigRouter(r *gin.Engine) {
 			blogController.GET("/of/follow", blogHandler.QueryBlogOfFollow)
 		}
 
+		blogCommentsController := authGroup.Group("/blog-comments")
+
+		{
+			blogCommentsController.POST("", blogCommentsHandle.SaveComment)
+			blogCommentsController.GET("/of/blog/:id", blogCommentsHandle.QueryComments)
+			blogCommentsController.GET("/replies/:id", blogCommentsHandle.QueryReplies)
+			blogCommentsController.DELETE("/:id", blogCommentsHandle.DeleteComment)
+		}
+
+		reportController := authGroup.Group("/report")
+
+		{
+			reportController.POST("", reportHandler.Report)
+		}
+
 		followContoller := authGroup.Group("/follow")
 
 		{
@@ -79,6 +117,42 @@ func ConfigRouter(r *gin.Engine) {
 			uploadController.POST("/blog", uploadHandler.UploadImage)
 			uploadController.GET("/blog/delete", uploadHandler.DeleteBlogImg)
 		}
+
+		merchantController := authGroup.Group("/merchant")
+
+		{
+			merchantController.POST("/apply", merchantHandler.Apply)
+			merchantController.GET("/apply/of/me", merchantHandler.QueryMyApply)
+		}
+
+		// 商家只能管理自己名下的店铺
+		merchantScopeController := authGroup.Group("/merchant")
+		merchantScopeController.Use(middleware.RequireRole(model.ROLE_MERCHANT))
+		{
+			merchantScopeController.GET("/shops", merchantHandler.QueryMyShops)
+			merchantScopeController.PUT("/shop", shopHandler.UpdateShop)
+			merchantScopeController.POST("/voucher", voucherHandler.AddVoucher)
+			merchantScopeController.POST("/voucher/seckill", voucherHandler.AddSecKillVoucher)
+			merchantScopeController.GET("/orders", merchantHandler.QueryShopOrders)
+		}
+
+		adminController := authGroup.Group("/admin")
+		adminController.Use(middleware.RequireRole(model.ROLE_ADMIN))
+		{
+			adminController.GET("/merchant/apply", merchantHandler.QueryApplies)
+			adminController.PUT("/merchant/apply/:id/approve", merchantHandler.ApproveApply)
+			adminController.PUT("/merchant/apply/:id/reject", merchantHandler.RejectApply)
+			adminController.GET("/cache/hot-keys", adminHandler.QueryHotKeys)
+			adminController.GET("/cache/strategy", adminHandler.QueryCacheStrategy)
+			adminController.PUT("/cache/strategy", adminHandler.SetCacheStrategy)
+			adminController.GET("/locks", adminHandler.QueryLocks)
+			adminController.DELETE("/locks", adminHandler.ReleaseLock)
+			adminController.GET("/locks/metrics", adminHandler.QueryLockMetrics)
+			adminController.GET("/reports", reportHandler.QueryReports)
+			adminController.PUT("/reports/:id/approve", reportHandler.ApproveReport)
+			adminController.PUT("/reports/:id/dismiss", reportHandler.DismissReport)
+			adminController.PUT("/blogs/:id/restore", blogHandler.RestoreBlog)
+		}
 	}
 
 	// 不需要认证的路由组
@@ -87,8 +161,8 @@ func ConfigRouter(r *gin.Engine) {
 		userControllerWithOutMid := publicGroup.Group("/user")
 
 		{
-			userControllerWithOutMid.POST("/code", userHandler.SendCode)
-			userControllerWithOutMid.POST("/login", userHandler.Login)
+			userControllerWithOutMid.POST("/code", codeRateLimit, userHandler.SendCode)
+			userControllerWithOutMid.POST("/login", loginRateLimit, userHandler.Login)
 		}
 
 		shopTypeController := publicGroup.Group("/shop-type")
@@ -108,6 +182,7 @@ func ConfigRouter(r *gin.Engine) {
 	{
 		statisticsGroup.GET("/uv", statisticsHandler.QueryUV)
 		statisticsGroup.GET("/uv/current", statisticsHandler.QueryCurrentUV)
+		statisticsGroup.GET("/cache", statisticsHandler.QueryCacheStats)
 	}
 
 }
@@ -1,9 +1,11 @@
 package handler
 
 import (
+	"errors"
 	"github.com/gin-gonic/gin"
 	"github.com/sirupsen/logrus"
 	"hmdp-Go/src/dto"
+	"hmdp-Go/src/middleware"
 	"hmdp-Go/src/model"
 	"hmdp-Go/src/service"
 	"net/http"
@@ -17,7 +19,6 @@ var shopHandler *ShopHandler
 
 // @Descirption: query shop by id
 // @Router: /shop/{id} [GET]
-// TODO add cache
 func (*ShopHandler) QueryShopById(c *gin.Context) {
 	idStr := c.Param("id")
 	if idStr == "" {
@@ -31,10 +32,14 @@ func (*ShopHandler) QueryShopById(c *gin.Context) {
 		c.JSON(http.StatusOK, dto.Fail[string]("transform type failed!"))
 		return
 	}
-	// shop, err := service.ShopManager.QueryShopById(id)
-
-	// shop , err := service.ShopManager.QueryShopByIdWithCache(id)
-	shop, err := service.ShopManager.QueryShopByIdWithCacheNull(id)
+	user, err := middleware.GetUserInfo(c)
+	if err != nil {
+		logrus.Error(err.Error())
+		c.JSON(http.StatusOK, dto.Fail[string]("get user info failed!"))
+		return
+	}
+	// 缓存策略由配置和功能开关决定，请求类别为用户的角色，由服务端决定，不能由客户端指定
+	shop, err := service.ShopManager.QueryShopByIdForClass(id, middleware.RoleOf(user))
 
 	if err != nil {
 		logrus.Error("query failed!")
@@ -54,7 +59,13 @@ func (*ShopHandler) SaveShop(c *gin.Context) {
 		c.JSON(http.StatusOK, dto.Fail[string]("bind json failed!"))
 		return
 	}
-	err = service.ShopManager.SaveShop(&shop)
+	user, err := middleware.GetUserInfo(c)
+	if err != nil {
+		logrus.Error(err.Error())
+		c.JSON(http.StatusOK, dto.Fail[string]("get user info failed!"))
+		return
+	}
+	err = service.ShopManager.SaveShop(user, &shop)
 	if err != nil {
 		logrus.Error("save data failed!")
 		c.JSON(http.StatusOK, dto.Fail[string]("save data failed!"))
@@ -73,8 +84,19 @@ func (*ShopHandler) UpdateShop(c *gin.Context) {
 		c.JSON(http.StatusOK, dto.Fail[string]("failed to bind data"))
 		return
 	}
+	user, err := middleware.GetUserInfo(c)
+	if err != nil {
+		logrus.Error(err.Error())
+		c.JSON(http.StatusOK, dto.Fail[string]("get user info failed!"))
+		return
+	}
 	// err = service.ShopManager.UpdateShop(&shop)
-	err = service.ShopManager.UpdateShopWithCache(&shop)
+	err = service.ShopManager.UpdateShopWithCache(user, &shop)
+	if errors.Is(err, service.ErrNoShopPermission) {
+		logrus.Warnf("user %d update shop %d: %v", user.Id, shop.Id, err)
+		c.JSON(http.StatusOK, dto.Fail[string](err.Error()))
+		return
+	}
 	if err != nil {
 		logrus.Error("failed to update shop")
 		c.JSON(http.StatusOK, dto.Fail[string]("failed to update shop"))
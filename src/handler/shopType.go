@@ -15,11 +15,10 @@ var shopTypeHandler *ShopTypeHandler
 
 // @Description: query shop type list
 // @Router: /shop-type/list  [GET]
-// TODO Add cache
 func (*ShopTypeHandler) QueryShopTypeList(c *gin.Context) {
 	// shopTypeList , err := service.ShopTypeManager.QueryShopTypeList()
-	// shopTypeList, err := service.ShopTypeManager.QueryShopTypeListWithCache()
-	shopTypeList, err := service.ShopTypeManager.QueryTypeListWithCacheList()
+	// shopTypeList, err := service.ShopTypeManager.QueryTypeListWithCacheList()
+	shopTypeList, err := service.ShopTypeManager.QueryShopTypeListWithCache()
 	if err != nil {
 		logrus.Error(err.Error())
 		c.JSON(http.StatusOK, dto.Fail[string]("failed to get type list"))
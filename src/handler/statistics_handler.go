@@ -4,6 +4,7 @@ import (
 	"context"
 	"github.com/gin-gonic/gin"
 	"github.com/sirupsen/logrus"
+	"hmdp-Go/src/cache"
 	redisClient "hmdp-Go/src/config/redis"
 	"hmdp-Go/src/dto"
 	"hmdp-Go/src/utils"
@@ -64,3 +65,12 @@ func (h *StatisticsHandler) QueryCurrentUV(c *gin.Context) {
 
 	c.JSON(http.StatusOK, dto.OkWithData(count))
 }
+
+// QueryCacheStats 查询缓存命中率
+// @Summary 查询两级缓存(本地缓存和Redis)的命中率
+// @Tags 统计分析
+// @Success 200 {object} dto.Result[[]cache.Stats]
+// @Router /statistics/cache [GET]
+func (h *StatisticsHandler) QueryCacheStats(c *gin.Context) {
+	c.JSON(http.StatusOK, dto.OkWithData(cache.AllStats()))
+}
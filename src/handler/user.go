@@ -1,6 +1,7 @@
 package handler
 
 import (
+	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/sirupsen/logrus"
@@ -26,10 +27,10 @@ func (*UserHandler) SendCode(c *gin.Context) {
 		c.JSON(http.StatusOK, dto.Fail[string]("phone is empty"))
 		return
 	}
-	err := service.UserManager.SaveCode(phoneStr)
+	err := service.UserManager.SaveCode(phoneStr, c.ClientIP())
 	if err != nil {
-		logrus.Warn("phone is not valid")
-		c.JSON(http.StatusOK, dto.Fail[string]("phone is not valid"))
+		logrus.Warnf("send code to %s failed: %v", phoneStr, err)
+		c.JSON(http.StatusOK, dto.Fail[string](err.Error()))
 		return
 	}
 	c.JSON(http.StatusOK, dto.Ok[string]())
@@ -49,12 +50,40 @@ func (*UserHandler) Login(c *gin.Context) {
 	token, err := service.UserManager.Login(&loginInfo)
 	if err != nil {
 		logrus.Error(err.Error())
+		if errors.Is(err, service.ErrCodeExpired) || errors.Is(err, service.ErrCodeWrong) ||
+			errors.Is(err, service.ErrCodeTooManyFailures) {
+			c.JSON(http.StatusOK, dto.Fail[string](err.Error()))
+			return
+		}
 		c.JSON(http.StatusOK, dto.Fail[string]("get token failed!"))
 		return
 	}
 	c.JSON(http.StatusOK, dto.OkWithData(token))
 }
 
+// @Description: update the nick name of current user
+// @Router: /user/nickname [PUT]
+func (*UserHandler) UpdateNickName(c *gin.Context) {
+	user, err := middleware.GetUserInfo(c)
+	if err != nil {
+		logrus.Error(err.Error())
+		c.JSON(http.StatusOK, dto.Fail[string]("get user info failed!"))
+		return
+	}
+
+	nickName, err := service.UserManager.UpdateNickName(user.Id, c.Query("nickName"))
+	if errors.Is(err, service.ErrInvalidNickName) || errors.Is(err, service.ErrSensitiveContent) {
+		c.JSON(http.StatusOK, dto.Fail[string](err.Error()))
+		return
+	}
+	if err != nil {
+		logrus.Error(err.Error())
+		c.JSON(http.StatusOK, dto.Fail[string]("update nick name failed!"))
+		return
+	}
+	c.JSON(http.StatusOK, dto.OkWithData(nickName))
+}
+
 // @Description: user layout
 // @Router: /user/logout [POST]
 func (*UserHandler) Logout(c *gin.Context) {
@@ -4,6 +4,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/sirupsen/logrus"
 	"hmdp-Go/src/dto"
+	"hmdp-Go/src/middleware"
 	"hmdp-Go/src/model"
 	"hmdp-Go/src/service"
 	"net/http"
@@ -25,6 +26,9 @@ func (*VoucherHandler) AddVoucher(c *gin.Context) {
 		c.JSON(http.StatusOK, dto.Fail[string]("bind json failed"))
 		return
 	}
+	if !checkVoucherShopAccess(c, voucher.ShopId) {
+		return
+	}
 	err = service.VoucherManager.AddVoucher(&voucher)
 	if err != nil {
 		logrus.Error("add voucher failed!")
@@ -42,6 +46,10 @@ func (*VoucherHandler) AddSecKillVoucher(c *gin.Context) {
 	if err != nil {
 		logrus.Error("failed to bind json")
 		c.JSON(http.StatusOK, dto.Fail[string]("failed to bind json"))
+		return
+	}
+	if !checkVoucherShopAccess(c, voucher.ShopId) {
+		return
 	}
 	err = service.VoucherManager.AddSeckillVoucher(&voucher)
 	if err != nil {
@@ -76,3 +84,19 @@ func (*VoucherHandler) QueryVoucherOfShop(c *gin.Context) {
 	}
 	c.JSON(http.StatusOK, dto.OkWithData(vouchers))
 }
+
+// checkVoucherShopAccess 商家只能给自己的店铺发放优惠券
+func checkVoucherShopAccess(c *gin.Context, shopId int64) bool {
+	user, err := middleware.GetUserInfo(c)
+	if err != nil {
+		logrus.Error(err.Error())
+		c.JSON(http.StatusOK, dto.Fail[string]("get user info failed!"))
+		return false
+	}
+	if err = service.ShopManager.CheckShopAccess(user, shopId); err != nil {
+		logrus.Warnf("user %d add voucher for shop %d: %v", user.Id, shopId, err)
+		c.JSON(http.StatusOK, dto.Fail[string](err.Error()))
+		return false
+	}
+	return true
+}
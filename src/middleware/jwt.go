@@ -129,8 +129,12 @@ func GlobalTokenMiddleware() gin.HandlerFunc {
 			// 缓冲期内刷新
 			bufferDeadline := claims.ExpiresAt.Add(time.Duration(claims.BufferTime) * time.Second)
 			shouldRefresh = time.Now().Before(bufferDeadline)
+			if shouldRefresh {
+				reloadRole(claims)
+			}
 		} else if err == nil && claims != nil {
-			// 有效Token设置上下文
+			// 有效Token设置上下文，角色以用户信息中的为准，刷新后的Token也会带上新的角色
+			reloadRole(claims)
 			c.Set("claims", claims)
 
 			// 检查是否需要静默刷新
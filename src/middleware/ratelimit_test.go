@@ -0,0 +1,113 @@
+package middleware
+
+import (
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	redisClient "hmdp-Go/src/config/redis"
+	"hmdp-Go/src/dto"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newRateLimitRouter(t *testing.T, rule RateLimitRule) (*gin.Engine, *miniredis.Miniredis) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	oldRDB := redisClient.GetRedisClient()
+	redisClient.SetRedisClient(redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+	t.Cleanup(func() { redisClient.SetRedisClient(oldRDB) })
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	rule.KeyFunc = func(c *gin.Context) string { return c.GetHeader("X-Client") }
+	r.GET("/limited", RateLimit(rule), func(c *gin.Context) {
+		c.JSON(http.StatusOK, dto.Ok[string]())
+	})
+	return r, mr
+}
+
+func requestLimited(r *gin.Engine, client string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/limited", nil)
+	req.Header.Set("X-Client", client)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestRateLimit(t *testing.T) {
+	r, mr := newRateLimitRouter(t, RateLimitRule{Name: "test", Limit: 2, Window: time.Second})
+	now := time.Now()
+	mr.SetTime(now)
+
+	for i := 0; i < 2; i++ {
+		if w := requestLimited(r, "a"); w.Code != http.StatusOK {
+			t.Fatalf("request %d should be allowed, but get %d", i, w.Code)
+		}
+	}
+	w := requestLimited(r, "a")
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "1" || w.Header().Get("X-RateLimit-Limit") != "2" {
+		t.Fatalf("expected 429 with Retry-After 1, but get %d %v", w.Code, w.Header())
+	}
+	// 不同维度分别计数
+	if w = requestLimited(r, "b"); w.Code != http.StatusOK {
+		t.Fatalf("other client should be allowed, but get %d", w.Code)
+	}
+
+	// 窗口滑过之后重新放行
+	mr.SetTime(now.Add(time.Second + time.Millisecond))
+	if w = requestLimited(r, "a"); w.Code != http.StatusOK {
+		t.Fatalf("request should be allowed after the window, but get %d", w.Code)
+	}
+}
+
+func TestRateLimitSlidingWindow(t *testing.T) {
+	r, mr := newRateLimitRouter(t, RateLimitRule{Name: "test", Limit: 2, Window: time.Second})
+	now := time.Now()
+
+	steps := []struct {
+		offset time.Duration
+		code   int
+	}{
+		{0, http.StatusOK},
+		{600 * time.Millisecond, http.StatusOK},
+		{700 * time.Millisecond, http.StatusTooManyRequests},
+		// 只有第一个请求滑出窗口，固定窗口会在这里放行两个请求
+		{1001 * time.Millisecond, http.StatusOK},
+		{1100 * time.Millisecond, http.StatusTooManyRequests},
+		{1601 * time.Millisecond, http.StatusOK},
+	}
+	for _, step := range steps {
+		mr.SetTime(now.Add(step.offset))
+		if w := requestLimited(r, "a"); w.Code != step.code {
+			t.Fatalf("at %v expected %d, but get %d", step.offset, step.code, w.Code)
+		}
+	}
+}
+
+func TestRateLimitScriptRetryAfter(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	now := time.Now()
+	mr.SetTime(now)
+
+	run := func(member string) int64 {
+		result, err := rateLimitScript.Run(t.Context(), rdb, []string{"limit"}, 1000, 1, member).Int64()
+		if err != nil {
+			t.Fatalf("run rate limit script failed: %v", err)
+		}
+		return result
+	}
+	if result := run("1"); result != 0 {
+		t.Fatalf("first request should be allowed, but get %d", result)
+	}
+	mr.SetTime(now.Add(300 * time.Millisecond))
+	// 最早的请求还需要700毫秒滑出窗口，被拒绝的请求不计数
+	if result := run("2"); result < 699 || result > 701 {
+		t.Fatalf("expected retry after about 700ms, but get %d", result)
+	}
+	if count, _ := rdb.ZCard(t.Context(), "limit").Result(); count != 1 {
+		t.Fatalf("denied request should not be recorded, but get %d records", count)
+	}
+}
@@ -0,0 +1,69 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"hmdp-Go/src/dto"
+	"hmdp-Go/src/model"
+	"net/http"
+)
+
+// roleLoader 查询用户当前的角色，由 service 启动时注册，middleware 不直接依赖 service
+var roleLoader func(userId int64) (string, error)
+
+// SetRoleLoader 注册角色的查询方法，注册后每个请求使用最新的角色，角色变更不需要重新登录
+func SetRoleLoader(loader func(userId int64) (string, error)) {
+	roleLoader = loader
+}
+
+// reloadRole 用最新的角色替换Token中的角色，查询失败时继续使用Token中的角色
+func reloadRole(claims *CustomClaims) {
+	if roleLoader == nil {
+		return
+	}
+	role, err := roleLoader(claims.Id)
+	if err != nil {
+		logrus.Warnf("reload role of user %d failed: %v", claims.Id, err)
+		return
+	}
+	claims.Role = role
+}
+
+// RequireRole 只允许拥有指定角色之一的用户访问，需要放在 AuthRequired 之后
+func RequireRole(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, err := GetUserInfo(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, dto.Fail[string]("请先登录"))
+			c.Abort()
+			return
+		}
+
+		if !HasRole(user, roles...) {
+			c.JSON(http.StatusForbidden, dto.Fail[string]("权限不足"))
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// RoleOf 返回用户的角色，没有角色的老Token视为普通用户
+func RoleOf(user dto.UserDTO) string {
+	if user.Role == "" {
+		return model.ROLE_USER
+	}
+	return user.Role
+}
+
+// HasRole 判断用户是否拥有指定角色之一
+func HasRole(user dto.UserDTO, roles ...string) bool {
+	role := RoleOf(user)
+	for _, r := range roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
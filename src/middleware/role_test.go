@@ -0,0 +1,85 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+	"hmdp-Go/src/dto"
+	"hmdp-Go/src/model"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func newRoleRouter(user *dto.UserDTO, roles ...string) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		if user != nil {
+			claims := NewJWT().CreateClaims(*user)
+			c.Set("claims", &claims)
+		}
+		c.Next()
+	})
+	r.GET("/admin", RequireRole(roles...), func(c *gin.Context) {
+		c.JSON(http.StatusOK, dto.Ok[string]())
+	})
+	return r
+}
+
+func TestRequireRole(t *testing.T) {
+	cases := []struct {
+		name string
+		user *dto.UserDTO
+		code int
+	}{
+		{"not login", nil, http.StatusUnauthorized},
+		{"old token without role", &dto.UserDTO{Id: 1}, http.StatusForbidden},
+		{"normal user", &dto.UserDTO{Id: 1, Role: model.ROLE_USER}, http.StatusForbidden},
+		{"merchant", &dto.UserDTO{Id: 2, Role: model.ROLE_MERCHANT}, http.StatusOK},
+		{"admin", &dto.UserDTO{Id: 3, Role: model.ROLE_ADMIN}, http.StatusOK},
+	}
+
+	for _, tc := range cases {
+		r := newRoleRouter(tc.user, model.ROLE_MERCHANT, model.ROLE_ADMIN)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin", nil))
+		if w.Code != tc.code {
+			t.Fatalf("%s: expected %d, but get %d", tc.name, tc.code, w.Code)
+		}
+	}
+}
+
+func TestRoleReloadedFromLoader(t *testing.T) {
+	roles := map[int64]string{1: model.ROLE_USER, 2: model.ROLE_MERCHANT}
+	SetRoleLoader(func(userId int64) (string, error) { return roles[userId], nil })
+	defer SetRoleLoader(nil)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(GlobalTokenMiddleware())
+	r.GET("/merchant", AuthRequired(), RequireRole(model.ROLE_MERCHANT), func(c *gin.Context) {
+		c.JSON(http.StatusOK, dto.Ok[string]())
+	})
+
+	cases := []struct {
+		name string
+		user dto.UserDTO
+		code int
+	}{
+		// Token 中的角色已经过期：被撤销的商家和刚入驻的商家
+		{"demoted", dto.UserDTO{Id: 1, Role: model.ROLE_MERCHANT}, http.StatusForbidden},
+		{"promoted", dto.UserDTO{Id: 2, Role: model.ROLE_USER}, http.StatusOK},
+	}
+	for _, tc := range cases {
+		token, err := NewJWT().CreateToken(NewJWT().CreateClaims(tc.user))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req := httptest.NewRequest(http.MethodGet, "/merchant", nil)
+		req.Header.Set(JWT_TOKEN_KEY, token)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != tc.code {
+			t.Fatalf("%s: expected %d, but get %d", tc.name, tc.code, w.Code)
+		}
+	}
+}
@@ -1,11 +1,11 @@
 package model
 
 import (
-	"fmt"
 	"github.com/jinzhu/gorm"
 	"github.com/sirupsen/logrus"
 	"hmdp-Go/src/config/mysql"
 	"hmdp-Go/src/utils"
+	"sort"
 	"strings"
 	"time"
 )
@@ -24,6 +24,7 @@ type Blog struct {
 	Content    string    `gorm:"column:content" json:"content"`
 	Liked      int       `gorm:"column:liked" json:"liked"`
 	Comments   int       `gorm:"column:comments" json:"comments"`
+	Status     int       `gorm:"column:status" json:"status"`
 	CreateTime time.Time `gorm:"column:create_time" json:"createTime"`
 	UpdateTime time.Time `gorm:"column:update_time" json:"updateTime"`
 }
@@ -32,8 +33,8 @@ func (*Blog) TableName() string {
 	return BLOG_TABLE_NAME
 }
 
-func (blog *Blog) SaveBlog() (id int64, err error) {
-	err = mysql.GetMysqlDB().Table(blog.TableName()).Create(blog).Error
+func (blog *Blog) SaveBlog(tx *gorm.DB) (id int64, err error) {
+	err = tx.Table(blog.TableName()).Create(blog).Error
 	if err != nil {
 		logrus.Error("[Blog model] insert data into database failed")
 		return id, err
@@ -44,16 +45,23 @@ func (blog *Blog) SaveBlog() (id int64, err error) {
 
 func (blog *Blog) QueryBlogs(current int) ([]Blog, error) {
 	var blogs []Blog
-	err := mysql.GetMysqlDB().Table(blog.TableName()).Where("user_id = ?", blog.UserId).Offset((current - 1) * utils.MAXPAGESIZE).Limit(utils.MAXPAGESIZE).Find(&blogs).Error
+	err := mysql.GetMysqlDB().Table(blog.TableName()).Where("user_id = ? AND status <> ?", blog.UserId, DELETED).Offset((current - 1) * utils.MAXPAGESIZE).Limit(utils.MAXPAGESIZE).Find(&blogs).Error
 	return blogs, err
 }
 
 func (blog *Blog) QueryHots(current int) ([]Blog, error) {
 	var blogs []Blog
-	err := mysql.GetMysqlDB().Order("liked desc").Offset((current - 1) * utils.MAXPAGESIZE).Limit(utils.MAXPAGESIZE).Find(&blogs).Error
+	err := mysql.GetMysqlDB().Where("status = ?", NORMAL).Order("liked desc").Offset((current - 1) * utils.MAXPAGESIZE).Limit(utils.MAXPAGESIZE).Find(&blogs).Error
 	return blogs, err
 }
 
+// QueryBlogIdsAfter 查询id大于 afterId 的所有博客的id，用于构建布隆过滤器，afterId 为 0 时查询全部
+func (blog *Blog) QueryBlogIdsAfter(afterId int64) ([]int64, error) {
+	var ids []int64
+	err := mysql.GetMysqlDB().Table(blog.TableName()).Where("id > ?", afterId).Pluck("id", &ids).Error
+	return ids, err
+}
+
 func (blog *Blog) GetBlogById(id int64) error {
 	err := mysql.GetMysqlDB().Where("id = ?", id).First(blog).Error
 	return err
@@ -69,14 +77,69 @@ func (blog *Blog) IncrLike() error {
 	return err
 }
 
+// QueryBlogByIds 按 ids 的顺序返回博客，不存在的博客被跳过
 func (blog *Blog) QueryBlogByIds(ids []int64) ([]Blog, error) {
 	var blogs []Blog
-	idStrs := make([]string, len(ids))
+	if len(ids) == 0 {
+		return blogs, nil
+	}
+	if err := mysql.GetMysqlDB().Table(blog.TableName()).Where("id IN (?)", ids).Find(&blogs).Error; err != nil {
+		return nil, err
+	}
+	order := make(map[int64]int, len(ids))
 	for i, id := range ids {
-		idStrs[i] = fmt.Sprintf("%d", id)
+		order[id] = i
 	}
-	idsJoined := strings.Join(idStrs, ",")
+	sort.Slice(blogs, func(i, j int) bool { return order[blogs[i].Id] < order[blogs[j].Id] })
+	return blogs, nil
+}
 
-	err := mysql.GetMysqlDB().Where("id IN ?", ids).Order(fmt.Sprintf("FIELD(id , %s)", idsJoined)).Find(&blogs).Error
-	return blogs, err
+// ImageList 图片以逗号分隔
+func (blog *Blog) ImageList() []string {
+	var images []string
+	for _, image := range strings.Split(blog.Images, ",") {
+		if image = strings.TrimSpace(image); image != "" {
+			images = append(images, image)
+		}
+	}
+	return images
+}
+
+// UpdateBlog 修改博客的内容，已删除和被禁止的博客不能修改，返回是否修改成功
+// hide 为 true 时同时隐藏博客等待审核；否则不修改状态，避免覆盖修改期间被举报自动隐藏的状态
+func (blog *Blog) UpdateBlog(tx *gorm.DB, hide bool) (bool, error) {
+	fields := map[string]interface{}{
+		"shop_id":     blog.ShopId,
+		"title":       blog.Title,
+		"images":      blog.Images,
+		"content":     blog.Content,
+		"update_time": blog.UpdateTime,
+	}
+	if hide {
+		fields["status"] = REPORTED
+	}
+	result := tx.Table(blog.TableName()).Where("id = ? AND status IN (?)", blog.Id, []int{NORMAL, REPORTED}).Updates(fields)
+	return result.RowsAffected > 0, result.Error
+}
+
+// IncrComments 在评论所在的事务中修改评论数，n 为负数时减少，不会小于 0
+// comments 是无符号列，先比较再相减，避免相减的结果为负数时报错
+func (blog *Blog) IncrComments(tx *gorm.DB, id int64, n int64) error {
+	expr := gorm.Expr("COALESCE(comments, 0) + ?", n)
+	if n < 0 {
+		expr = gorm.Expr("CASE WHEN COALESCE(comments, 0) >= ? THEN COALESCE(comments, 0) - ? ELSE 0 END", -n, -n)
+	}
+	return tx.Table(blog.TableName()).Where("id = ?", id).Update("comments", expr).Error
+}
+
+// ClearLiked 点赞数清零，与删除点赞记录一起使用
+func (blog *Blog) ClearLiked(tx *gorm.DB, id int64) error {
+	return tx.Table(blog.TableName()).Where("id = ?", id).Update("liked", 0).Error
+}
+
+// UpdateBlogStatus 只有状态为 from 之一的博客才会被修改，返回是否修改成功
+func (blog *Blog) UpdateBlogStatus(tx *gorm.DB, id int64, status int, from ...int) (bool, error) {
+	result := tx.Table(blog.TableName()).Where("id = ? AND status IN (?)", id, from).
+		Updates(map[string]interface{}{"status": status, "update_time": time.Now()})
+	return result.RowsAffected > 0, result.Error
 }
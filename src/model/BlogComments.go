@@ -1,22 +1,159 @@
 package model
 
-import "time"
+import (
+	"github.com/jinzhu/gorm"
+	"hmdp-Go/src/config/mysql"
+	"time"
+)
+
+const BLOG_COMMENTS_TABLE_NAME = "tb_blog_comments"
 
+// 评论和博客的状态，只有正常状态的内容对外可见
 const (
 	NORMAL     = 0 // 正常
-	REPORTED   = 1 // 被举报
+	REPORTED   = 1 // 被多人举报，等待审核期间隐藏
 	PROHIBITED = 2 // 被禁止
+	DELETED    = 3 // 博客被作者删除(软删除)，管理员可以恢复
 )
 
+// 评论列表的排序方式
+const (
+	COMMENT_SORT_TIME  = "time"
+	COMMENT_SORT_LIKES = "likes"
+)
+
+// BlogComments 评论分两级：ParentId 为 0 的是一级评论；回复的 ParentId 为所在的一级评论，
+// AnswerId 为直接回复的评论(一级评论或者同一楼中的其他回复)
 type BlogComments struct {
-	Id         int64     `gorm:"primary;AUTO_INCREMENT;column:id" json:"id"`
-	UserId     int64     `gorm:"column:user_id" json:"userId"`
-	BlogId     int64     `gorm:"column:blog_id" json:"blogId"`
-	ParentId   int64     `gorm:"column:parent_id" json:"parentId"`
-	AnswerId   int64     `gorm:"column:answer_id" json:"answerId"`
-	Content    string    `gorm:"column:content" json:"content"`
-	Liked      int       `gorm:"column:liked" json:"liked"`
-	Status     int       `gorm:"column:status" json:"status"`
-	CreateTime time.Time `gorm:"column:create_time" json:"createTime"`
-	UpdateTime time.Time `gorm:"column:update_time" json:"updateTime"`
+	Id          int64          `gorm:"primary;AUTO_INCREMENT;column:id" json:"id"`
+	UserId      int64          `gorm:"column:user_id" json:"userId"`
+	BlogId      int64          `gorm:"column:blog_id" json:"blogId"`
+	ParentId    int64          `gorm:"column:parent_id" json:"parentId"`
+	AnswerId    int64          `gorm:"column:answer_id" json:"answerId"`
+	Content     string         `gorm:"column:content" json:"content"`
+	Liked       int            `gorm:"column:liked" json:"liked"`
+	Status      int            `gorm:"column:status" json:"status"`
+	CreateTime  time.Time      `gorm:"column:create_time" json:"createTime"`
+	UpdateTime  time.Time      `gorm:"column:update_time" json:"updateTime"`
+	Icon        string         `gorm:"-" json:"icon"`
+	Name        string         `gorm:"-" json:"name"`
+	ReplyUserId int64          `gorm:"-" json:"replyUserId,omitempty"` // 被回复的用户
+	ReplyName   string         `gorm:"-" json:"replyName,omitempty"`
+	ReplyCount  int            `gorm:"-" json:"replyCount"`
+	Replies     []BlogComments `gorm:"-" json:"replies,omitempty"` // 一级评论下最早的几条回复
+}
+
+func (*BlogComments) TableName() string {
+	return BLOG_COMMENTS_TABLE_NAME
+}
+
+func (c *BlogComments) SaveComment(tx *gorm.DB) error {
+	return tx.Table(c.TableName()).Create(c).Error
+}
+
+// QueryCommentById 查询任意状态的评论，是否可见由调用方判断
+func (c *BlogComments) QueryCommentById(id int64) error {
+	return mysql.GetMysqlDB().Table(c.TableName()).Where("id = ?", id).First(c).Error
+}
+
+func (c *BlogComments) QueryCommentsByIds(ids []int64) ([]BlogComments, error) {
+	var comments []BlogComments
+	if len(ids) == 0 {
+		return comments, nil
+	}
+	err := mysql.GetMysqlDB().Table(c.TableName()).Where("id IN (?)", ids).Find(&comments).Error
+	return comments, err
+}
+
+// QueryTopComments 分页查询博客的一级评论，返回当前页和一级评论总数
+func (c *BlogComments) QueryTopComments(blogId int64, sortBy string, current int, pageSize int) ([]BlogComments, int64, error) {
+	var comments []BlogComments
+	var total int64
+	db := mysql.GetMysqlDB().Table(c.TableName()).Where("blog_id = ? AND parent_id = 0 AND status = ?", blogId, NORMAL)
+	if err := db.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	order := "create_time desc, id desc"
+	if sortBy == COMMENT_SORT_LIKES {
+		order = "liked desc, id desc"
+	}
+	err := db.Order(order).Offset((current - 1) * pageSize).Limit(pageSize).Find(&comments).Error
+	return comments, total, err
+}
+
+// QueryReplies 按时间顺序分页查询一级评论下的回复，返回当前页和回复总数
+func (c *BlogComments) QueryReplies(parentId int64, current int, pageSize int) ([]BlogComments, int64, error) {
+	var replies []BlogComments
+	var total int64
+	db := mysql.GetMysqlDB().Table(c.TableName()).Where("parent_id = ? AND status = ?", parentId, NORMAL)
+	if err := db.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err := db.Order("create_time asc, id asc").Offset((current - 1) * pageSize).Limit(pageSize).Find(&replies).Error
+	return replies, total, err
+}
+
+// QueryReplyPreviews 一次查询多个一级评论下最早的 limit 条回复，按一级评论分组
+func (c *BlogComments) QueryReplyPreviews(parentIds []int64, limit int) (map[int64][]BlogComments, error) {
+	previews := make(map[int64][]BlogComments, len(parentIds))
+	if len(parentIds) == 0 {
+		return previews, nil
+	}
+	db := mysql.GetMysqlDB()
+	rows, err := db.Table(c.TableName()).Where("parent_id IN (?) AND status = ?", parentIds, NORMAL).
+		Order("parent_id asc, create_time asc, id asc").Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var reply BlogComments
+		if err = db.ScanRows(rows, &reply); err != nil {
+			return nil, err
+		}
+		if len(previews[reply.ParentId]) < limit {
+			previews[reply.ParentId] = append(previews[reply.ParentId], reply)
+		}
+	}
+	return previews, rows.Err()
+}
+
+// CountReplies 统计每个一级评论下的回复数
+func (c *BlogComments) CountReplies(parentIds []int64) (map[int64]int, error) {
+	counts := make(map[int64]int, len(parentIds))
+	if len(parentIds) == 0 {
+		return counts, nil
+	}
+	rows, err := mysql.GetMysqlDB().Table(c.TableName()).Select("parent_id, count(*)").
+		Where("parent_id IN (?) AND status = ?", parentIds, NORMAL).Group("parent_id").Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var parentId int64
+		var count int
+		if err = rows.Scan(&parentId, &count); err != nil {
+			return nil, err
+		}
+		counts[parentId] = count
+	}
+	return counts, rows.Err()
+}
+
+// DeleteComment 删除评论，一级评论连同下面的回复一起删除，返回删除的评论中正常状态的条数
+func (c *BlogComments) DeleteComment(tx *gorm.DB, id int64) (int64, error) {
+	var visible int64
+	db := tx.Table(c.TableName()).Where("id = ? OR parent_id = ?", id, id)
+	if err := db.Where("status = ?", NORMAL).Count(&visible).Error; err != nil {
+		return 0, err
+	}
+	return visible, db.Delete(BlogComments{}).Error
+}
+
+// UpdateCommentStatus 只有状态为 from 之一的评论才会被修改，返回是否修改成功
+func (c *BlogComments) UpdateCommentStatus(tx *gorm.DB, id int64, status int, from ...int) (bool, error) {
+	result := tx.Table(c.TableName()).Where("id = ? AND status IN (?)", id, from).
+		Updates(map[string]interface{}{"status": status, "update_time": time.Now()})
+	return result.RowsAffected > 0, result.Error
 }
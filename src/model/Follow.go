@@ -37,3 +37,29 @@ func (f *Follow) GetFollowsByFollowId(id int64) ([]Follow, error) {
 	err := mysql.GetMysqlDB().Table(f.TableName()).Where("follow_user_id = ?", id).Find(&follows).Error
 	return follows, err
 }
+
+// CountFollowers 统计用户的粉丝数
+func (f *Follow) CountFollowers(followUserId int64) (int, error) {
+	var count int
+	err := mysql.GetMysqlDB().Table(f.TableName()).Where("follow_user_id = ?", followUserId).Count(&count).Error
+	return count, err
+}
+
+// QueryFollowers 按id分页查询用户的粉丝，afterId 为上一页最后一条记录的id
+func (f *Follow) QueryFollowers(followUserId int64, afterId int64, limit int) ([]Follow, error) {
+	var follows []Follow
+	err := mysql.GetMysqlDB().Table(f.TableName()).Where("follow_user_id = ? AND id > ?", followUserId, afterId).
+		Order("id asc").Limit(limit).Find(&follows).Error
+	return follows, err
+}
+
+// QueryFollowingIn 查询 ids 中被用户关注的用户
+func (f *Follow) QueryFollowingIn(userId int64, ids []int64) ([]int64, error) {
+	var following []int64
+	if len(ids) == 0 {
+		return following, nil
+	}
+	err := mysql.GetMysqlDB().Table(f.TableName()).Where("user_id = ? AND follow_user_id IN (?)", userId, ids).
+		Pluck("follow_user_id", &following).Error
+	return following, err
+}
@@ -0,0 +1,64 @@
+package model
+
+import (
+	"github.com/jinzhu/gorm"
+	"hmdp-Go/src/config/mysql"
+	"hmdp-Go/src/utils"
+	"time"
+)
+
+const MERCHANT_APPLY_TABLE_NAME = "tb_merchant_apply"
+
+// 商家入驻申请状态
+const (
+	APPLY_PENDING  = 0 // 待审核
+	APPLY_APPROVED = 1 // 审核通过
+	APPLY_REJECTED = 2 // 审核拒绝
+)
+
+type MerchantApply struct {
+	Id          int64     `gorm:"primary;AUTO_INCREMENT;column:id" json:"id"`
+	UserId      int64     `gorm:"column:user_id" json:"userId"`
+	Name        string    `gorm:"column:name" json:"name"`
+	Contact     string    `gorm:"column:contact" json:"contact"`
+	Description string    `gorm:"column:description" json:"description"`
+	Status      int       `gorm:"column:status" json:"status"`
+	ReviewerId  int64     `gorm:"column:reviewer_id" json:"reviewerId"`
+	Remark      string    `gorm:"column:remark" json:"remark"`
+	CreateTime  time.Time `gorm:"column:create_time" json:"createTime"`
+	UpdateTime  time.Time `gorm:"column:update_time" json:"updateTime"`
+}
+
+func (*MerchantApply) TableName() string {
+	return MERCHANT_APPLY_TABLE_NAME
+}
+
+func (ma *MerchantApply) SaveApply() error {
+	return mysql.GetMysqlDB().Table(ma.TableName()).Create(ma).Error
+}
+
+func (ma *MerchantApply) QueryApplyById(id int64, tx *gorm.DB) error {
+	return tx.Table(ma.TableName()).Where("id = ?", id).First(ma).Error
+}
+
+// QueryLatestApplyByUser 查询用户最近一次的入驻申请
+func (ma *MerchantApply) QueryLatestApplyByUser(userId int64) error {
+	return mysql.GetMysqlDB().Table(ma.TableName()).Where("user_id = ?", userId).Order("id desc").First(ma).Error
+}
+
+func (ma *MerchantApply) QueryApplies(status int, current int) ([]MerchantApply, error) {
+	var applies []MerchantApply
+	err := mysql.GetMysqlDB().Table(ma.TableName()).Where("status = ?", status).Order("id asc").Offset((current - 1) * utils.MAXPAGESIZE).Limit(utils.MAXPAGESIZE).Find(&applies).Error
+	return applies, err
+}
+
+// UpdateApplyStatus 只有待审核的申请才能被审核，返回是否更新成功
+func (ma *MerchantApply) UpdateApplyStatus(tx *gorm.DB) (bool, error) {
+	result := tx.Table(ma.TableName()).Where("id = ? AND status = ?", ma.Id, APPLY_PENDING).Updates(map[string]interface{}{
+		"status":      ma.Status,
+		"reviewer_id": ma.ReviewerId,
+		"remark":      ma.Remark,
+		"update_time": ma.UpdateTime,
+	})
+	return result.RowsAffected > 0, result.Error
+}
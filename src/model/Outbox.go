@@ -0,0 +1,81 @@
+package model
+
+import (
+	"github.com/jinzhu/gorm"
+	"hmdp-Go/src/config/mysql"
+	"time"
+)
+
+const OUTBOX_TABLE_NAME = "tb_outbox"
+
+// 发件箱事件的状态
+const (
+	OUTBOX_PENDING = 0 // 等待投递
+	OUTBOX_DONE    = 1 // 投递成功
+	OUTBOX_DEAD    = 2 // 超过最大重试次数，需要人工处理
+)
+
+// 发件箱事件类型
+const (
+	OUTBOX_CACHE_DELETE = "cache_delete" // 删除缓存
+	OUTBOX_REDIS_SET    = "redis_set"    // 写入Redis
+	OUTBOX_REDIS_INIT   = "redis_init"   // 初始化Redis中的值(SET NX)，已经存在时不覆盖
+	OUTBOX_PUBLISH      = "publish"      // 发布事件到Redis Stream
+	OUTBOX_IMAGE_DELETE = "image_delete" // 删除博客不再引用的图片
+	OUTBOX_BLOOM_ADD    = "bloom_add"    // 新增的id加入布隆过滤器
+)
+
+// Outbox 与业务数据在同一个事务中写入，由后台任务投递到Redis，保证至少投递一次
+type Outbox struct {
+	Id            int64     `gorm:"primary;AUTO_INCREMENT;column:id" json:"id"`
+	EventType     string    `gorm:"column:event_type" json:"eventType"`
+	Payload       string    `gorm:"column:payload" json:"payload"`
+	Status        int       `gorm:"column:status" json:"status"`
+	Attempts      int       `gorm:"column:attempts" json:"attempts"`
+	NextRetryTime time.Time `gorm:"column:next_retry_time" json:"nextRetryTime"`
+	LastError     string    `gorm:"column:last_error" json:"lastError"`
+	CreateTime    time.Time `gorm:"column:create_time" json:"createTime"`
+	UpdateTime    time.Time `gorm:"column:update_time" json:"updateTime"`
+}
+
+func (*Outbox) TableName() string {
+	return OUTBOX_TABLE_NAME
+}
+
+// SaveOutbox 必须使用业务操作的事务写入
+func (o *Outbox) SaveOutbox(tx *gorm.DB) error {
+	return tx.Table(o.TableName()).Create(o).Error
+}
+
+// QueryDueOutbox 查询已经到达投递时间的事件
+func (o *Outbox) QueryDueOutbox(now time.Time, limit int) ([]Outbox, error) {
+	var events []Outbox
+	err := mysql.GetMysqlDB().Table(o.TableName()).
+		Where("status = ? AND next_retry_time <= ?", OUTBOX_PENDING, now).
+		Order("id asc").Limit(limit).Find(&events).Error
+	return events, err
+}
+
+func (o *Outbox) MarkDone(id int64) error {
+	return mysql.GetMysqlDB().Table(o.TableName()).Where("id = ?", id).Updates(map[string]interface{}{
+		"status":      OUTBOX_DONE,
+		"update_time": time.Now(),
+	}).Error
+}
+
+// MarkFailed 记录失败原因，status 为 OUTBOX_PENDING 时在 nextRetryTime 之后重试
+func (o *Outbox) MarkFailed(id int64, status int, attempts int, nextRetryTime time.Time, lastError string) error {
+	return mysql.GetMysqlDB().Table(o.TableName()).Where("id = ?", id).Updates(map[string]interface{}{
+		"status":          status,
+		"attempts":        attempts,
+		"next_retry_time": nextRetryTime,
+		"last_error":      lastError,
+		"update_time":     time.Now(),
+	}).Error
+}
+
+// DeleteDoneOutbox 清理投递成功的历史事件
+func (o *Outbox) DeleteDoneOutbox(before time.Time) error {
+	return mysql.GetMysqlDB().Table(o.TableName()).
+		Where("status = ? AND update_time < ?", OUTBOX_DONE, before).Delete(Outbox{}).Error
+}
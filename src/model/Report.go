@@ -0,0 +1,93 @@
+package model
+
+import (
+	"errors"
+	mysqlDriver "github.com/go-sql-driver/mysql"
+	"github.com/jinzhu/gorm"
+	"hmdp-Go/src/config/mysql"
+	"hmdp-Go/src/utils"
+	"strings"
+	"time"
+)
+
+const REPORT_TABLE_NAME = "tb_report"
+
+// 被举报的内容类型
+const (
+	REPORT_TARGET_BLOG    = 1
+	REPORT_TARGET_COMMENT = 2
+)
+
+// 举报的处理状态，同一内容的待处理举报一起处理
+const (
+	REPORT_PENDING   = 0 // 待处理
+	REPORT_APPROVED  = 1 // 举报成立，内容被禁止
+	REPORT_DISMISSED = 2 // 举报不成立，内容恢复正常
+)
+
+var ErrDuplicateReport = errors.New("duplicate pending report")
+
+type Report struct {
+	Id         int64     `gorm:"primary;AUTO_INCREMENT;column:id" json:"id"`
+	UserId     int64     `gorm:"column:user_id" json:"userId"`
+	TargetType int       `gorm:"column:target_type" json:"targetType"`
+	TargetId   int64     `gorm:"column:target_id" json:"targetId"`
+	Reason     string    `gorm:"column:reason" json:"reason"`
+	Status     int       `gorm:"column:status" json:"status"`
+	ReviewerId int64     `gorm:"column:reviewer_id" json:"reviewerId"`
+	CreateTime time.Time `gorm:"column:create_time" json:"createTime"`
+	UpdateTime time.Time `gorm:"column:update_time" json:"updateTime"`
+}
+
+func (*Report) TableName() string {
+	return REPORT_TABLE_NAME
+}
+
+// SaveReport 同一用户对同一内容只能有一个待处理的举报，由唯一索引保证，重复时返回 ErrDuplicateReport
+func (r *Report) SaveReport(tx *gorm.DB) error {
+	err := tx.Table(r.TableName()).Create(r).Error
+	if isDuplicateKey(err) {
+		return ErrDuplicateReport
+	}
+	return err
+}
+
+func (r *Report) QueryReportById(id int64, tx *gorm.DB) error {
+	return tx.Table(r.TableName()).Where("id = ?", id).First(r).Error
+}
+
+// CountPendingReporters 统计举报该内容且还没有被处理的不同用户数
+func (r *Report) CountPendingReporters(tx *gorm.DB, targetType int, targetId int64) (int, error) {
+	var count int
+	err := tx.Table(r.TableName()).Select("COUNT(DISTINCT user_id)").
+		Where("target_type = ? AND target_id = ? AND status = ?", targetType, targetId, REPORT_PENDING).
+		Row().Scan(&count)
+	return count, err
+}
+
+func (r *Report) QueryReports(status int, current int) ([]Report, error) {
+	var reports []Report
+	err := mysql.GetMysqlDB().Table(r.TableName()).Where("status = ?", status).Order("id asc").Offset((current - 1) * utils.MAXPAGESIZE).Limit(utils.MAXPAGESIZE).Find(&reports).Error
+	return reports, err
+}
+
+// ResolveReports 处理该内容所有待处理的举报，返回处理的条数
+func (r *Report) ResolveReports(tx *gorm.DB, targetType int, targetId int64, status int, reviewerId int64) (int64, error) {
+	result := tx.Table(r.TableName()).
+		Where("target_type = ? AND target_id = ? AND status = ?", targetType, targetId, REPORT_PENDING).
+		Updates(map[string]interface{}{
+			"status":      status,
+			"reviewer_id": reviewerId,
+			"update_time": time.Now(),
+		})
+	return result.RowsAffected, result.Error
+}
+
+// isDuplicateKey 是否违反唯一索引：MySQL 的 1062 错误，测试使用的 sqlite 返回 UNIQUE constraint failed
+func isDuplicateKey(err error) bool {
+	var mysqlErr *mysqlDriver.MySQLError
+	if errors.As(err, &mysqlErr) {
+		return mysqlErr.Number == 1062
+	}
+	return err != nil && strings.Contains(err.Error(), "UNIQUE constraint failed")
+}
@@ -61,8 +61,8 @@ func (*Shop) QueryShopByIds(ids []int64) ([]Shop, error) {
 	return shops, err
 }
 
-func (shop *Shop) SaveShop() error {
-	err := mysql.GetMysqlDB().Table(shop.TableName()).Create(shop).Error
+func (shop *Shop) SaveShop(tx *gorm.DB) error {
+	err := tx.Table(shop.TableName()).Create(shop).Error
 	return err
 }
 
@@ -82,3 +82,10 @@ func (shop *Shop) QueryShopByName(name string, current int) ([]Shop, error) {
 	err := mysql.GetMysqlDB().Table(shop.TableName()).Where("name LIKE ?", name).Offset((current - 1) * utils.MAXPAGESIZE).Limit(utils.MAXPAGESIZE).Find(&shops).Error
 	return shops, err
 }
+
+// QueryShopIdsAfter 查询id大于 afterId 的所有店铺的id，用于构建布隆过滤器，afterId 为 0 时查询全部
+func (shop *Shop) QueryShopIdsAfter(afterId int64) ([]int64, error) {
+	var ids []int64
+	err := mysql.GetMysqlDB().Table(shop.TableName()).Where("id > ?", afterId).Pluck("id", &ids).Error
+	return ids, err
+}
@@ -0,0 +1,37 @@
+package model
+
+import (
+	"github.com/jinzhu/gorm"
+	"hmdp-Go/src/config/mysql"
+	"time"
+)
+
+const SHOP_OWNER_TABLE_NAME = "tb_shop_owner"
+
+// ShopOwner 商家与店铺的归属关系
+type ShopOwner struct {
+	Id         int64     `gorm:"primary;AUTO_INCREMENT;column:id" json:"id"`
+	ShopId     int64     `gorm:"column:shop_id" json:"shopId"`
+	UserId     int64     `gorm:"column:user_id" json:"userId"`
+	CreateTime time.Time `gorm:"column:create_time" json:"createTime"`
+}
+
+func (*ShopOwner) TableName() string {
+	return SHOP_OWNER_TABLE_NAME
+}
+
+func (so *ShopOwner) SaveShopOwner(tx *gorm.DB) error {
+	return tx.Table(so.TableName()).Create(so).Error
+}
+
+func (so *ShopOwner) IsShopOwner(userId int64, shopId int64) (bool, error) {
+	var count int
+	err := mysql.GetMysqlDB().Table(so.TableName()).Where("user_id = ? AND shop_id = ?", userId, shopId).Count(&count).Error
+	return count > 0, err
+}
+
+func (so *ShopOwner) QueryShopIdsByUserId(userId int64) ([]int64, error) {
+	var ids []int64
+	err := mysql.GetMysqlDB().Table(so.TableName()).Where("user_id = ?", userId).Order("id asc").Pluck("shop_id", &ids).Error
+	return ids, err
+}
@@ -1,17 +1,26 @@
 package model
 
 import (
+	"github.com/jinzhu/gorm"
 	"gorm.io/gorm/clause"
 	"hmdp-Go/src/config/mysql"
 	"time"
 )
 
+// 用户角色
+const (
+	ROLE_USER     = "user"     // 普通用户
+	ROLE_MERCHANT = "merchant" // 商家
+	ROLE_ADMIN    = "admin"    // 管理员
+)
+
 type User struct {
 	Id         int64     `gorm:"primary;AUTO_INCREMENT;column:id" json:"id"`
 	Phone      string    `gorm:"column:phone" json:"phone"`
 	Password   string    `gorm:"column:password" json:"password"`
 	NickName   string    `gorm:"column:nick_name" json:"nickName"`
 	Icon       string    `gorm:"column:icon" json:"icon"`
+	Role       string    `gorm:"column:role" json:"role"`
 	CreateTime time.Time `gorm:"column:create_time" json:"createTime"`
 	UpdateTime time.Time `gorm:"column:update_time" json:"updateTime"`
 }
@@ -20,6 +29,14 @@ func (*User) TableName() string {
 	return "tb_user"
 }
 
+// GetRole 老数据没有角色字段，统一视为普通用户
+func (user *User) GetRole() string {
+	if user.Role == "" {
+		return ROLE_USER
+	}
+	return user.Role
+}
+
 func (user *User) GetUserById(id int64) (User, error) {
 	var u User
 	err := mysql.GetMysqlDB().Table(user.TableName()).Where("id = ?", id).First(&u).Error
@@ -31,11 +48,18 @@ func (user *User) GetUserByPhone(phone string) error {
 	return err
 }
 
-func (user *User) SaveUser() error {
-	err := mysql.GetMysqlDB().Table(user.TableName()).Create(user).Error
+func (user *User) SaveUser(tx *gorm.DB) error {
+	err := tx.Table(user.TableName()).Create(user).Error
 	return err
 }
 
+// QueryUserIdsAfter 查询id大于 afterId 的所有用户的id，用于构建布隆过滤器，afterId 为 0 时查询全部
+func (user *User) QueryUserIdsAfter(afterId int64) ([]int64, error) {
+	var ids []int64
+	err := mysql.GetMysqlDB().Table(user.TableName()).Where("id > ?", afterId).Pluck("id", &ids).Error
+	return ids, err
+}
+
 func (user *User) GetUsersByIds(ids []int64) ([]User, error) {
 	var users []User
 
@@ -47,3 +71,17 @@ func (user *User) GetUsersByIds(ids []int64) ([]User, error) {
 
 	return users, err
 }
+
+func (user *User) UpdateRole(tx *gorm.DB, id int64, role string) error {
+	return tx.Table(user.TableName()).Where("id = ?", id).Updates(map[string]interface{}{
+		"role":        role,
+		"update_time": time.Now(),
+	}).Error
+}
+
+func (user *User) UpdateNickName(id int64, nickName string) error {
+	return mysql.GetMysqlDB().Table(user.TableName()).Where("id = ?", id).Updates(map[string]interface{}{
+		"nick_name":   nickName,
+		"update_time": time.Now(),
+	}).Error
+}
@@ -3,6 +3,7 @@ package model
 import (
 	"github.com/jinzhu/gorm"
 	"hmdp-Go/src/config/mysql"
+	"hmdp-Go/src/utils"
 	"time"
 )
 
@@ -55,3 +56,17 @@ func (vo *VoucherOrder) HasPurchasedVoucher(userId, voucherId int64, tx *gorm.DB
 		Count(&count).Error
 	return count > 0, err
 }
+
+// QueryOrdersByShop 分页查询某个店铺所有优惠券的订单
+func (vo *VoucherOrder) QueryOrdersByShop(shopId int64, current int) ([]VoucherOrder, error) {
+	var orders []VoucherOrder
+	err := mysql.GetMysqlDB().Table(vo.TableName()).
+		Select("tb_voucher_order.*").
+		Joins("JOIN "+VOUCHER_TABLE_NAME+" ON "+VOUCHER_TABLE_NAME+".id = tb_voucher_order.voucher_id").
+		Where(VOUCHER_TABLE_NAME+".shop_id = ?", shopId).
+		Order("tb_voucher_order.create_time desc").
+		Offset((current - 1) * utils.MAXPAGESIZE).
+		Limit(utils.MAXPAGESIZE).
+		Find(&orders).Error
+	return orders, err
+}
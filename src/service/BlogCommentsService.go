@@ -0,0 +1,348 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/jinzhu/gorm"
+	"github.com/sirupsen/logrus"
+	"hmdp-Go/src/cache"
+	"hmdp-Go/src/config/mysql"
+	"hmdp-Go/src/dto"
+	"hmdp-Go/src/middleware"
+	"hmdp-Go/src/model"
+	"hmdp-Go/src/utils"
+)
+
+type BlogCommentsService struct {
+}
+
+var BlogCommentsManager *BlogCommentsService
+
+var (
+	ErrCommentNotFound     = errors.New("评论不存在")
+	ErrNoCommentPermission = errors.New("无权删除该评论")
+	ErrInvalidComment      = fmt.Errorf("评论内容不能为空，且不能超过%d字", utils.COMMENT_MAX_LENGTH)
+)
+
+// BlogCommentPage 一页一级评论，Total 为一级评论总数
+type BlogCommentPage struct {
+	List  []model.BlogComments `json:"list"`
+	Total int64                `json:"total"`
+}
+
+// 热门博客的评论第一页缓存，key 为 博客id:排序方式，只缓存数据库中的字段，用户信息在查询时填充
+var commentPageCache = cache.New[string, BlogCommentPage](utils.CACHE_COMMENTS_KEY, func(_ context.Context, key string) (BlogCommentPage, error) {
+	blogIdStr, sortBy, _ := strings.Cut(key, ":")
+	blogId, err := strconv.ParseInt(blogIdStr, 10, 64)
+	if err != nil {
+		return BlogCommentPage{}, err
+	}
+	return loadCommentPage(blogId, sortBy, 1)
+}, cache.WithTTL(5*time.Minute, time.Minute))
+
+// 评论第一页的访问量达到阈值的博客成为热门博客，冷却后删除缓存
+var commentHotKeys = cache.NewHotKeyDetector(cache.HotKeyConfig{
+	Window:        utils.HOT_COMMENTS_WINDOW * time.Second,
+	Buckets:       6,
+	HotThreshold:  utils.HOT_COMMENTS_THRESHOLD,
+	CoolThreshold: utils.HOT_COMMENTS_COOL_THRESHOLD,
+}, nil, func(key string) {
+	blogId, err := strconv.ParseInt(key, 10, 64)
+	if err != nil {
+		return
+	}
+	if err = commentPageCache.Delete(context.Background(), commentPageKeys(blogId)...); err != nil {
+		logrus.Warnf("remove comment cache of blog %d failed: %v", blogId, err)
+	}
+})
+
+// InitCommentHotKeyDetector 启动热门博客评论的探测
+func InitCommentHotKeyDetector() {
+	commentHotKeys.Start(context.Background())
+}
+
+func commentPageKeys(blogId int64) []string {
+	return []string{
+		fmt.Sprintf("%d:%s", blogId, model.COMMENT_SORT_TIME),
+		fmt.Sprintf("%d:%s", blogId, model.COMMENT_SORT_LIKES),
+	}
+}
+
+// commentCacheKeys 评论变化时需要删除的缓存：评论第一页和博客详情(包含评论数)
+func commentCacheKeys(blogId int64) []string {
+	keys := []string{blogCache.Key(blogId)}
+	for _, key := range commentPageKeys(blogId) {
+		keys = append(keys, commentPageCache.Key(key))
+	}
+	return keys
+}
+
+// commentCountDelta 博客的评论数只统计正常状态的评论(包括回复)，评论的状态从 from 改为 to 时评论数的变化
+// 新增评论时 from 为 DELETED，发表、删除、隐藏、禁止和恢复都按这个规则修改评论数
+func commentCountDelta(from, to int) int64 {
+	var delta int64
+	if from == model.NORMAL {
+		delta--
+	}
+	if to == model.NORMAL {
+		delta++
+	}
+	return delta
+}
+
+// SaveComment 发表评论，AnswerId 不为 0 时为回复，回复挂在被回复评论所在的一级评论下
+func (*BlogCommentsService) SaveComment(userId int64, comment *model.BlogComments) (int64, error) {
+	comment.Content = strings.TrimSpace(comment.Content)
+	if comment.Content == "" || utf8.RuneCountInString(comment.Content) > utils.COMMENT_MAX_LENGTH {
+		return 0, ErrInvalidComment
+	}
+	if _, err := getVisibleBlog(comment.BlogId); err != nil {
+		return 0, err
+	}
+	words, err := filterSensitive(utils.SENSITIVE_POLICY_COMMENT, &comment.Content)
+	if err != nil {
+		return 0, err
+	}
+
+	comment.ParentId = 0
+	if comment.AnswerId != 0 {
+		var answered model.BlogComments
+		if err := answered.QueryCommentById(comment.AnswerId); err != nil {
+			return 0, commentNotFound(err)
+		}
+		if answered.BlogId != comment.BlogId || answered.Status != model.NORMAL {
+			return 0, ErrCommentNotFound
+		}
+		comment.ParentId = answered.Id
+		if answered.ParentId != 0 {
+			comment.ParentId = answered.ParentId
+		}
+	}
+	comment.Id = 0
+	comment.UserId = userId
+	comment.Liked = 0
+	comment.Status = model.NORMAL
+	if len(words) > 0 {
+		comment.Status = model.REPORTED
+	}
+	comment.CreateTime = time.Now()
+	comment.UpdateTime = time.Now()
+
+	// 评论和评论数在同一个事务中修改，缓存删除写入发件箱；命中敏感词的评论隐藏并提交审核
+	err = mysql.GetMysqlDB().Transaction(func(tx *gorm.DB) error {
+		if err := comment.SaveComment(tx); err != nil {
+			return err
+		}
+		if len(words) > 0 {
+			if err := flagForReview(tx, model.REPORT_TARGET_COMMENT, comment.Id, words); err != nil {
+				return err
+			}
+		}
+		var blog model.Blog
+		if err := blog.IncrComments(tx, comment.BlogId, commentCountDelta(model.DELETED, comment.Status)); err != nil {
+			return err
+		}
+		return OutboxManager.CacheDelete(tx, commentCacheKeys(comment.BlogId))
+	})
+	if err != nil {
+		return 0, err
+	}
+	OutboxManager.Notify()
+	return comment.Id, nil
+}
+
+// DeleteComment 评论的作者、博客的作者和管理员可以删除评论，删除一级评论时同时删除它的回复
+func (*BlogCommentsService) DeleteComment(operator dto.UserDTO, id int64) error {
+	var comment model.BlogComments
+	if err := comment.QueryCommentById(id); err != nil {
+		return commentNotFound(err)
+	}
+	if operator.Id != comment.UserId && !middleware.HasRole(operator, model.ROLE_ADMIN) {
+		blog, err := blogCache.Get(context.Background(), comment.BlogId)
+		if err != nil && !errors.Is(err, cache.ErrNotFound) {
+			return err
+		}
+		if err != nil || blog.UserId != operator.Id {
+			return ErrNoCommentPermission
+		}
+	}
+
+	err := mysql.GetMysqlDB().Transaction(func(tx *gorm.DB) error {
+		visible, err := comment.DeleteComment(tx, id)
+		if err != nil {
+			return err
+		}
+		var blog model.Blog
+		if err = blog.IncrComments(tx, comment.BlogId, -visible); err != nil {
+			return err
+		}
+		return OutboxManager.CacheDelete(tx, commentCacheKeys(comment.BlogId))
+	})
+	if err != nil {
+		return err
+	}
+	OutboxManager.Notify()
+	return nil
+}
+
+// QueryComments 分页查询博客的一级评论，每条附带最早的几条回复；热门博客的第一页从缓存中读取
+func (*BlogCommentsService) QueryComments(blogId int64, sortBy string, current int) (BlogCommentPage, error) {
+	if sortBy != model.COMMENT_SORT_LIKES {
+		sortBy = model.COMMENT_SORT_TIME
+	}
+	if current < 1 {
+		current = 1
+	}
+	if _, err := getVisibleBlog(blogId); err != nil {
+		return BlogCommentPage{}, err
+	}
+
+	var page BlogCommentPage
+	var err error
+	if current == 1 && commentHotKeys.Record(strconv.FormatInt(blogId, 10)) {
+		page, err = commentPageCache.Get(context.Background(), fmt.Sprintf("%d:%s", blogId, sortBy))
+	} else {
+		page, err = loadCommentPage(blogId, sortBy, current)
+	}
+	if err != nil {
+		return BlogCommentPage{}, err
+	}
+
+	// 缓存中的页面是共享的，填充用户信息前先复制
+	list := make([]model.BlogComments, len(page.List))
+	for i := range page.List {
+		list[i] = page.List[i]
+		list[i].Replies = append([]model.BlogComments(nil), page.List[i].Replies...)
+		fillCommentUsers(list[i].Replies)
+	}
+	fillCommentUsers(list)
+	return BlogCommentPage{List: list, Total: page.Total}, nil
+}
+
+// QueryReplies 按时间顺序分页查询一级评论下的回复
+func (*BlogCommentsService) QueryReplies(parentId int64, current int) (BlogCommentPage, error) {
+	if current < 1 {
+		current = 1
+	}
+	var parent model.BlogComments
+	if err := parent.QueryCommentById(parentId); err != nil {
+		return BlogCommentPage{}, commentNotFound(err)
+	}
+	if parent.ParentId != 0 || parent.Status != model.NORMAL {
+		return BlogCommentPage{}, ErrCommentNotFound
+	}
+	if _, err := getVisibleBlog(parent.BlogId); err != nil {
+		return BlogCommentPage{}, err
+	}
+
+	replies, total, err := parent.QueryReplies(parentId, current, utils.COMMENT_PAGE_SIZE)
+	if err != nil {
+		return BlogCommentPage{}, err
+	}
+	if err = fillReplyTargets([]model.BlogComments{parent}, replies); err != nil {
+		return BlogCommentPage{}, err
+	}
+	fillCommentUsers(replies)
+	return BlogCommentPage{List: replies, Total: total}, nil
+}
+
+// loadCommentPage 从数据库加载一页一级评论和每条评论的前几条回复
+func loadCommentPage(blogId int64, sortBy string, current int) (BlogCommentPage, error) {
+	var commentUtils model.BlogComments
+	comments, total, err := commentUtils.QueryTopComments(blogId, sortBy, current, utils.COMMENT_PAGE_SIZE)
+	if err != nil {
+		return BlogCommentPage{}, err
+	}
+
+	ids := make([]int64, len(comments))
+	for i := range comments {
+		ids[i] = comments[i].Id
+	}
+	counts, err := commentUtils.CountReplies(ids)
+	if err != nil {
+		return BlogCommentPage{}, err
+	}
+	previews, err := commentUtils.QueryReplyPreviews(ids, utils.COMMENT_REPLY_PREVIEW)
+	if err != nil {
+		return BlogCommentPage{}, err
+	}
+	var replies []model.BlogComments
+	for _, id := range ids {
+		replies = append(replies, previews[id]...)
+	}
+	if err = fillReplyTargets(comments, replies); err != nil {
+		return BlogCommentPage{}, err
+	}
+	for i := range comments {
+		comments[i].ReplyCount = counts[comments[i].Id]
+		n := len(previews[comments[i].Id])
+		if n > 0 {
+			comments[i].Replies, replies = replies[:n:n], replies[n:]
+		}
+	}
+	return BlogCommentPage{List: comments, Total: total}, nil
+}
+
+// fillReplyTargets 填充回复的被回复用户：直接回复一级评论时为一级评论的作者，否则为被回复评论的作者
+// 所有回复的被回复评论通过一次查询获取
+func fillReplyTargets(parents []model.BlogComments, replies []model.BlogComments) error {
+	authors := make(map[int64]int64, len(parents))
+	for _, parent := range parents {
+		authors[parent.Id] = parent.UserId
+	}
+	var answerIds []int64
+	for _, reply := range replies {
+		if _, ok := authors[reply.AnswerId]; !ok {
+			answerIds = append(answerIds, reply.AnswerId)
+		}
+	}
+	var commentUtils model.BlogComments
+	answered, err := commentUtils.QueryCommentsByIds(answerIds)
+	if err != nil {
+		return err
+	}
+	for _, comment := range answered {
+		authors[comment.Id] = comment.UserId
+	}
+	for i := range replies {
+		replies[i].ReplyUserId = authors[replies[i].AnswerId]
+	}
+	return nil
+}
+
+// fillCommentUsers 填充评论作者和被回复用户的昵称、头像
+func fillCommentUsers(comments []model.BlogComments) {
+	users := make(map[int64]model.User)
+	getUser := func(id int64) model.User {
+		if user, ok := users[id]; ok {
+			return user
+		}
+		user, err := UserManager.GetUserById(id)
+		if err != nil {
+			logrus.Warnf("fill comment user %d failed: %v", id, err)
+		}
+		users[id] = user
+		return user
+	}
+	for i := range comments {
+		user := getUser(comments[i].UserId)
+		comments[i].Name = user.NickName
+		comments[i].Icon = user.Icon
+		if comments[i].ReplyUserId != 0 {
+			comments[i].ReplyName = getUser(comments[i].ReplyUserId).NickName
+		}
+	}
+}
+
+func commentNotFound(err error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrCommentNotFound
+	}
+	return err
+}
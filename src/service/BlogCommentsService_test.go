@@ -0,0 +1,157 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"hmdp-Go/src/config/mysql"
+	"hmdp-Go/src/dto"
+	"hmdp-Go/src/model"
+	"hmdp-Go/src/utils"
+)
+
+func saveTestComment(t *testing.T, userId, blogId, answerId int64) model.BlogComments {
+	t.Helper()
+	comment := model.BlogComments{BlogId: blogId, AnswerId: answerId, Content: "comment"}
+	if _, err := BlogCommentsManager.SaveComment(userId, &comment); err != nil {
+		t.Fatalf("save comment failed: %v", err)
+	}
+	return comment
+}
+
+func blogComments(t *testing.T, blogId int64) int {
+	t.Helper()
+	var blog model.Blog
+	if err := blog.GetBlogById(blogId); err != nil {
+		t.Fatalf("query blog failed: %v", err)
+	}
+	return blog.Comments
+}
+
+func TestCommentThreading(t *testing.T) {
+	setupTestStores(t)
+	for id := int64(1); id <= 3; id++ {
+		createTestUser(t, id)
+	}
+	blogId := createTestBlog(t, 1)
+
+	top := saveTestComment(t, 2, blogId, 0)
+	first := saveTestComment(t, 3, blogId, top.Id)
+	// 回复楼中的回复，仍然挂在一级评论下
+	second := saveTestComment(t, 1, blogId, first.Id)
+	if first.ParentId != top.Id || second.ParentId != top.Id {
+		t.Fatalf("replies should belong to the top comment, but get %d and %d", first.ParentId, second.ParentId)
+	}
+	for i := 0; i < utils.COMMENT_REPLY_PREVIEW; i++ {
+		saveTestComment(t, 2, blogId, top.Id)
+	}
+	other := saveTestComment(t, 3, blogId, 0)
+
+	page, err := BlogCommentsManager.QueryComments(blogId, model.COMMENT_SORT_TIME, 1)
+	if err != nil {
+		t.Fatalf("query comments failed: %v", err)
+	}
+	if page.Total != 2 || len(page.List) != 2 {
+		t.Fatalf("expected 2 top comments, but get %d %+v", page.Total, page.List)
+	}
+	// 按时间倒序
+	if page.List[0].Id != other.Id || len(page.List[0].Replies) != 0 || page.List[0].ReplyCount != 0 {
+		t.Fatalf("unexpected comment without replies %+v", page.List[0])
+	}
+	thread := page.List[1]
+	if thread.ReplyCount != utils.COMMENT_REPLY_PREVIEW+2 || len(thread.Replies) != utils.COMMENT_REPLY_PREVIEW {
+		t.Fatalf("expected %d replies with %d previews, but get %d %d",
+			utils.COMMENT_REPLY_PREVIEW+2, utils.COMMENT_REPLY_PREVIEW, thread.ReplyCount, len(thread.Replies))
+	}
+	if thread.Name != "user2" {
+		t.Fatalf("expected author user2, but get %q", thread.Name)
+	}
+	if thread.Replies[0].Id != first.Id || thread.Replies[0].ReplyUserId != 2 || thread.Replies[0].ReplyName != "user2" {
+		t.Fatalf("reply to the top comment should target its author, but get %+v", thread.Replies[0])
+	}
+	if thread.Replies[1].Id != second.Id || thread.Replies[1].ReplyUserId != 3 || thread.Replies[1].ReplyName != "user3" {
+		t.Fatalf("reply to a reply should target that reply's author, but get %+v", thread.Replies[1])
+	}
+
+	replies, err := BlogCommentsManager.QueryReplies(top.Id, 1)
+	if err != nil {
+		t.Fatalf("query replies failed: %v", err)
+	}
+	if replies.Total != int64(utils.COMMENT_REPLY_PREVIEW+2) || replies.List[1].ReplyUserId != 3 {
+		t.Fatalf("unexpected replies %d %+v", replies.Total, replies.List)
+	}
+
+	// 回复其他博客的评论
+	otherBlog := createTestBlog(t, 1)
+	comment := model.BlogComments{BlogId: otherBlog, AnswerId: top.Id, Content: "comment"}
+	if _, err = BlogCommentsManager.SaveComment(2, &comment); !errors.Is(err, ErrCommentNotFound) {
+		t.Fatalf("expected ErrCommentNotFound, but get %v", err)
+	}
+}
+
+func TestDeleteCommentKeepsCount(t *testing.T) {
+	setupTestStores(t)
+	for id := int64(1); id <= 3; id++ {
+		createTestUser(t, id)
+	}
+	blogId := createTestBlog(t, 1)
+
+	top := saveTestComment(t, 2, blogId, 0)
+	reply := saveTestComment(t, 3, blogId, top.Id)
+	saveTestComment(t, 2, blogId, reply.Id)
+	other := saveTestComment(t, 3, blogId, 0)
+	// 评论数只统计正常状态的评论，被禁止的回复不计数，删除时也不减少
+	prohibited := model.BlogComments{UserId: 3, BlogId: blogId, ParentId: top.Id, AnswerId: top.Id, Content: "comment", Status: model.PROHIBITED}
+	if err := prohibited.SaveComment(mysql.GetMysqlDB()); err != nil {
+		t.Fatal(err)
+	}
+	if count := blogComments(t, blogId); count != 4 {
+		t.Fatalf("expected 4 comments, but get %d", count)
+	}
+
+	// 只有评论的作者、博客的作者和管理员可以删除
+	if err := BlogCommentsManager.DeleteComment(dto.UserDTO{Id: 3}, top.Id); !errors.Is(err, ErrNoCommentPermission) {
+		t.Fatalf("expected ErrNoCommentPermission, but get %v", err)
+	}
+
+	// 删除一级评论时连同回复一起删除
+	if err := BlogCommentsManager.DeleteComment(dto.UserDTO{Id: 1}, top.Id); err != nil {
+		t.Fatalf("delete comment failed: %v", err)
+	}
+	if count := blogComments(t, blogId); count != 1 {
+		t.Fatalf("expected 1 comment after deleting the thread, but get %d", count)
+	}
+	if err := BlogCommentsManager.DeleteComment(dto.UserDTO{Id: 3}, other.Id); err != nil {
+		t.Fatalf("delete comment failed: %v", err)
+	}
+	if count := blogComments(t, blogId); count != 0 {
+		t.Fatalf("expected 0 comments, but get %d", count)
+	}
+	if err := BlogCommentsManager.DeleteComment(dto.UserDTO{Id: 3}, other.Id); !errors.Is(err, ErrCommentNotFound) {
+		t.Fatalf("expected ErrCommentNotFound, but get %v", err)
+	}
+
+	page, err := BlogCommentsManager.QueryComments(blogId, model.COMMENT_SORT_TIME, 1)
+	if err != nil || page.Total != 0 || len(page.List) != 0 {
+		t.Fatalf("expected no comments, but get %+v %v", page, err)
+	}
+}
+
+func TestIncrCommentsNotNegative(t *testing.T) {
+	setupTestStores(t)
+	blogId := createTestBlog(t, 1)
+	db := mysql.GetMysqlDB()
+	if err := db.Exec("UPDATE tb_blog SET comments = NULL WHERE id = ?", blogId).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	var blog model.Blog
+	for _, step := range []struct{ n, expected int64 }{{2, 2}, {-1, 1}, {-5, 0}, {1, 1}} {
+		if err := blog.IncrComments(db, blogId, step.n); err != nil {
+			t.Fatalf("incr comments by %d failed: %v", step.n, err)
+		}
+		if count := blogComments(t, blogId); int64(count) != step.expected {
+			t.Fatalf("expected %d comments after adding %d, but get %d", step.expected, step.n, count)
+		}
+	}
+}
@@ -4,13 +4,19 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"github.com/jinzhu/gorm"
 	redisConfig "github.com/redis/go-redis/v9"
 	"github.com/sirupsen/logrus"
+	"hmdp-Go/src/cache"
+	"hmdp-Go/src/config/mysql"
 	"hmdp-Go/src/config/redis"
 	"hmdp-Go/src/dto"
 	"hmdp-Go/src/model"
 	"hmdp-Go/src/utils"
+	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 )
@@ -20,40 +26,181 @@ type BlogService struct {
 
 var BlogManager *BlogService
 
+var (
+	ErrNoBlogPermission = errors.New("只有作者可以修改或删除博客")
+	ErrBlogNotDeleted   = errors.New("博客不存在或没有被删除")
+)
+
+// 博客详情缓存，只缓存数据库中的字段，作者信息在查询时填充
+var blogCache = cache.New[int64, model.Blog](utils.CACHE_BLOG_KEY, func(_ context.Context, id int64) (model.Blog, error) {
+	var blog model.Blog
+	err := blog.GetBlogById(id)
+	return blog, notFound(err)
+}, cache.WithTTL(30*time.Minute, 5*time.Minute), cache.WithNullTTL(2*time.Minute), cache.WithLocalCache(5000, 30*time.Second),
+	cache.WithGuard(blogBloom.guard))
+
+// SaveBlog 发布博客，推送到粉丝收件箱的事件与博客在同一个事务中写入，由后台异步推送
 func (*BlogService) SaveBlog(userId int64, blog *model.Blog) (res int64, err error) {
+	// 命中敏感词的博客先隐藏，审核通过后才对外可见
+	words, err := filterSensitive(utils.SENSITIVE_POLICY_BLOG, &blog.Title, &blog.Content)
+	if err != nil {
+		return
+	}
+	blog.Id = 0
+	blog.UserId = userId
+	blog.Status = model.NORMAL
+	if len(words) > 0 {
+		blog.Status = model.REPORTED
+	}
 	blog.CreateTime = time.Now()
 	blog.UpdateTime = time.Now()
 
-	id, err := blog.SaveBlog()
+	err = mysql.GetMysqlDB().Transaction(func(tx *gorm.DB) error {
+		if _, err := blog.SaveBlog(tx); err != nil {
+			return err
+		}
+		if len(words) > 0 {
+			if err := flagForReview(tx, model.REPORT_TARGET_BLOG, blog.Id, words); err != nil {
+				return err
+			}
+		}
+		if err := OutboxManager.BloomAdd(tx, blogBloom, blog.Id); err != nil {
+			return err
+		}
+		return publishFeedEvent(tx, feedActionPush, blog)
+	})
 	if err != nil {
 		logrus.Error("[Blog Service] failed to insert data!")
 		return
 	}
-	var f model.Follow
-	follows, err := f.GetFollowsByFollowId(userId)
+	blogBloom.add(blog.Id)
+	OutboxManager.Notify()
+
+	res = blog.Id
+	return
+}
+
+// UpdateBlog 作者修改博客，修改后的内容重新检查敏感词，编辑时移除的图片在事务提交后清理
+func (*BlogService) UpdateBlog(operator dto.UserDTO, blog *model.Blog) error {
+	var old model.Blog
+	if err := old.GetBlogById(blog.Id); err != nil {
+		return err
+	}
+	if old.Status != model.NORMAL && old.Status != model.REPORTED {
+		return gorm.ErrRecordNotFound
+	}
+	if old.UserId != operator.Id {
+		return ErrNoBlogPermission
+	}
+
+	words, err := filterSensitive(utils.SENSITIVE_POLICY_BLOG, &blog.Title, &blog.Content)
 	if err != nil {
-		return
+		return err
+	}
+	if blog.ShopId == 0 {
+		blog.ShopId = old.ShopId
 	}
+	blog.UpdateTime = time.Now()
 
-	if follows == nil || len(follows) == 0 {
-		return
+	inUse := make(map[string]bool)
+	for _, image := range blog.ImageList() {
+		inUse[image] = true
+	}
+	var removed []string
+	for _, image := range old.ImageList() {
+		if !inUse[image] {
+			removed = append(removed, image)
+		}
 	}
 
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
+	err = mysql.GetMysqlDB().Transaction(func(tx *gorm.DB) error {
+		updated, err := blog.UpdateBlog(tx, len(words) > 0)
+		if err != nil {
+			return err
+		}
+		if !updated {
+			return gorm.ErrRecordNotFound
+		}
+		if len(words) > 0 {
+			if err = flagForReview(tx, model.REPORT_TARGET_BLOG, blog.Id, words); err != nil {
+				return err
+			}
+		}
+		if err = OutboxManager.ImageDelete(tx, blog.Id, removed, 0); err != nil {
+			return err
+		}
+		return OutboxManager.CacheDelete(tx, []string{blogCache.Key(blog.Id)})
+	})
+	if err != nil {
+		return err
+	}
+	OutboxManager.Notify()
+	return nil
+}
 
-	for _, value := range follows {
-		followUserId := value.UserId
+// DeleteBlog 作者删除博客(软删除)：点赞记录随缓存一起删除，点赞数同时清零，评论保留但不可见，
+// 图片在 BLOG_IMAGE_CLEANUP_DELAY 之后清理，并异步从粉丝的收件箱中移除
+func (*BlogService) DeleteBlog(operator dto.UserDTO, id int64) error {
+	var blog model.Blog
+	if err := blog.GetBlogById(id); err != nil {
+		return err
+	}
+	if blog.UserId != operator.Id {
+		return ErrNoBlogPermission
+	}
 
-		redisKey := utils.FEED_KEY + strconv.FormatInt(followUserId, 10)
-		redis.GetRedisClient().ZAdd(ctx, redisKey, redisConfig.Z{
-			Member: blog.Id,
-			Score:  float64(time.Now().Unix()),
-		})
+	idStr := strconv.FormatInt(id, 10)
+	keys := append(commentCacheKeys(id), utils.BLOG_LIKE_KEY+idStr)
+	err := mysql.GetMysqlDB().Transaction(func(tx *gorm.DB) error {
+		deleted, err := blog.UpdateBlogStatus(tx, id, model.DELETED, model.NORMAL, model.REPORTED)
+		if err != nil {
+			return err
+		}
+		if !deleted {
+			return gorm.ErrRecordNotFound
+		}
+		if err = blog.ClearLiked(tx, id); err != nil {
+			return err
+		}
+		if err = OutboxManager.ImageDelete(tx, id, blog.ImageList(), utils.BLOG_IMAGE_CLEANUP_DELAY*time.Second); err != nil {
+			return err
+		}
+		if err = publishFeedEvent(tx, feedActionRemove, &blog); err != nil {
+			return err
+		}
+		return OutboxManager.CacheDelete(tx, keys)
+	})
+	if err != nil {
+		return err
 	}
+	OutboxManager.Notify()
+	return nil
+}
 
-	res = id
-	return
+// RestoreBlog 管理员恢复被删除的博客，并重新推送到粉丝的收件箱
+func (*BlogService) RestoreBlog(id int64) error {
+	var blog model.Blog
+	if err := blog.GetBlogById(id); err != nil {
+		return err
+	}
+	err := mysql.GetMysqlDB().Transaction(func(tx *gorm.DB) error {
+		restored, err := blog.UpdateBlogStatus(tx, id, model.NORMAL, model.DELETED)
+		if err != nil {
+			return err
+		}
+		if !restored {
+			return ErrBlogNotDeleted
+		}
+		if err = publishFeedEvent(tx, feedActionPush, &blog); err != nil {
+			return err
+		}
+		return OutboxManager.CacheDelete(tx, commentCacheKeys(id))
+	})
+	if err != nil {
+		return err
+	}
+	OutboxManager.Notify()
+	return nil
 }
 
 func (*BlogService) LikeBlog(id int64, userId int64) (err error) {
@@ -61,6 +208,10 @@ func (*BlogService) LikeBlog(id int64, userId int64) (err error) {
 	// blog.Id = id
 	// err = blog.IncreseLike()
 	// return
+	// 只能给对外可见的博客点赞，否则已删除的博客会留下新的点赞记录
+	if _, err = getVisibleBlog(id); err != nil {
+		return err
+	}
 	userStr := strconv.FormatInt(userId, 10)
 	redisKey := utils.BLOG_LIKE_KEY + strconv.FormatInt(id, 10)
 
@@ -81,6 +232,9 @@ func (*BlogService) LikeBlog(id int64, userId int64) (err error) {
 	var blog model.Blog
 	blog.Id = id
 
+	// 点赞数变化后删除博客缓存
+	defer blogCache.Delete(ctx, id)
+
 	if flag {
 		// add like
 		blog.IncrLike()
@@ -125,9 +279,23 @@ func (*BlogService) QueryHotBlogs(current int) ([]model.Blog, error) {
 	return blogs, nil
 }
 
+// getVisibleBlog 被隐藏或者禁止的博客视为不存在
+func getVisibleBlog(id int64) (model.Blog, error) {
+	blog, err := blogCache.Get(context.Background(), id)
+	if errors.Is(err, cache.ErrNotFound) {
+		return model.Blog{}, gorm.ErrRecordNotFound
+	}
+	if err != nil {
+		return model.Blog{}, err
+	}
+	if blog.Status != model.NORMAL {
+		return model.Blog{}, gorm.ErrRecordNotFound
+	}
+	return blog, nil
+}
+
 func (*BlogService) GetBlogById(id int64) (model.Blog, error) {
-	var blog model.Blog
-	err := blog.GetBlogById(id)
+	blog, err := getVisibleBlog(id)
 	if err != nil {
 		return model.Blog{}, err
 	}
@@ -185,50 +353,52 @@ func (*BlogService) QueryUserLike(id int64) ([]dto.UserDTO, error) {
 	return userDTOS, nil
 }
 
+// QueryBlogOfFollow 滚动分页查询关注的人发布的博客：合并收件箱和关注的拉模式作者的发件箱，
+// maxTime 为上一页的最小时间戳，offset 为上一页中时间戳等于 maxTime 的博客数
 func (*BlogService) QueryBlogOfFollow(maxTime int64, offset int, userId int64, pageSize int) (dto.ScrollResult[model.Blog], error) {
-	redisKey := utils.FEED_KEY + strconv.FormatInt(userId, 10)
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	// 1. 从 Redis 获取博客 ID
-	result, err := redis.GetRedisClient().ZRevRangeByScoreWithScores(ctx, redisKey,
-		&redisConfig.ZRangeBy{
-			Min:    "0",
-			Max:    strconv.FormatInt(maxTime, 10),
-			Offset: int64(offset),
-			Count:  int64(pageSize),
-		}).Result()
-	if err != nil || len(result) == 0 {
+	// 1. 确定需要读取的收件箱和发件箱
+	keys, err := feedSources(ctx, userId)
+	if err != nil {
 		return dto.ScrollResult[model.Blog]{}, err
 	}
 
-	// 2. 提取 ID 并计算 minTime/offset
-	var (
-		ids     []int64
-		minTime = int64(0)
-		os      = 0 // the number of equal number
-	)
-	for _, value := range result {
-		id := value.Member.(int64)
-		ids = append(ids, id)
+	// 2. 合并读取博客 ID 并查询详情，被隐藏、禁止或删除的博客不返回，继续读取直到凑满一页或者没有更多的博客
+	// 游标按 Redis 中读到的最后一篇计算，包括被跳过的博客
+	var blogs []model.Blog
+	minTime, nextOffset := maxTime, offset
+	for len(blogs) < pageSize {
+		want := pageSize - len(blogs)
+		ids, pageMinTime, pageOffset, err := readFeed(ctx, keys, minTime, nextOffset, want)
+		if err != nil {
+			return dto.ScrollResult[model.Blog]{}, err
+		}
+		if len(ids) == 0 {
+			break
+		}
+		minTime, nextOffset = pageMinTime, pageOffset
 
-		score := int64(value.Score)
-		if score == minTime {
-			os++
-		} else {
-			minTime = score
-			os = 1
+		var blogUtils model.Blog
+		page, err := blogUtils.QueryBlogByIds(ids)
+		if err != nil {
+			return dto.ScrollResult[model.Blog]{}, err
+		}
+		for _, blog := range page {
+			if blog.Status == model.NORMAL {
+				blogs = append(blogs, blog)
+			}
+		}
+		if len(ids) < want {
+			break
 		}
 	}
-
-	// 3. 批量查询博客详情
-	var blogUtils model.Blog
-	blogs, err := blogUtils.QueryBlogByIds(ids)
-	if err != nil {
-		return dto.ScrollResult[model.Blog]{}, err
+	if len(blogs) == 0 {
+		return dto.ScrollResult[model.Blog]{}, nil
 	}
 
-	// 4. 并发填充用户信息和点赞状态
+	// 3. 并发填充用户信息和点赞状态
 	var wg sync.WaitGroup
 	for i := range blogs {
 		wg.Add(2)
@@ -246,18 +416,16 @@ func (*BlogService) QueryBlogOfFollow(maxTime int64, offset int, userId int64, p
 	}
 	wg.Wait()
 
-	// 5. 返回结果
+	// 4. 返回结果
 	return dto.ScrollResult[model.Blog]{
 		Data:    blogs,
 		MinTime: minTime,
-		Offset:  os,
+		Offset:  nextOffset,
 	}, nil
 }
 
 func createBlogUser(blog *model.Blog) error {
-	userId := blog.UserId
-	var userUtils model.User
-	user, err := userUtils.GetUserById(userId)
+	user, err := UserManager.GetUserById(blog.UserId)
 
 	if err != nil {
 		return fmt.Errorf("failed to get user %d: %v", blog.UserId, err)
@@ -277,3 +445,34 @@ func isBlogLiked(userId int64, blog *model.Blog) {
 	err := redis.GetRedisClient().ZScore(ctx, redisKey, strconv.FormatInt(userId, 10)).Err()
 	blog.IsLike = !errors.Is(err, redisConfig.Nil) // 存在即表示已点赞
 }
+
+// cleanBlogImages 删除博客不再引用的图片：博客已删除时删除全部，否则跳过仍在使用的图片，
+// 因此博客在清理之前被恢复时图片会被保留，重复执行也没有影响
+func cleanBlogImages(blogId int64, images []string) error {
+	var blog model.Blog
+	err := blog.GetBlogById(blogId)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+	inUse := make(map[string]bool)
+	if err == nil && blog.Status != model.DELETED {
+		for _, image := range blog.ImageList() {
+			inUse[image] = true
+		}
+	}
+	for _, image := range images {
+		if inUse[image] {
+			continue
+		}
+		// 只能删除上传目录中的博客图片
+		name := filepath.Clean("/" + image)
+		if !strings.HasPrefix(name, "/blogs/") {
+			logrus.Warnf("skip cleaning image %s of blog %d", image, blogId)
+			continue
+		}
+		if err = os.Remove(utils.UPLOADPATH + name); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"hmdp-Go/src/config/mysql"
+	"hmdp-Go/src/dto"
+	"hmdp-Go/src/model"
+	"hmdp-Go/src/utils"
+)
+
+func useSensitiveWords(t *testing.T, words ...string) {
+	t.Helper()
+	utils.SensitiveWords.Reset(words)
+	t.Cleanup(func() { utils.SensitiveWords.Reset(nil) })
+}
+
+func countRows(t *testing.T, table string) int {
+	t.Helper()
+	var count int
+	if err := mysql.GetMysqlDB().Table(table).Count(&count).Error; err != nil {
+		t.Fatalf("count %s failed: %v", table, err)
+	}
+	return count
+}
+
+func TestSaveBlogFlagsForReview(t *testing.T) {
+	setupTestStores(t)
+	useSensitiveWords(t, "违禁词")
+
+	blog := model.Blog{Title: "包含违禁词的标题", Content: "content"}
+	id, err := BlogManager.SaveBlog(1, &blog)
+	if err != nil {
+		t.Fatalf("save blog failed: %v", err)
+	}
+	var saved model.Blog
+	if err = saved.GetBlogById(id); err != nil || saved.Status != model.REPORTED {
+		t.Fatalf("blog with sensitive words should be hidden, but get %+v %v", saved, err)
+	}
+	reports, err := ReportManager.QueryReports(model.REPORT_PENDING, 1)
+	if err != nil || len(reports) != 1 || reports[0].TargetId != id || reports[0].UserId != 0 {
+		t.Fatalf("expected a pending report of blog %d, but get %+v %v", id, reports, err)
+	}
+
+	// 提交审核失败时博客也不会保存，不会出现隐藏后没人审核的博客
+	mysql.GetMysqlDB().DropTable(model.REPORT_TABLE_NAME)
+	blogs := countRows(t, model.BLOG_TABLE_NAME)
+	blog = model.Blog{Title: "包含违禁词的标题", Content: "content"}
+	if _, err = BlogManager.SaveBlog(1, &blog); err == nil {
+		t.Fatal("save blog should fail when flagging fails")
+	}
+	if count := countRows(t, model.BLOG_TABLE_NAME); count != blogs {
+		t.Fatalf("blog should be rolled back, expected %d blogs but get %d", blogs, count)
+	}
+}
+
+func TestUpdateBlogFlagsForReview(t *testing.T) {
+	setupTestStores(t)
+	useSensitiveWords(t, "违禁词")
+	blogId := createTestBlog(t, 1)
+
+	// 隐藏等待审核期间再次修改，沿用原来的举报
+	for i := 0; i < 2; i++ {
+		update := model.Blog{Id: blogId, Title: "title", Content: "包含违禁词的内容"}
+		if err := BlogManager.UpdateBlog(dto.UserDTO{Id: 1}, &update); err != nil {
+			t.Fatalf("update blog failed: %v", err)
+		}
+	}
+	reports, err := ReportManager.QueryReports(model.REPORT_PENDING, 1)
+	if err != nil || len(reports) != 1 || reports[0].TargetId != blogId {
+		t.Fatalf("expected one pending report of blog %d, but get %+v %v", blogId, reports, err)
+	}
+	blogId = createTestBlog(t, 1)
+
+	// 提交审核失败时修改一起回滚
+	mysql.GetMysqlDB().DropTable(model.REPORT_TABLE_NAME)
+	update := model.Blog{Id: blogId, Title: "title", Content: "包含违禁词的内容"}
+	if err := BlogManager.UpdateBlog(dto.UserDTO{Id: 1}, &update); err == nil {
+		t.Fatal("update blog should fail when flagging fails")
+	}
+	var blog model.Blog
+	if err := blog.GetBlogById(blogId); err != nil || blog.Status != model.NORMAL || blog.Content != "content" {
+		t.Fatalf("blog should be unchanged, but get %+v %v", blog, err)
+	}
+}
+
+func TestUpdateBlogKeepsStatus(t *testing.T) {
+	setupTestStores(t)
+	blogId := createTestBlog(t, 1)
+
+	// 修改期间博客被举报自动隐藏，修改不能把它恢复为正常状态
+	var blog model.Blog
+	if _, err := blog.UpdateBlogStatus(mysql.GetMysqlDB(), blogId, model.REPORTED, model.NORMAL); err != nil {
+		t.Fatal(err)
+	}
+	update := model.Blog{Id: blogId, Title: "title", Content: "new content", Status: model.NORMAL, UpdateTime: time.Now()}
+	if updated, err := update.UpdateBlog(mysql.GetMysqlDB(), false); err != nil || !updated {
+		t.Fatalf("update blog failed: %v %v", updated, err)
+	}
+	if err := blog.GetBlogById(blogId); err != nil || blog.Status != model.REPORTED || blog.Content != "new content" {
+		t.Fatalf("blog should stay hidden with the new content, but get %+v %v", blog, err)
+	}
+}
+
+func TestLikeDeletedBlog(t *testing.T) {
+	setupTestStores(t)
+	blogId := createTestBlog(t, 1)
+	for userId := int64(2); userId <= 4; userId++ {
+		if err := BlogManager.LikeBlog(blogId, userId); err != nil {
+			t.Fatalf("like blog failed: %v", err)
+		}
+	}
+
+	// 删除时点赞数和点赞记录一起清除，删除后不能再点赞
+	if err := BlogManager.DeleteBlog(dto.UserDTO{Id: 1}, blogId); err != nil {
+		t.Fatalf("delete blog failed: %v", err)
+	}
+	var blog model.Blog
+	if err := blog.GetBlogById(blogId); err != nil || blog.Liked != 0 {
+		t.Fatalf("liked should be reset on delete, but get %+v %v", blog, err)
+	}
+	if err := BlogManager.LikeBlog(blogId, 5); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Fatalf("expected ErrRecordNotFound, but get %v", err)
+	}
+	if err := BlogManager.LikeBlog(blogId+1, 5); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Fatalf("expected ErrRecordNotFound for missing blog, but get %v", err)
+	}
+}
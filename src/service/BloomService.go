@@ -0,0 +1,329 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	redisClient "hmdp-Go/src/config/redis"
+	"hmdp-Go/src/model"
+	"hmdp-Go/src/utils"
+)
+
+// idBloom 业务id的布隆过滤器，用于拦截一定不存在的id，避免缓存穿透
+// 布隆过滤器不支持删除，通过定时重建清除已删除的id；新增的id通过发件箱写入Redis(redis 模式)
+// 或通过 BLOOM_ADD_CHANNEL 广播给所有实例(memory 模式)，失败时重试
+type idBloom struct {
+	name    string
+	loadIds func(afterId int64) ([]int64, error)
+	filter  atomic.Value // utils.Bloom
+
+	mutex      sync.Mutex
+	rebuilding bool
+	pending    []int64 // 重建期间新增的id，重建完成后补充到新的过滤器中
+}
+
+var (
+	shopBloom = newIdBloom("shop", func(afterId int64) ([]int64, error) {
+		return new(model.Shop).QueryShopIdsAfter(afterId)
+	})
+	blogBloom = newIdBloom("blog", func(afterId int64) ([]int64, error) {
+		return new(model.Blog).QueryBlogIdsAfter(afterId)
+	})
+	userBloom = newIdBloom("user", func(afterId int64) ([]int64, error) {
+		return new(model.User).QueryUserIdsAfter(afterId)
+	})
+)
+
+var idBlooms = []*idBloom{shopBloom, blogBloom, userBloom}
+
+var initBloomOnce sync.Once
+
+// errBloomRebuildSkipped redis 模式下其他实例正在重建同一个过滤器
+var errBloomRebuildSkipped = errors.New("bloom filter is being rebuilt by another instance")
+
+func newIdBloom(name string, loadIds func(afterId int64) ([]int64, error)) *idBloom {
+	return &idBloom{name: name, loadIds: loadIds}
+}
+
+// InitBloomFilters 加载店铺、博客和用户的布隆过滤器，并定时重建
+// memory 模式下优先从快照恢复，随后在后台用数据库的全量数据重建
+func InitBloomFilters() {
+	initBloomOnce.Do(func() {
+		if utils.BLOOM_MODE != "redis" {
+			// 先订阅再加载，加载期间其他实例新增的id不会丢失
+			listenBloomAdds(context.Background())
+		}
+		blooms := idBlooms
+		for _, bloom := range blooms {
+			if utils.BLOOM_MODE == "redis" {
+				// 所有实例共享Redis中的位数组，其他实例已经构建过时不需要重建
+				filter := bloom.newRedisFilter()
+				if exists, err := filter.Exists(context.Background()); err == nil && exists {
+					bloom.filter.Store(filter)
+					continue
+				}
+				bloom.rebuildAndLog()
+				continue
+			}
+			if err := bloom.loadSnapshot(); err == nil {
+				go bloom.rebuildAndLog()
+				continue
+			} else if !os.IsNotExist(err) {
+				logrus.Warnf("load %s bloom snapshot failed: %v", bloom.name, err)
+			}
+			bloom.rebuildAndLog()
+		}
+		go func() {
+			ticker := time.NewTicker(utils.BLOOM_REBUILD_INTERVAL * time.Second)
+			defer ticker.Stop()
+			for range ticker.C {
+				for _, bloom := range blooms {
+					bloom.rebuildAndLog()
+				}
+			}
+		}()
+	})
+}
+
+func (b *idBloom) rebuildAndLog() {
+	if err := b.rebuild(); errors.Is(err, errBloomRebuildSkipped) {
+		// 共享的位数组已经存在时直接使用，不存在时暂时不过滤，等待下一次重建
+		filter := b.newRedisFilter()
+		if exists, _ := filter.Exists(context.Background()); exists {
+			b.filter.Store(utils.Bloom(filter))
+		}
+	} else if err != nil {
+		logrus.Warnf("rebuild %s bloom filter failed: %v", b.name, err)
+	}
+}
+
+// rebuild 构建新的过滤器后整体替换，重建期间查询仍然使用旧的过滤器
+func (b *idBloom) rebuild() error {
+	b.mutex.Lock()
+	b.rebuilding = true
+	b.pending = nil
+	b.mutex.Unlock()
+
+	filter, count, err := b.build()
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	pending := b.pending
+	b.rebuilding = false
+	b.pending = nil
+	if err != nil {
+		return err
+	}
+	for _, id := range pending {
+		filter.Add(bloomKey(id))
+	}
+	b.filter.Store(filter)
+
+	if memFilter, ok := filter.(*utils.BloomFilter); ok {
+		if err = b.saveSnapshot(memFilter); err != nil {
+			logrus.Warnf("save %s bloom snapshot failed: %v", b.name, err)
+		}
+	}
+	logrus.Infof("%s bloom filter rebuilt with %d ids", b.name, count)
+	return nil
+}
+
+// build 用数据库中的全量id构建过滤器，构建完成后补充构建期间新增的id(大于快照中最大的id)
+func (b *idBloom) build() (utils.Bloom, int, error) {
+	if utils.BLOOM_MODE == "redis" {
+		return b.buildRedis()
+	}
+
+	ids, err := b.loadIds(0)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// 预留一倍的容量给新增的数据
+	n := uint64(len(ids)) * 2
+	if n < utils.BLOOM_MIN_CAPACITY {
+		n = utils.BLOOM_MIN_CAPACITY
+	}
+	filter := utils.NewBloomFilter(n, utils.BLOOM_FALSE_POSITIVE_RATE)
+	for _, id := range ids {
+		filter.Add(bloomKey(id))
+	}
+	added, err := b.addIdsAfter(filter, maxId(ids))
+	return filter, len(ids) + added, err
+}
+
+// buildRedis 所有实例共享同一个key，通过分布式锁选出一个实例重建，其余实例跳过
+// 重建通过临时key + RENAME原子替换，RENAME会覆盖其他实例在重建期间写入旧key的id，所以替换后要重新补充
+func (b *idBloom) buildRedis() (utils.Bloom, int, error) {
+	ctx := context.Background()
+	lockKey := utils.BLOOM_REBUILD_LOCK_KEY + b.name
+	lock := utils.NewLocker()
+	acquired, token, err := lock.LockWithWatchDog(ctx, lockKey, 30*time.Second)
+	if err != nil {
+		return nil, 0, err
+	}
+	if !acquired {
+		return nil, 0, errBloomRebuildSkipped
+	}
+	defer lock.UnlockWithWatchDog(ctx, lockKey, token)
+
+	ids, err := b.loadIds(0)
+	if err != nil {
+		return nil, 0, err
+	}
+	filter := b.newRedisFilter()
+	items := make([][]byte, len(ids))
+	for i, id := range ids {
+		items[i] = bloomKey(id)
+	}
+	if err = filter.Rebuild(ctx, items...); err != nil {
+		return nil, 0, err
+	}
+	added, err := b.addIdsAfter(filter, maxId(ids))
+	return filter, len(ids) + added, err
+}
+
+// addIdsAfter 把id大于 snapshotMax 的数据补充到过滤器中
+func (b *idBloom) addIdsAfter(filter utils.Bloom, snapshotMax int64) (int, error) {
+	ids, err := b.loadIds(snapshotMax)
+	if err != nil {
+		return 0, err
+	}
+	for _, id := range ids {
+		filter.Add(bloomKey(id))
+	}
+	return len(ids), nil
+}
+
+func maxId(ids []int64) int64 {
+	var m int64
+	for _, id := range ids {
+		m = max(m, id)
+	}
+	return m
+}
+
+func (b *idBloom) newRedisFilter() *utils.RedisBloomFilter {
+	return utils.NewRedisBloomFilter(redisClient.GetRedisClient(), utils.BLOOM_KEY+b.name,
+		utils.BLOOM_REDIS_CAPACITY, utils.BLOOM_FALSE_POSITIVE_RATE)
+}
+
+func (b *idBloom) snapshotPath() string {
+	return filepath.Join(utils.BLOOM_SNAPSHOT_DIR, b.name+".bloom")
+}
+
+// loadSnapshot 从快照恢复过滤器，快照可能落后于数据库，需要随后重建
+func (b *idBloom) loadSnapshot() error {
+	data, err := os.ReadFile(b.snapshotPath())
+	if err != nil {
+		return err
+	}
+	filter := new(utils.BloomFilter)
+	if err = filter.UnmarshalBinary(data); err != nil {
+		return err
+	}
+	b.filter.Store(utils.Bloom(filter))
+	logrus.Infof("%s bloom filter restored from snapshot", b.name)
+	return nil
+}
+
+// saveSnapshot 先写临时文件再重命名，避免进程中途退出留下不完整的快照
+func (b *idBloom) saveSnapshot(filter *utils.BloomFilter) error {
+	data, err := filter.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(utils.BLOOM_SNAPSHOT_DIR, 0o755); err != nil {
+		return err
+	}
+	tmpPath := b.snapshotPath() + ".tmp"
+	if err = os.WriteFile(tmpPath, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, b.snapshotPath())
+}
+
+// add 新增数据的事务提交后立即加入本实例的过滤器，否则会被误判为不存在
+// redis 模式下写入失败只记录日志，由事务中登记的 OutboxManager.BloomAdd 重试
+func (b *idBloom) add(id int64) {
+	b.addLocal(id)
+}
+
+// syncBloomAdd 由发件箱投递：redis 模式下写入共享的位数组，memory 模式下通知所有实例，返回错误时重试
+func syncBloomAdd(ctx context.Context, name string, id int64) error {
+	for _, bloom := range idBlooms {
+		if bloom.name != name {
+			continue
+		}
+		if utils.BLOOM_MODE == "redis" {
+			return bloom.newRedisFilter().AddAll(ctx, bloomKey(id))
+		}
+		message := name + ":" + strconv.FormatInt(id, 10)
+		return redisClient.GetRedisClient().Publish(ctx, utils.BLOOM_ADD_CHANNEL, message).Err()
+	}
+	return fmt.Errorf("unknown bloom filter %s", name)
+}
+
+func (b *idBloom) addLocal(id int64) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.rebuilding {
+		b.pending = append(b.pending, id)
+	}
+	if filter := b.load(); filter != nil {
+		filter.Add(bloomKey(id))
+	}
+}
+
+// listenBloomAdds 订阅其他实例新增的id，消息格式为 name:id，自己发出的消息重复添加没有影响
+func listenBloomAdds(ctx context.Context) {
+	pubsub := redisClient.GetRedisClient().Subscribe(ctx, utils.BLOOM_ADD_CHANNEL)
+	if _, err := pubsub.Receive(ctx); err != nil {
+		logrus.Warnf("subscribe %s failed: %v", utils.BLOOM_ADD_CHANNEL, err)
+	}
+	go func() {
+		defer pubsub.Close()
+		for msg := range pubsub.Channel() {
+			name, idStr, _ := strings.Cut(msg.Payload, ":")
+			id, err := strconv.ParseInt(idStr, 10, 64)
+			if err != nil {
+				continue
+			}
+			for _, bloom := range idBlooms {
+				if bloom.name == name {
+					bloom.addLocal(id)
+				}
+			}
+		}
+	}()
+}
+
+// mayExist 返回 false 表示id一定不存在，过滤器还没有加载时放行所有请求
+func (b *idBloom) mayExist(id int64) bool {
+	filter := b.load()
+	return filter == nil || filter.Contains(bloomKey(id))
+}
+
+// guard 作为缓存客户端的前置过滤器使用
+func (b *idBloom) guard(key string) bool {
+	filter := b.load()
+	return filter == nil || filter.Contains([]byte(key))
+}
+
+func (b *idBloom) load() utils.Bloom {
+	filter, _ := b.filter.Load().(utils.Bloom)
+	return filter
+}
+
+func bloomKey(id int64) []byte {
+	return []byte(strconv.FormatInt(id, 10))
+}
@@ -0,0 +1,64 @@
+package service
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	redisClient "hmdp-Go/src/config/redis"
+	"hmdp-Go/src/model"
+	"hmdp-Go/src/utils"
+)
+
+func TestBloomAddRetried(t *testing.T) {
+	mr := setupTestStores(t)
+	blog := model.Blog{Title: "title", Content: "content"}
+	id, err := BlogManager.SaveBlog(1, &blog)
+	if err != nil {
+		t.Fatalf("save blog failed: %v", err)
+	}
+	var outbox model.Outbox
+	events, err := outbox.QueryDueOutbox(time.Now(), 10)
+	var event model.Outbox
+	for _, e := range events {
+		if e.EventType == model.OUTBOX_BLOOM_ADD {
+			event = e
+		}
+	}
+	if err != nil || event.Id == 0 {
+		t.Fatalf("expected a bloom add event, but get %+v %v", events, err)
+	}
+
+	// 通知其他实例失败时保留事件，等待重试
+	mr.Close()
+	if err = deliverOutbox(context.Background(), event); err != nil {
+		t.Fatalf("deliver outbox failed: %v", err)
+	}
+	events, err = outbox.QueryDueOutbox(time.Now().Add(time.Minute), 10)
+	event = model.Outbox{}
+	for _, e := range events {
+		if e.EventType == model.OUTBOX_BLOOM_ADD {
+			event = e
+		}
+	}
+	if err != nil || event.Attempts != 1 {
+		t.Fatalf("failed bloom add should be retried, but get %+v %v", events, err)
+	}
+
+	if err = mr.Restart(); err != nil {
+		t.Fatal(err)
+	}
+	pubsub := redisClient.GetRedisClient().Subscribe(context.Background(), utils.BLOOM_ADD_CHANNEL)
+	defer pubsub.Close()
+	if _, err = pubsub.Receive(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err = deliverOutbox(context.Background(), event); err != nil {
+		t.Fatalf("deliver outbox failed: %v", err)
+	}
+	msg, err := pubsub.ReceiveMessage(context.Background())
+	if err != nil || msg.Payload != "blog:"+strconv.FormatInt(id, 10) {
+		t.Fatalf("expected bloom add of blog %d, but get %+v %v", id, msg, err)
+	}
+}
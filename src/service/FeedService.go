@@ -0,0 +1,349 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	redisConfig "github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+	redisClient "hmdp-Go/src/config/redis"
+	"hmdp-Go/src/model"
+	"hmdp-Go/src/utils"
+)
+
+// 关注流的推送事件，通过发件箱发布到 FEED_FANOUT_STREAM，与博客的修改在同一个事务中
+const (
+	feedActionPush   = "push"   // 发布或恢复博客
+	feedActionRemove = "remove" // 删除博客
+)
+
+type feedEvent struct {
+	action      string
+	blogId      int64
+	authorId    int64
+	publishTime int64 // 秒，收件箱中的分数
+}
+
+// publishFeedEvent 在事务中登记推送事件
+func publishFeedEvent(tx *gorm.DB, action string, blog *model.Blog) error {
+	return OutboxManager.Publish(tx, utils.FEED_FANOUT_STREAM, map[string]string{
+		"action":      action,
+		"blogId":      strconv.FormatInt(blog.Id, 10),
+		"authorId":    strconv.FormatInt(blog.UserId, 10),
+		"publishTime": strconv.FormatInt(blog.CreateTime.Unix(), 10),
+	})
+}
+
+func parseFeedEvent(values map[string]interface{}) (feedEvent, error) {
+	var event feedEvent
+	var err error
+	event.action, _ = values["action"].(string)
+	if event.action != feedActionPush && event.action != feedActionRemove {
+		return event, errors.New("unknown feed action " + event.action)
+	}
+	blogId, _ := values["blogId"].(string)
+	if event.blogId, err = strconv.ParseInt(blogId, 10, 64); err != nil {
+		return event, err
+	}
+	authorId, _ := values["authorId"].(string)
+	if event.authorId, err = strconv.ParseInt(authorId, 10, 64); err != nil {
+		return event, err
+	}
+	publishTime, _ := values["publishTime"].(string)
+	event.publishTime, err = strconv.ParseInt(publishTime, 10, 64)
+	return event, err
+}
+
+// InitFeedFanout 创建推送事件的消费者组，每个实例作为一个消费者处理推送
+func InitFeedFanout() {
+	ctx := context.Background()
+	_, err := redisClient.GetRedisClient().XGroupCreateMkStream(ctx, utils.FEED_FANOUT_STREAM, utils.FEED_FANOUT_GROUP, "0").Result()
+	if err != nil && !strings.Contains(err.Error(), "BUSYGROUP") {
+		logrus.Errorf("create feed fanout group failed: %v", err)
+	}
+	go consumeFeedFanout(ctx, utils.InstanceId())
+}
+
+// consumeFeedFanout 处理失败的消息不确认，空闲超过 FEED_FANOUT_CLAIM_IDLE 后由任意实例重新认领，
+// 推送是幂等的，重复处理没有影响
+func consumeFeedFanout(ctx context.Context, consumer string) {
+	claimIdle := utils.FEED_FANOUT_CLAIM_IDLE * time.Second
+	var lastClaim time.Time
+	for ctx.Err() == nil {
+		if time.Since(lastClaim) >= claimIdle {
+			claimFeedFanout(ctx, consumer, claimIdle)
+			lastClaim = time.Now()
+		}
+
+		streams, err := redisClient.GetRedisClient().XReadGroup(ctx, &redisConfig.XReadGroupArgs{
+			Group:    utils.FEED_FANOUT_GROUP,
+			Consumer: consumer,
+			Streams:  []string{utils.FEED_FANOUT_STREAM, ">"},
+			Count:    10,
+			Block:    2 * time.Second,
+		}).Result()
+		if errors.Is(err, redisConfig.Nil) {
+			continue
+		}
+		if err != nil {
+			logrus.Warnf("read feed fanout stream failed: %v", err)
+			time.Sleep(time.Second)
+			continue
+		}
+		for _, msg := range streams[0].Messages {
+			handleFeedFanout(ctx, msg)
+		}
+	}
+}
+
+// claimFeedFanout 认领空闲的未确认消息，包括宕机的实例没有处理完的消息
+func claimFeedFanout(ctx context.Context, consumer string, minIdle time.Duration) {
+	start := "0-0"
+	for {
+		msgs, next, err := redisClient.GetRedisClient().XAutoClaim(ctx, &redisConfig.XAutoClaimArgs{
+			Stream:   utils.FEED_FANOUT_STREAM,
+			Group:    utils.FEED_FANOUT_GROUP,
+			MinIdle:  minIdle,
+			Start:    start,
+			Count:    10,
+			Consumer: consumer,
+		}).Result()
+		if err != nil {
+			logrus.Warnf("claim feed fanout messages failed: %v", err)
+			return
+		}
+		for _, msg := range msgs {
+			handleFeedFanout(ctx, msg)
+		}
+		if next == "0-0" || len(msgs) == 0 {
+			return
+		}
+		start = next
+	}
+}
+
+func handleFeedFanout(ctx context.Context, msg redisConfig.XMessage) {
+	event, err := parseFeedEvent(msg.Values)
+	if err != nil {
+		// 格式错误的消息重试也不会成功，直接确认
+		logrus.Errorf("drop invalid feed fanout message %s: %v", msg.ID, err)
+	} else if err = fanoutBlog(ctx, event); err != nil {
+		logrus.Warnf("fan out blog %d failed, retry later: %v", event.blogId, err)
+		return
+	}
+	if err = redisClient.GetRedisClient().XAck(ctx, utils.FEED_FANOUT_STREAM, utils.FEED_FANOUT_GROUP, msg.ID).Err(); err != nil {
+		logrus.Warnf("ack feed fanout message %s failed: %v", msg.ID, err)
+	}
+}
+
+// fanoutBlog 博客总是写入作者的发件箱；粉丝数达到 FEED_PUSH_THRESHOLD 的作者标记为拉模式，
+// 一旦标记不再取消，否则标记前后发布的博客可能都不在粉丝的收件箱中；其余作者的博客分批推送到粉丝的收件箱
+func fanoutBlog(ctx context.Context, event feedEvent) error {
+	rdb := redisClient.GetRedisClient()
+	authorKey := utils.FEED_AUTHOR_KEY + strconv.FormatInt(event.authorId, 10)
+	_, err := rdb.Pipelined(ctx, func(pipe redisConfig.Pipeliner) error {
+		updateFeedBox(ctx, pipe, authorKey, event)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	var followUtils model.Follow
+	followers, err := followUtils.CountFollowers(event.authorId)
+	if err != nil {
+		return err
+	}
+	if followers >= utils.FEED_PUSH_THRESHOLD {
+		return markBigAuthorScript.Run(ctx, rdb, []string{utils.FEED_BIG_AUTHORS_KEY, utils.FEED_BIG_AUTHORS_VER}, event.authorId).Err()
+	}
+
+	var afterId int64
+	for {
+		follows, err := followUtils.QueryFollowers(event.authorId, afterId, utils.FEED_FANOUT_BATCH)
+		if err != nil || len(follows) == 0 {
+			return err
+		}
+		_, err = rdb.Pipelined(ctx, func(pipe redisConfig.Pipeliner) error {
+			for _, follow := range follows {
+				updateFeedBox(ctx, pipe, utils.FEED_KEY+strconv.FormatInt(follow.UserId, 10), event)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if len(follows) < utils.FEED_FANOUT_BATCH {
+			return nil
+		}
+		afterId = follows[len(follows)-1].Id
+	}
+}
+
+// updateFeedBox 写入时只保留最新的 FEED_BOX_MAX_SIZE 篇博客
+func updateFeedBox(ctx context.Context, pipe redisConfig.Pipeliner, key string, event feedEvent) {
+	if event.action == feedActionRemove {
+		pipe.ZRem(ctx, key, event.blogId)
+		return
+	}
+	pipe.ZAdd(ctx, key, redisConfig.Z{Member: event.blogId, Score: float64(event.publishTime)})
+	pipe.ZRemRangeByRank(ctx, key, 0, -utils.FEED_BOX_MAX_SIZE-1)
+}
+
+// markBigAuthorScript 标记拉模式作者，新增时版本加一，使所有用户缓存的关注列表失效
+var markBigAuthorScript = redisConfig.NewScript(`
+if redis.call('SADD', KEYS[1], ARGV[1]) == 1 then
+	redis.call('INCR', KEYS[2])
+end
+return 0
+`)
+
+// feedSources 用户的收件箱和关注的拉模式作者的发件箱
+func feedSources(ctx context.Context, userId int64) ([]string, error) {
+	keys := []string{utils.FEED_KEY + strconv.FormatInt(userId, 10)}
+	following, err := bigAuthorsFollowed(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	for _, authorId := range following {
+		keys = append(keys, utils.FEED_AUTHOR_KEY+strconv.FormatInt(authorId, 10))
+	}
+	return keys, nil
+}
+
+// bigAuthorsFollowed 用户关注的拉模式作者，缓存在 FEED_BIG_FOLLOWING 中，每次读取只需要一次 pipeline；
+// 缓存记录了计算时拉模式作者的版本，新增拉模式作者后失效，用户关注或取消关注时删除
+func bigAuthorsFollowed(ctx context.Context, userId int64) ([]int64, error) {
+	rdb := redisClient.GetRedisClient()
+	cacheKey := utils.FEED_BIG_FOLLOWING + strconv.FormatInt(userId, 10)
+	var cached, version *redisConfig.StringCmd
+	_, err := rdb.Pipelined(ctx, func(pipe redisConfig.Pipeliner) error {
+		cached = pipe.Get(ctx, cacheKey)
+		version = pipe.Get(ctx, utils.FEED_BIG_AUTHORS_VER)
+		return nil
+	})
+	if err != nil && !errors.Is(err, redisConfig.Nil) {
+		return nil, err
+	}
+	if cachedVersion, ids, ok := strings.Cut(cached.Val(), "|"); ok && cachedVersion == version.Val() {
+		return parseIds(ids), nil
+	}
+
+	members, err := rdb.SMembers(ctx, utils.FEED_BIG_AUTHORS_KEY).Result()
+	if err != nil {
+		return nil, err
+	}
+	var following []int64
+	if len(members) > 0 {
+		var followUtils model.Follow
+		if following, err = followUtils.QueryFollowingIn(userId, parseIds(strings.Join(members, ","))); err != nil {
+			return nil, err
+		}
+	}
+	idStrs := make([]string, len(following))
+	for i, id := range following {
+		idStrs[i] = strconv.FormatInt(id, 10)
+	}
+	// 使用读取缓存时的版本，计算期间新增的拉模式作者会让下一次读取重新计算
+	value := version.Val() + "|" + strings.Join(idStrs, ",")
+	if err = rdb.Set(ctx, cacheKey, value, utils.FEED_BIG_FOLLOWING_TTL*time.Second).Err(); err != nil {
+		logrus.Warnf("cache big authors followed by %d failed: %v", userId, err)
+	}
+	return following, nil
+}
+
+// evictBigAuthorsFollowed 用户关注或取消关注后删除缓存
+func evictBigAuthorsFollowed(ctx context.Context, userId int64) {
+	cacheKey := utils.FEED_BIG_FOLLOWING + strconv.FormatInt(userId, 10)
+	if err := redisClient.GetRedisClient().Del(ctx, cacheKey).Err(); err != nil {
+		logrus.Warnf("evict big authors followed by %d failed: %v", userId, err)
+	}
+}
+
+func parseIds(s string) []int64 {
+	var ids []int64
+	for _, idStr := range strings.Split(s, ",") {
+		if id, err := strconv.ParseInt(idStr, 10, 64); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// readFeed 从所有来源读取分数不超过 maxTime 的博客，合并后跳过上一页已经返回的 offset 篇(分数等于 maxTime)，
+// 返回一页博客id、这一页的最小分数和其中分数等于最小分数的博客数。合并时按 Redis 的顺序排列：
+// 分数降序，分数相同时按成员的字典序降序，因此翻页的结果与只有收件箱时一致
+func readFeed(ctx context.Context, keys []string, maxTime int64, offset int, pageSize int) ([]int64, int64, int, error) {
+	cmds := make([]*redisConfig.ZSliceCmd, len(keys))
+	_, err := redisClient.GetRedisClient().Pipelined(ctx, func(pipe redisConfig.Pipeliner) error {
+		for i, key := range keys {
+			cmds[i] = pipe.ZRevRangeByScoreWithScores(ctx, key, &redisConfig.ZRangeBy{
+				Min:   "0",
+				Max:   strconv.FormatInt(maxTime, 10),
+				Count: int64(offset + pageSize),
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, 0, 0, err
+	}
+
+	// 同一篇博客可能同时在收件箱和发件箱中，分数相同
+	seen := make(map[string]bool)
+	var merged []redisConfig.Z
+	for _, cmd := range cmds {
+		for _, z := range cmd.Val() {
+			member, _ := z.Member.(string)
+			if !seen[member] {
+				seen[member] = true
+				merged = append(merged, z)
+			}
+		}
+	}
+	sort.Slice(merged, func(i, j int) bool {
+		if merged[i].Score != merged[j].Score {
+			return merged[i].Score > merged[j].Score
+		}
+		return merged[i].Member.(string) > merged[j].Member.(string)
+	})
+
+	skipped := 0
+	for skipped < offset && skipped < len(merged) && int64(merged[skipped].Score) == maxTime {
+		skipped++
+	}
+	merged = merged[skipped:]
+	if len(merged) > pageSize {
+		merged = merged[:pageSize]
+	}
+	if len(merged) == 0 {
+		return nil, 0, 0, nil
+	}
+
+	ids := make([]int64, 0, len(merged))
+	minTime, nextOffset := int64(0), 0
+	for _, z := range merged {
+		id, err := strconv.ParseInt(z.Member.(string), 10, 64)
+		if err != nil {
+			return nil, 0, 0, err
+		}
+		ids = append(ids, id)
+		score := int64(z.Score)
+		if score == minTime {
+			nextOffset++
+		} else {
+			minTime = score
+			nextOffset = 1
+		}
+	}
+	// 整页的分数都等于 maxTime 时，下一页还要跳过之前已经返回的博客
+	if minTime == maxTime {
+		nextOffset += skipped
+	}
+	return ids, minTime, nextOffset, nil
+}
@@ -0,0 +1,184 @@
+package service
+
+import (
+	"context"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"hmdp-Go/src/config/mysql"
+	redisClient "hmdp-Go/src/config/redis"
+	"hmdp-Go/src/model"
+	"hmdp-Go/src/utils"
+)
+
+// feedPage 读取一页并检查结果
+func feedPage(t *testing.T, keys []string, maxTime int64, offset int, pageSize int, want []int64) (int64, int) {
+	t.Helper()
+	ids, minTime, nextOffset, err := readFeed(context.Background(), keys, maxTime, offset, pageSize)
+	if err != nil {
+		t.Fatalf("read feed failed: %v", err)
+	}
+	if !reflect.DeepEqual(ids, want) {
+		t.Fatalf("read feed (max %d, offset %d) expected %v, but get %v", maxTime, offset, want, ids)
+	}
+	return minTime, nextOffset
+}
+
+func TestReadFeedMergesSources(t *testing.T) {
+	mr := setupTestStores(t)
+	inbox, outbox := utils.FEED_KEY+"1", utils.FEED_AUTHOR_KEY+"2"
+	mr.ZAdd(inbox, 100, "1")
+	mr.ZAdd(inbox, 90, "2")
+	mr.ZAdd(inbox, 70, "5")
+	mr.ZAdd(outbox, 95, "3")
+	mr.ZAdd(outbox, 80, "4")
+	keys := []string{inbox, outbox}
+
+	minTime, offset := feedPage(t, keys, 1000, 0, 3, []int64{1, 3, 2})
+	if minTime != 90 || offset != 1 {
+		t.Fatalf("expected min time 90 and offset 1, but get %d %d", minTime, offset)
+	}
+	minTime, offset = feedPage(t, keys, minTime, offset, 3, []int64{4, 5})
+	feedPage(t, keys, minTime, offset, 3, nil)
+}
+
+func TestReadFeedEqualScores(t *testing.T) {
+	mr := setupTestStores(t)
+	inbox, outbox := utils.FEED_KEY+"1", utils.FEED_AUTHOR_KEY+"2"
+	// 5 篇博客的分数相同，分布在两个来源中，每页 2 篇时跨越多页
+	for _, member := range []string{"11", "13", "15"} {
+		mr.ZAdd(inbox, 100, member)
+	}
+	for _, member := range []string{"12", "14"} {
+		mr.ZAdd(outbox, 100, member)
+	}
+	mr.ZAdd(inbox, 50, "1")
+	keys := []string{inbox, outbox}
+
+	minTime, offset := feedPage(t, keys, 1000, 0, 2, []int64{15, 14})
+	if minTime != 100 || offset != 2 {
+		t.Fatalf("expected min time 100 and offset 2, but get %d %d", minTime, offset)
+	}
+	// 整页的分数都等于 maxTime 时，偏移量要累加之前跳过的博客
+	minTime, offset = feedPage(t, keys, minTime, offset, 2, []int64{13, 12})
+	if minTime != 100 || offset != 4 {
+		t.Fatalf("expected min time 100 and offset 4, but get %d %d", minTime, offset)
+	}
+	minTime, offset = feedPage(t, keys, minTime, offset, 2, []int64{11, 1})
+	if minTime != 50 || offset != 1 {
+		t.Fatalf("expected min time 50 and offset 1, but get %d %d", minTime, offset)
+	}
+	feedPage(t, keys, minTime, offset, 2, nil)
+}
+
+func TestReadFeedDuplicates(t *testing.T) {
+	mr := setupTestStores(t)
+	inbox, outbox := utils.FEED_KEY+"1", utils.FEED_AUTHOR_KEY+"2"
+	// 作者成为拉模式之前推送到收件箱的博客同时在发件箱中
+	for _, key := range []string{inbox, outbox} {
+		mr.ZAdd(key, 100, "3")
+		mr.ZAdd(key, 90, "2")
+	}
+	mr.ZAdd(outbox, 80, "1")
+	keys := []string{inbox, outbox}
+
+	minTime, offset := feedPage(t, keys, 1000, 0, 2, []int64{3, 2})
+	if minTime != 90 || offset != 1 {
+		t.Fatalf("expected min time 90 and offset 1, but get %d %d", minTime, offset)
+	}
+	feedPage(t, keys, minTime, offset, 2, []int64{1})
+}
+
+func followTestUser(t *testing.T, userId, followUserId int64) {
+	t.Helper()
+	follow := model.Follow{UserId: userId, FollowUserId: followUserId, CreateTime: time.Now()}
+	if err := follow.SaveUserFollow(); err != nil {
+		t.Fatalf("save follow failed: %v", err)
+	}
+}
+
+// markTestBigAuthor 粉丝数达到阈值时 fanoutBlog 执行的标记
+func markTestBigAuthor(t *testing.T, authorId int64) {
+	t.Helper()
+	keys := []string{utils.FEED_BIG_AUTHORS_KEY, utils.FEED_BIG_AUTHORS_VER}
+	if err := markBigAuthorScript.Run(context.Background(), redisClient.GetRedisClient(), keys, authorId).Err(); err != nil {
+		t.Fatalf("mark big author failed: %v", err)
+	}
+}
+
+func checkFeedSources(t *testing.T, userId int64, want []string) {
+	t.Helper()
+	keys, err := feedSources(context.Background(), userId)
+	if err != nil {
+		t.Fatalf("feed sources failed: %v", err)
+	}
+	if !reflect.DeepEqual(keys, want) {
+		t.Fatalf("expected sources %v, but get %v", want, keys)
+	}
+}
+
+func TestFeedSourcesCache(t *testing.T) {
+	setupTestStores(t)
+	followTestUser(t, 1, 2)
+	followTestUser(t, 1, 3)
+	checkFeedSources(t, 1, []string{"feed:1"})
+
+	// 新增拉模式作者后缓存失效
+	markTestBigAuthor(t, 2)
+	checkFeedSources(t, 1, []string{"feed:1", "feed:author:2"})
+	markTestBigAuthor(t, 3)
+	markTestBigAuthor(t, 3)
+	checkFeedSources(t, 1, []string{"feed:1", "feed:author:2", "feed:author:3"})
+
+	// 命中缓存时不查询数据库，直接修改数据库不会生效
+	var follow model.Follow
+	if err := follow.RemoveUserFollow(2, 1); err != nil {
+		t.Fatal(err)
+	}
+	checkFeedSources(t, 1, []string{"feed:1", "feed:author:2", "feed:author:3"})
+
+	// 通过服务取消关注时删除缓存
+	if err := FollowManager.Follow(3, 1, true); err != nil {
+		t.Fatalf("unfollow failed: %v", err)
+	}
+	checkFeedSources(t, 1, []string{"feed:1"})
+	if version, _ := redisClient.GetRedisClient().Get(context.Background(), utils.FEED_BIG_AUTHORS_VER).Result(); version != "2" {
+		t.Fatalf("marking an existing big author should not change the version, but get %q", version)
+	}
+}
+
+func TestQueryBlogOfFollowSkipsHidden(t *testing.T) {
+	mr := setupTestStores(t)
+	createTestUser(t, 2)
+	var ids []int64
+	for i := 0; i < 5; i++ {
+		blogId := createTestBlog(t, 2)
+		ids = append(ids, blogId)
+		mr.ZAdd(utils.FEED_KEY+"1", float64(100+i), strconv.FormatInt(blogId, 10))
+	}
+	// 最新的两篇被隐藏和删除，第一页仍然是满的
+	var blog model.Blog
+	for status, id := range map[int]int64{model.REPORTED: ids[4], model.DELETED: ids[3]} {
+		if _, err := blog.UpdateBlogStatus(mysql.GetMysqlDB(), id, status, model.NORMAL); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	page, err := BlogManager.QueryBlogOfFollow(1000, 0, 1, 2)
+	if err != nil || len(page.Data) != 2 || page.Data[0].Id != ids[2] || page.Data[1].Id != ids[1] {
+		t.Fatalf("expected blogs %d and %d, but get %+v %v", ids[2], ids[1], page.Data, err)
+	}
+	if page.MinTime != 101 || page.Offset != 1 {
+		t.Fatalf("expected min time 101 and offset 1, but get %d %d", page.MinTime, page.Offset)
+	}
+	page, err = BlogManager.QueryBlogOfFollow(page.MinTime, page.Offset, 1, 2)
+	if err != nil || len(page.Data) != 1 || page.Data[0].Id != ids[0] {
+		t.Fatalf("expected blog %d, but get %+v %v", ids[0], page.Data, err)
+	}
+	page, err = BlogManager.QueryBlogOfFollow(page.MinTime, page.Offset, 1, 2)
+	if err != nil || len(page.Data) != 0 {
+		t.Fatalf("expected no more blogs, but get %+v %v", page.Data, err)
+	}
+}
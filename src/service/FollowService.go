@@ -44,6 +44,8 @@ func (*FollowService) Follow(id int64, userId int64, isFollow bool) error {
 			logrus.Errorf("Redis SAdd failed: %v", err)
 		}
 	}
+	// 关注的拉模式作者可能变化
+	evictBigAuthorsFollowed(ctx, userId)
 	return nil
 }
 
@@ -0,0 +1,131 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	redisConfig "github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+	redisClient "hmdp-Go/src/config/redis"
+	"hmdp-Go/src/dto"
+	"hmdp-Go/src/utils"
+)
+
+// LockService 分布式锁的诊断：查看锁的持有者，强制释放卡住的锁
+type LockService struct {
+}
+
+var LockManager *LockService
+
+var ErrInvalidLockKey = errors.New("只能释放 lock: 或 " + utils.CACHE_LOCK_KEY + " 开头的锁")
+
+const lockScanLimit = 200
+
+// lockKeyPrefixes 锁的key前缀：业务锁以 lock: 开头，缓存重建的互斥锁以 CACHE_LOCK_KEY 开头
+var lockKeyPrefixes = []string{"lock:", utils.CACHE_LOCK_KEY}
+
+// LockMetrics 当前实例的锁竞争统计
+type LockMetrics struct {
+	Instance string           `json:"instance"`
+	Locks    []utils.LockStat `json:"locks"`
+}
+
+// lockClients 锁所在的节点，redlock 模式下为所有独立节点，查询只使用第一个节点
+func lockClients() []*redisConfig.Client {
+	if clients := redisClient.GetLockClients(); len(clients) > 0 {
+		return clients
+	}
+	return []*redisConfig.Client{redisClient.GetRedisClient()}
+}
+
+// QueryLocks 列出当前所有的锁，最多 lockScanLimit 个
+func (*LockService) QueryLocks() ([]utils.LockInfo, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var locks []utils.LockInfo
+	for _, prefix := range lockKeyPrefixes {
+		found, err := utils.ScanLocks(ctx, lockClients()[0], prefix+"*", lockScanLimit-len(locks))
+		if err != nil {
+			return nil, err
+		}
+		locks = append(locks, found...)
+		if len(locks) >= lockScanLimit {
+			break
+		}
+	}
+	return locks, nil
+}
+
+func (*LockService) QueryLock(key string) (utils.LockInfo, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return utils.InspectLock(ctx, lockClients()[0], key)
+}
+
+// ForceRelease 强制释放锁，在所有节点上删除，并把释放前的持有者写入审计stream
+func (*LockService) ForceRelease(operator dto.UserDTO, key string, reason string) (utils.LockInfo, error) {
+	if !isLockKey(key) {
+		return utils.LockInfo{}, ErrInvalidLockKey
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var info utils.LockInfo
+	released := false
+	for _, client := range lockClients() {
+		nodeInfo, err := utils.ForceUnlock(ctx, client, key)
+		if errors.Is(err, utils.ErrLockNotFound) {
+			continue
+		}
+		if err != nil {
+			return info, err
+		}
+		if !released {
+			info = nodeInfo
+		}
+		released = true
+	}
+	if !released {
+		return info, utils.ErrLockNotFound
+	}
+
+	holders, _ := json.Marshal(info.Holders)
+	meta, _ := json.Marshal(info.Meta)
+	err := redisClient.GetRedisClient().XAdd(ctx, &redisConfig.XAddArgs{
+		Stream: utils.LOCK_AUDIT_STREAM,
+		MaxLen: utils.EVENT_STREAM_MAX_LEN,
+		Approx: true,
+		Values: map[string]interface{}{
+			"key":        key,
+			"holders":    string(holders),
+			"meta":       string(meta),
+			"operatorId": operator.Id,
+			"operator":   operator.NickName,
+			"reason":     reason,
+			"instance":   utils.InstanceId(),
+			"time":       time.Now().UnixMilli(),
+		},
+	}).Err()
+	if err != nil {
+		// 锁已经释放，审计写入失败只记录日志
+		logrus.Errorf("write lock audit failed, admin %d released %s (holders %s): %v", operator.Id, key, holders, err)
+	}
+	logrus.Warnf("admin %d force released lock %s, holders %s, reason: %s", operator.Id, key, holders, reason)
+	return info, nil
+}
+
+func isLockKey(key string) bool {
+	for _, prefix := range lockKeyPrefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (*LockService) QueryLockMetrics() LockMetrics {
+	return LockMetrics{Instance: utils.InstanceId(), Locks: utils.LockMetrics()}
+}
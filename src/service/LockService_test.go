@@ -0,0 +1,39 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"hmdp-Go/src/dto"
+	"hmdp-Go/src/utils"
+)
+
+func TestQueryLocksIncludesCacheMutex(t *testing.T) {
+	mr := setupTestStores(t)
+	mr.Set("lock:order:1", "token1")
+	mr.Set(utils.CACHE_LOCK_KEY+"1", "token2")
+	mr.Set(utils.CACHE_SHOP_KEY+"1", "{}")
+
+	locks, err := LockManager.QueryLocks()
+	if err != nil {
+		t.Fatalf("query locks failed: %v", err)
+	}
+	keys := make(map[string]bool)
+	for _, lock := range locks {
+		keys[lock.Key] = true
+	}
+	if len(locks) != 2 || !keys["lock:order:1"] || !keys[utils.CACHE_LOCK_KEY+"1"] {
+		t.Fatalf("expected the business lock and the cache mutex, but get %+v", locks)
+	}
+
+	// 缓存重建的互斥锁也可以强制释放，其他key不能通过这个接口删除
+	if _, err = LockManager.ForceRelease(dto.UserDTO{Id: 9}, utils.CACHE_LOCK_KEY+"1", "stuck"); err != nil {
+		t.Fatalf("force release cache mutex failed: %v", err)
+	}
+	if mr.Exists(utils.CACHE_LOCK_KEY + "1") {
+		t.Fatal("cache mutex should be released")
+	}
+	if _, err = LockManager.ForceRelease(dto.UserDTO{Id: 9}, utils.CACHE_SHOP_KEY+"1", "stuck"); !errors.Is(err, ErrInvalidLockKey) {
+		t.Fatalf("expected ErrInvalidLockKey, but get %v", err)
+	}
+}
@@ -0,0 +1,136 @@
+package service
+
+import (
+	"errors"
+	"github.com/jinzhu/gorm"
+	"hmdp-Go/src/config/mysql"
+	"hmdp-Go/src/dto"
+	"hmdp-Go/src/middleware"
+	"hmdp-Go/src/model"
+	"time"
+)
+
+type MerchantService struct {
+}
+
+var MerchantManager *MerchantService
+
+var (
+	ErrAlreadyMerchant   = errors.New("已经是商家，无需重复申请")
+	ErrApplyPending      = errors.New("已有待审核的入驻申请")
+	ErrApplyNotPending   = errors.New("申请不存在或已被审核")
+	ErrApplyNameRequired = errors.New("商家名称不能为空")
+)
+
+// Apply 提交商家入驻申请，同一用户同时只能有一个待审核的申请
+func (*MerchantService) Apply(user dto.UserDTO, apply *model.MerchantApply) error {
+	if middleware.HasRole(user, model.ROLE_MERCHANT, model.ROLE_ADMIN) {
+		return ErrAlreadyMerchant
+	}
+	if apply.Name == "" {
+		return ErrApplyNameRequired
+	}
+
+	var latest model.MerchantApply
+	err := latest.QueryLatestApplyByUser(user.Id)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+	if err == nil && latest.Status == model.APPLY_PENDING {
+		return ErrApplyPending
+	}
+
+	apply.Id = 0
+	apply.UserId = user.Id
+	apply.Status = model.APPLY_PENDING
+	apply.ReviewerId = 0
+	apply.Remark = ""
+	apply.CreateTime = time.Now()
+	apply.UpdateTime = time.Now()
+	return apply.SaveApply()
+}
+
+func (*MerchantService) QueryMyApply(userId int64) (model.MerchantApply, error) {
+	var apply model.MerchantApply
+	err := apply.QueryLatestApplyByUser(userId)
+	return apply, err
+}
+
+func (*MerchantService) QueryApplies(status int, current int) ([]model.MerchantApply, error) {
+	var applyUtils model.MerchantApply
+	return applyUtils.QueryApplies(status, current)
+}
+
+// ApproveApply 审核通过后把用户升级为商家并删除用户缓存，鉴权时从用户缓存读取角色，用户不需要重新登录
+func (*MerchantService) ApproveApply(adminId int64, applyId int64, remark string) error {
+	err := mysql.GetMysqlDB().Transaction(func(tx *gorm.DB) error {
+		var apply model.MerchantApply
+		if err := apply.QueryApplyById(applyId, tx); err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrApplyNotPending
+			}
+			return err
+		}
+
+		apply.Status = model.APPLY_APPROVED
+		apply.ReviewerId = adminId
+		apply.Remark = remark
+		apply.UpdateTime = time.Now()
+		updated, err := apply.UpdateApplyStatus(tx)
+		if err != nil {
+			return err
+		}
+		if !updated {
+			return ErrApplyNotPending
+		}
+
+		var user model.User
+		if err = user.UpdateRole(tx, apply.UserId, model.ROLE_MERCHANT); err != nil {
+			return err
+		}
+		return OutboxManager.CacheDelete(tx, []string{userCache.Key(apply.UserId)})
+	})
+	if err != nil {
+		return err
+	}
+	OutboxManager.Notify()
+	return nil
+}
+
+func (*MerchantService) RejectApply(adminId int64, applyId int64, remark string) error {
+	apply := model.MerchantApply{
+		Id:         applyId,
+		Status:     model.APPLY_REJECTED,
+		ReviewerId: adminId,
+		Remark:     remark,
+		UpdateTime: time.Now(),
+	}
+	updated, err := apply.UpdateApplyStatus(mysql.GetMysqlDB())
+	if err != nil {
+		return err
+	}
+	if !updated {
+		return ErrApplyNotPending
+	}
+	return nil
+}
+
+// QueryMyShops 查询商家名下的所有店铺
+func (*MerchantService) QueryMyShops(userId int64) ([]model.Shop, error) {
+	var owner model.ShopOwner
+	ids, err := owner.QueryShopIdsByUserId(userId)
+	if err != nil {
+		return nil, err
+	}
+	var shopUtils model.Shop
+	return shopUtils.QueryShopByIds(ids)
+}
+
+// QueryShopOrders 查询店铺的优惠券订单，只有店铺的主人和管理员可以查看
+func (*MerchantService) QueryShopOrders(operator dto.UserDTO, shopId int64, current int) ([]model.VoucherOrder, error) {
+	if err := ShopManager.CheckShopAccess(operator, shopId); err != nil {
+		return nil, err
+	}
+	var orderUtils model.VoucherOrder
+	return orderUtils.QueryOrdersByShop(shopId, current)
+}
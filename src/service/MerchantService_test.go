@@ -0,0 +1,39 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"hmdp-Go/src/model"
+)
+
+func TestApproveApplyTakesEffect(t *testing.T) {
+	setupTestStores(t)
+	createTestUser(t, 1)
+	// 审核前用户信息已经在缓存中
+	if user, err := UserManager.GetUserById(1); err != nil || user.Role != model.ROLE_USER {
+		t.Fatalf("expected a normal user, but get %+v %v", user, err)
+	}
+
+	apply := model.MerchantApply{UserId: 1, Name: "shop", Status: model.APPLY_PENDING, CreateTime: time.Now(), UpdateTime: time.Now()}
+	if err := apply.SaveApply(); err != nil {
+		t.Fatalf("save apply failed: %v", err)
+	}
+	if err := MerchantManager.ApproveApply(9, apply.Id, "ok"); err != nil {
+		t.Fatalf("approve apply failed: %v", err)
+	}
+
+	// 删除缓存的事件投递后，新的角色立即生效
+	var outbox model.Outbox
+	events, err := outbox.QueryDueOutbox(time.Now(), 10)
+	if err != nil || len(events) != 1 {
+		t.Fatalf("expected one outbox event, but get %+v %v", events, err)
+	}
+	if err = deliverOutbox(context.Background(), events[0]); err != nil {
+		t.Fatalf("deliver outbox failed: %v", err)
+	}
+	if user, err := UserManager.GetUserById(1); err != nil || user.Role != model.ROLE_MERCHANT {
+		t.Fatalf("expected a merchant after approval, but get %+v %v", user, err)
+	}
+}
@@ -0,0 +1,301 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	redisConfig "github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+	"hmdp-Go/src/cache"
+	redisClient "hmdp-Go/src/config/redis"
+	"hmdp-Go/src/model"
+	"hmdp-Go/src/utils"
+)
+
+// OutboxService 事务发件箱：缓存删除、Redis写入和事件发布与业务数据在同一个事务中写入 tb_outbox，
+// 事务提交后由后台任务投递，失败时按指数退避重试，保证至少投递一次，因此每个事件的处理都必须是幂等的
+type OutboxService struct {
+}
+
+var OutboxManager *OutboxService
+
+// CacheDeletePayload 删除缓存，会同时通知所有实例删除本地缓存
+type CacheDeletePayload struct {
+	Keys []string `json:"keys"`
+}
+
+// RedisSetPayload 写入Redis，TTL 为 0 表示不过期
+type RedisSetPayload struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+	TTL   int64  `json:"ttl"` // 秒
+}
+
+// PublishPayload 发布事件到Redis Stream
+type PublishPayload struct {
+	Stream string            `json:"stream"`
+	Values map[string]string `json:"values"`
+}
+
+// ImageDeletePayload 删除博客的图片，投递时仍被博客引用的图片会被跳过
+type ImageDeletePayload struct {
+	BlogId int64    `json:"blogId"`
+	Images []string `json:"images"`
+}
+
+// BloomAddPayload 把新增的id加入布隆过滤器
+type BloomAddPayload struct {
+	Name string `json:"name"`
+	Id   int64  `json:"id"`
+}
+
+var (
+	outboxSignal   = make(chan struct{}, 1)
+	initOutboxOnce sync.Once
+)
+
+// CacheDelete 在事务中登记缓存删除，delays 不为空时在对应的延迟之后再删除一次(延迟双删)，
+// 清除事务提交前后被并发读请求回填的旧数据
+func (*OutboxService) CacheDelete(tx *gorm.DB, keys []string, delays ...time.Duration) error {
+	payload := CacheDeletePayload{Keys: keys}
+	if err := saveOutbox(tx, model.OUTBOX_CACHE_DELETE, payload, 0); err != nil {
+		return err
+	}
+	for _, delay := range delays {
+		if err := saveOutbox(tx, model.OUTBOX_CACHE_DELETE, payload, delay); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RedisSet 在事务中登记Redis写入
+func (*OutboxService) RedisSet(tx *gorm.DB, key string, value string, ttl time.Duration) error {
+	return saveOutbox(tx, model.OUTBOX_REDIS_SET, RedisSetPayload{Key: key, Value: value, TTL: int64(ttl / time.Second)}, 0)
+}
+
+// RedisInit 在事务中登记Redis的初始化，只有key不存在时才写入
+// 用于之后会被其他操作修改的值(例如秒杀库存)，重复或延迟投递时不会覆盖已经修改过的值
+func (*OutboxService) RedisInit(tx *gorm.DB, key string, value string, ttl time.Duration) error {
+	return saveOutbox(tx, model.OUTBOX_REDIS_INIT, RedisSetPayload{Key: key, Value: value, TTL: int64(ttl / time.Second)}, 0)
+}
+
+// Publish 在事务中登记事件，事务提交后发布到 stream
+func (*OutboxService) Publish(tx *gorm.DB, stream string, values map[string]string) error {
+	return saveOutbox(tx, model.OUTBOX_PUBLISH, PublishPayload{Stream: stream, Values: values}, 0)
+}
+
+// ImageDelete 在事务中登记图片删除，在 delay 之后执行
+func (*OutboxService) ImageDelete(tx *gorm.DB, blogId int64, images []string, delay time.Duration) error {
+	if len(images) == 0 {
+		return nil
+	}
+	return saveOutbox(tx, model.OUTBOX_IMAGE_DELETE, ImageDeletePayload{BlogId: blogId, Images: images}, delay)
+}
+
+// BloomAdd 在事务中登记布隆过滤器的新增，写入Redis或通知其他实例失败时重试，避免新数据被过滤器拦截
+func (*OutboxService) BloomAdd(tx *gorm.DB, bloom *idBloom, id int64) error {
+	return saveOutbox(tx, model.OUTBOX_BLOOM_ADD, BloomAddPayload{Name: bloom.name, Id: id}, 0)
+}
+
+// Notify 事务提交后唤醒投递任务，不调用时事件会在下一次轮询时投递
+func (*OutboxService) Notify() {
+	select {
+	case outboxSignal <- struct{}{}:
+	default:
+	}
+}
+
+func saveOutbox(tx *gorm.DB, eventType string, payload interface{}, delay time.Duration) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	outbox := model.Outbox{
+		EventType:     eventType,
+		Payload:       string(data),
+		Status:        model.OUTBOX_PENDING,
+		NextRetryTime: now.Add(delay),
+		CreateTime:    now,
+		UpdateTime:    now,
+	}
+	return outbox.SaveOutbox(tx)
+}
+
+// InitOutboxRelay 启动发件箱的投递任务，多个实例之间通过分布式锁保证同一时间只有一个实例在投递
+func InitOutboxRelay() {
+	initOutboxOnce.Do(func() {
+		go relayOutbox(context.Background())
+	})
+}
+
+func relayOutbox(ctx context.Context) {
+	ticker := time.NewTicker(utils.OUTBOX_POLL_INTERVAL * time.Millisecond)
+	defer ticker.Stop()
+	cleanTicker := time.NewTicker(time.Hour)
+	defer cleanTicker.Stop()
+	failures := 0
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-outboxSignal:
+		case <-cleanTicker.C:
+			var outbox model.Outbox
+			if err := outbox.DeleteDoneOutbox(time.Now().Add(-utils.OUTBOX_RETENTION * time.Hour)); err != nil {
+				logrus.Warnf("clean outbox failed: %v", err)
+			}
+			continue
+		}
+		if err := relayOnce(ctx); err != nil {
+			// 数据库或Redis不可用时退避，避免反复投递同一批事件
+			failures++
+			logrus.Warnf("relay outbox failed: %v", err)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(outboxBackoff(failures)):
+			}
+			continue
+		}
+		failures = 0
+	}
+}
+
+// relayOnce 投递一批到期的事件，直到没有到期的事件为止
+func relayOnce(ctx context.Context) error {
+	lock := utils.NewLocker()
+	acquired, token, err := lock.LockWithWatchDog(ctx, utils.OUTBOX_RELAY_LOCK_KEY, 30*time.Second)
+	if err != nil || !acquired {
+		return err
+	}
+	defer lock.UnlockWithWatchDog(context.Background(), utils.OUTBOX_RELAY_LOCK_KEY, token)
+
+	// 锁丢失后其他实例可能已经开始投递，停止本轮投递
+	lockCtx := lock.LockContext(utils.OUTBOX_RELAY_LOCK_KEY)
+	var outbox model.Outbox
+	for {
+		events, err := outbox.QueryDueOutbox(time.Now(), utils.OUTBOX_BATCH_SIZE)
+		if err != nil {
+			return err
+		}
+		var markErr error
+		for _, event := range events {
+			if err = utils.CheckLock(lockCtx); err != nil {
+				return err
+			}
+			// 标记失败的事件跳过，继续投递这一批中的其他事件
+			if err = deliverOutbox(ctx, event); err != nil {
+				logrus.Warn(err)
+				markErr = err
+			}
+		}
+		// 标记失败的事件仍然是到期的，继续查询只会重复投递，结束本轮投递并退避
+		if markErr != nil {
+			return markErr
+		}
+		if len(events) < utils.OUTBOX_BATCH_SIZE {
+			return nil
+		}
+	}
+}
+
+// deliverOutbox 先投递再标记成功，标记失败时会重复投递，返回标记的错误
+func deliverOutbox(ctx context.Context, event model.Outbox) error {
+	var outbox model.Outbox
+	err := applyOutbox(ctx, event)
+	if err == nil {
+		if err = outbox.MarkDone(event.Id); err != nil {
+			return fmt.Errorf("mark outbox %d done failed: %w", event.Id, err)
+		}
+		return nil
+	}
+
+	attempts := event.Attempts + 1
+	status := model.OUTBOX_PENDING
+	if attempts >= utils.OUTBOX_MAX_ATTEMPTS {
+		status = model.OUTBOX_DEAD
+		logrus.Errorf("outbox %d (%s) dead after %d attempts: %v", event.Id, event.EventType, attempts, err)
+	} else {
+		logrus.Warnf("outbox %d (%s) attempt %d failed: %v", event.Id, event.EventType, attempts, err)
+	}
+	lastError := []rune(err.Error())
+	if len(lastError) > utils.OUTBOX_LAST_ERROR_LENGTH {
+		lastError = lastError[:utils.OUTBOX_LAST_ERROR_LENGTH]
+	}
+	if markErr := outbox.MarkFailed(event.Id, status, attempts, time.Now().Add(outboxBackoff(attempts)), string(lastError)); markErr != nil {
+		return fmt.Errorf("mark outbox %d failed: %w", event.Id, markErr)
+	}
+	return nil
+}
+
+// outboxBackoff 指数退避：1s, 2s, 4s ... 最多 5 分钟
+func outboxBackoff(attempts int) time.Duration {
+	backoff := time.Duration(math.Pow(2, float64(attempts-1))) * time.Second
+	return min(backoff, 5*time.Minute)
+}
+
+func applyOutbox(ctx context.Context, event model.Outbox) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	rdb := redisClient.GetRedisClient()
+
+	switch event.EventType {
+	case model.OUTBOX_CACHE_DELETE:
+		var payload CacheDeletePayload
+		if err := json.Unmarshal([]byte(event.Payload), &payload); err != nil {
+			return err
+		}
+		return cache.Invalidate(ctx, payload.Keys...)
+	case model.OUTBOX_REDIS_SET:
+		var payload RedisSetPayload
+		if err := json.Unmarshal([]byte(event.Payload), &payload); err != nil {
+			return err
+		}
+		return rdb.Set(ctx, payload.Key, payload.Value, time.Duration(payload.TTL)*time.Second).Err()
+	case model.OUTBOX_REDIS_INIT:
+		var payload RedisSetPayload
+		if err := json.Unmarshal([]byte(event.Payload), &payload); err != nil {
+			return err
+		}
+		return rdb.SetNX(ctx, payload.Key, payload.Value, time.Duration(payload.TTL)*time.Second).Err()
+	case model.OUTBOX_PUBLISH:
+		var payload PublishPayload
+		if err := json.Unmarshal([]byte(event.Payload), &payload); err != nil {
+			return err
+		}
+		values := make(map[string]interface{}, len(payload.Values)+1)
+		for k, v := range payload.Values {
+			values[k] = v
+		}
+		// 消费方可以根据 outboxId 去重
+		values["outboxId"] = event.Id
+		return rdb.XAdd(ctx, &redisConfig.XAddArgs{
+			Stream: payload.Stream,
+			MaxLen: utils.EVENT_STREAM_MAX_LEN,
+			Approx: true,
+			Values: values,
+		}).Err()
+	case model.OUTBOX_IMAGE_DELETE:
+		var payload ImageDeletePayload
+		if err := json.Unmarshal([]byte(event.Payload), &payload); err != nil {
+			return err
+		}
+		return cleanBlogImages(payload.BlogId, payload.Images)
+	case model.OUTBOX_BLOOM_ADD:
+		var payload BloomAddPayload
+		if err := json.Unmarshal([]byte(event.Payload), &payload); err != nil {
+			return err
+		}
+		return syncBloomAdd(ctx, payload.Name, payload.Id)
+	default:
+		return fmt.Errorf("unknown outbox event type %s", event.EventType)
+	}
+}
@@ -0,0 +1,41 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"hmdp-Go/src/config/mysql"
+	"hmdp-Go/src/model"
+	"hmdp-Go/src/utils"
+)
+
+func TestDeliverOutboxTruncatesError(t *testing.T) {
+	setupTestStores(t)
+	// 未知的事件类型出现在失败原因中，超过 last_error 列的长度
+	event := model.Outbox{
+		EventType:     strings.Repeat("错", utils.OUTBOX_LAST_ERROR_LENGTH),
+		Payload:       "{}",
+		Status:        model.OUTBOX_PENDING,
+		NextRetryTime: time.Now(),
+		CreateTime:    time.Now(),
+		UpdateTime:    time.Now(),
+	}
+	if err := event.SaveOutbox(mysql.GetMysqlDB()); err != nil {
+		t.Fatal(err)
+	}
+	if err := deliverOutbox(context.Background(), event); err != nil {
+		t.Fatalf("deliver outbox failed: %v", err)
+	}
+
+	var saved model.Outbox
+	if err := mysql.GetMysqlDB().Table(saved.TableName()).Where("id = ?", event.Id).First(&saved).Error; err != nil {
+		t.Fatal(err)
+	}
+	if saved.Attempts != 1 || utf8.RuneCountInString(saved.LastError) != utils.OUTBOX_LAST_ERROR_LENGTH ||
+		!strings.HasPrefix(saved.LastError, "unknown outbox event type") {
+		t.Fatalf("expected a truncated error, but get attempts %d and %d runes", saved.Attempts, utf8.RuneCountInString(saved.LastError))
+	}
+}
@@ -0,0 +1,197 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/jinzhu/gorm"
+	"github.com/sirupsen/logrus"
+	"hmdp-Go/src/config/mysql"
+	"hmdp-Go/src/model"
+	"hmdp-Go/src/utils"
+)
+
+type ReportService struct {
+}
+
+var ReportManager *ReportService
+
+var (
+	ErrInvalidReport        = fmt.Errorf("举报理由不能为空，且不能超过%d字", utils.REPORT_REASON_MAX_LENGTH)
+	ErrReportTargetNotFound = errors.New("举报的内容不存在")
+	ErrAlreadyReported      = errors.New("已经举报过该内容，请等待处理")
+	ErrReportNotPending     = errors.New("举报不存在或已被处理")
+)
+
+// reportTarget 被举报的博客或评论
+type reportTarget struct {
+	targetType int
+	id         int64
+	status     int
+	blogId     int64    // 被举报的评论所在的博客，评论的可见性变化时修改博客的评论数
+	cacheKeys  []string // 状态变化时需要删除的缓存
+}
+
+func loadReportTarget(targetType int, id int64) (reportTarget, error) {
+	target := reportTarget{targetType: targetType, id: id}
+	switch targetType {
+	case model.REPORT_TARGET_BLOG:
+		var blog model.Blog
+		if err := blog.GetBlogById(id); err != nil {
+			return target, reportTargetNotFound(err)
+		}
+		target.status = blog.Status
+		target.cacheKeys = []string{blogCache.Key(id)}
+	case model.REPORT_TARGET_COMMENT:
+		var comment model.BlogComments
+		if err := comment.QueryCommentById(id); err != nil {
+			return target, reportTargetNotFound(err)
+		}
+		target.status = comment.Status
+		target.blogId = comment.BlogId
+		target.cacheKeys = commentCacheKeys(comment.BlogId)
+	default:
+		return target, ErrReportTargetNotFound
+	}
+	return target, nil
+}
+
+// setStatus 只有当前状态为 from 之一时才修改，返回是否修改成功
+// 评论逐个尝试 from 中的状态，按修改前的状态调整博客的评论数
+func (t reportTarget) setStatus(tx *gorm.DB, status int, from ...int) (bool, error) {
+	if t.targetType == model.REPORT_TARGET_BLOG {
+		var blog model.Blog
+		return blog.UpdateBlogStatus(tx, t.id, status, from...)
+	}
+	var comment model.BlogComments
+	for _, old := range from {
+		changed, err := comment.UpdateCommentStatus(tx, t.id, status, old)
+		if err != nil {
+			return false, err
+		}
+		if !changed {
+			continue
+		}
+		var blog model.Blog
+		return true, blog.IncrComments(tx, t.blogId, commentCountDelta(old, status))
+	}
+	return false, nil
+}
+
+func reportTargetNotFound(err error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrReportTargetNotFound
+	}
+	return err
+}
+
+// Report 举报博客或评论，同一内容被 REPORT_AUTO_HIDE_THRESHOLD 个不同用户举报后自动隐藏，等待管理员审核
+func (*ReportService) Report(userId int64, report *model.Report) error {
+	report.Reason = strings.TrimSpace(report.Reason)
+	if report.Reason == "" || utf8.RuneCountInString(report.Reason) > utils.REPORT_REASON_MAX_LENGTH {
+		return ErrInvalidReport
+	}
+	target, err := loadReportTarget(report.TargetType, report.TargetId)
+	if err != nil {
+		return err
+	}
+	if target.status == model.PROHIBITED {
+		return ErrReportTargetNotFound
+	}
+	report.Id = 0
+	report.UserId = userId
+	report.Status = model.REPORT_PENDING
+	report.ReviewerId = 0
+	report.CreateTime = time.Now()
+	report.UpdateTime = time.Now()
+
+	hidden := false
+	err = mysql.GetMysqlDB().Transaction(func(tx *gorm.DB) error {
+		if err := report.SaveReport(tx); errors.Is(err, model.ErrDuplicateReport) {
+			return ErrAlreadyReported
+		} else if err != nil {
+			return err
+		}
+		reporters, err := report.CountPendingReporters(tx, report.TargetType, report.TargetId)
+		if err != nil || reporters < utils.REPORT_AUTO_HIDE_THRESHOLD {
+			return err
+		}
+		hidden, err = target.setStatus(tx, model.REPORTED, model.NORMAL)
+		if err != nil || !hidden {
+			return err
+		}
+		return OutboxManager.CacheDelete(tx, target.cacheKeys)
+	})
+	if err != nil {
+		return err
+	}
+	if hidden {
+		logrus.Infof("content %d of type %d is hidden after %d reports", report.TargetId, report.TargetType, utils.REPORT_AUTO_HIDE_THRESHOLD)
+		OutboxManager.Notify()
+	}
+	return nil
+}
+
+func (*ReportService) QueryReports(status int, current int) ([]model.Report, error) {
+	var reportUtils model.Report
+	return reportUtils.QueryReports(status, current)
+}
+
+// ApproveReport 举报成立，禁止被举报的内容
+func (*ReportService) ApproveReport(adminId int64, reportId int64) error {
+	return resolveReport(adminId, reportId, model.REPORT_APPROVED, model.PROHIBITED, model.NORMAL, model.REPORTED)
+}
+
+// DismissReport 举报不成立，恢复被自动隐藏的内容
+func (*ReportService) DismissReport(adminId int64, reportId int64) error {
+	return resolveReport(adminId, reportId, model.REPORT_DISMISSED, model.NORMAL, model.REPORTED)
+}
+
+// resolveReport 一起处理被举报内容的所有待处理举报，并把内容的状态从 from 改为 status
+func resolveReport(adminId int64, reportId int64, reportStatus int, status int, from ...int) error {
+	var report model.Report
+	if err := report.QueryReportById(reportId, mysql.GetMysqlDB()); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrReportNotPending
+		}
+		return err
+	}
+	if report.Status != model.REPORT_PENDING {
+		return ErrReportNotPending
+	}
+	// 内容已经被删除时只处理举报
+	target, err := loadReportTarget(report.TargetType, report.TargetId)
+	targetExists := err == nil
+	if err != nil && !errors.Is(err, ErrReportTargetNotFound) {
+		return err
+	}
+
+	changed := false
+	err = mysql.GetMysqlDB().Transaction(func(tx *gorm.DB) error {
+		resolved, err := report.ResolveReports(tx, report.TargetType, report.TargetId, reportStatus, adminId)
+		if err != nil {
+			return err
+		}
+		if resolved == 0 {
+			return ErrReportNotPending
+		}
+		if !targetExists {
+			return nil
+		}
+		changed, err = target.setStatus(tx, status, from...)
+		if err != nil || !changed {
+			return err
+		}
+		return OutboxManager.CacheDelete(tx, target.cacheKeys)
+	})
+	if err != nil {
+		return err
+	}
+	if changed {
+		OutboxManager.Notify()
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"hmdp-Go/src/config/mysql"
+	"hmdp-Go/src/model"
+	"hmdp-Go/src/utils"
+)
+
+func commentStatus(t *testing.T, id int64) int {
+	t.Helper()
+	var comment model.BlogComments
+	if err := comment.QueryCommentById(id); err != nil {
+		t.Fatalf("query comment failed: %v", err)
+	}
+	return comment.Status
+}
+
+// reportTimes 由 from 开始的 n 个不同用户举报评论
+func reportTimes(t *testing.T, commentId int64, from int64, n int) {
+	t.Helper()
+	for userId := from; userId < from+int64(n); userId++ {
+		report := model.Report{TargetType: model.REPORT_TARGET_COMMENT, TargetId: commentId, Reason: "spam"}
+		if err := ReportManager.Report(userId, &report); err != nil {
+			t.Fatalf("report by user %d failed: %v", userId, err)
+		}
+	}
+}
+
+func pendingReportId(t *testing.T) int64 {
+	t.Helper()
+	reports, err := ReportManager.QueryReports(model.REPORT_PENDING, 1)
+	if err != nil || len(reports) == 0 {
+		t.Fatalf("expected pending reports, but get %+v %v", reports, err)
+	}
+	return reports[0].Id
+}
+
+func TestReportAutoHide(t *testing.T) {
+	setupTestStores(t)
+	createTestUser(t, 1)
+	blogId := createTestBlog(t, 1)
+	comment := saveTestComment(t, 1, blogId, 0)
+
+	// 不同用户的举报达到阈值之前不隐藏，同一用户重复举报不计数
+	reportTimes(t, comment.Id, 100, utils.REPORT_AUTO_HIDE_THRESHOLD-1)
+	report := model.Report{TargetType: model.REPORT_TARGET_COMMENT, TargetId: comment.Id, Reason: "spam"}
+	if err := ReportManager.Report(100, &report); !errors.Is(err, ErrAlreadyReported) {
+		t.Fatalf("expected ErrAlreadyReported, but get %v", err)
+	}
+	if status := commentStatus(t, comment.Id); status != model.NORMAL {
+		t.Fatalf("comment should be visible below the threshold, but get status %d", status)
+	}
+	reportTimes(t, comment.Id, 200, 1)
+	if status := commentStatus(t, comment.Id); status != model.REPORTED {
+		t.Fatalf("comment should be hidden at the threshold, but get status %d", status)
+	}
+	// 评论数只统计正常状态的评论
+	if count := blogComments(t, blogId); count != 0 {
+		t.Fatalf("hidden comment should not be counted, but get %d", count)
+	}
+	page, err := BlogCommentsManager.QueryComments(blogId, model.COMMENT_SORT_TIME, 1)
+	if err != nil || page.Total != 0 {
+		t.Fatalf("hidden comment should not be listed, but get %+v %v", page, err)
+	}
+
+	// 举报不成立时恢复，所有待处理的举报一起处理
+	if err = ReportManager.DismissReport(9, pendingReportId(t)); err != nil {
+		t.Fatalf("dismiss report failed: %v", err)
+	}
+	if status := commentStatus(t, comment.Id); status != model.NORMAL {
+		t.Fatalf("comment should be restored after dismissal, but get status %d", status)
+	}
+	if count := blogComments(t, blogId); count != 1 {
+		t.Fatalf("restored comment should be counted, but get %d", count)
+	}
+	if reports, _ := ReportManager.QueryReports(model.REPORT_PENDING, 1); len(reports) != 0 {
+		t.Fatalf("all reports should be resolved, but get %+v", reports)
+	}
+
+	// 处理过的举报不再计数，重新达到阈值后再次隐藏；举报成立时禁止
+	reportTimes(t, comment.Id, 100, utils.REPORT_AUTO_HIDE_THRESHOLD)
+	if status := commentStatus(t, comment.Id); status != model.REPORTED {
+		t.Fatalf("comment should be hidden again, but get status %d", status)
+	}
+	reportId := pendingReportId(t)
+	if err = ReportManager.ApproveReport(9, reportId); err != nil {
+		t.Fatalf("approve report failed: %v", err)
+	}
+	if status := commentStatus(t, comment.Id); status != model.PROHIBITED {
+		t.Fatalf("comment should be prohibited, but get status %d", status)
+	}
+	if count := blogComments(t, blogId); count != 0 {
+		t.Fatalf("prohibited comment should not be counted, but get %d", count)
+	}
+	if err = ReportManager.ApproveReport(9, reportId); !errors.Is(err, ErrReportNotPending) {
+		t.Fatalf("expected ErrReportNotPending, but get %v", err)
+	}
+	report = model.Report{TargetType: model.REPORT_TARGET_COMMENT, TargetId: comment.Id, Reason: "spam"}
+	if err = ReportManager.Report(300, &report); !errors.Is(err, ErrReportTargetNotFound) {
+		t.Fatalf("prohibited content can not be reported, but get %v", err)
+	}
+}
+
+func TestApproveVisibleComment(t *testing.T) {
+	setupTestStores(t)
+	createTestUser(t, 1)
+	blogId := createTestBlog(t, 1)
+	top := saveTestComment(t, 1, blogId, 0)
+	reply := saveTestComment(t, 1, blogId, top.Id)
+
+	// 没有达到阈值的举报成立时，评论直接从正常状态被禁止，评论数减少
+	reportTimes(t, reply.Id, 100, 1)
+	if err := ReportManager.ApproveReport(9, pendingReportId(t)); err != nil {
+		t.Fatalf("approve report failed: %v", err)
+	}
+	if status := commentStatus(t, reply.Id); status != model.PROHIBITED {
+		t.Fatalf("reply should be prohibited, but get status %d", status)
+	}
+	if count := blogComments(t, blogId); count != 1 {
+		t.Fatalf("expected 1 comment, but get %d", count)
+	}
+
+	// 已经有待处理的举报时，唯一索引拒绝同一用户的重复举报
+	reportTimes(t, top.Id, 100, 1)
+	report := model.Report{UserId: 100, TargetType: model.REPORT_TARGET_COMMENT, TargetId: top.Id, Status: model.REPORT_PENDING}
+	if err := report.SaveReport(mysql.GetMysqlDB()); !errors.Is(err, model.ErrDuplicateReport) {
+		t.Fatalf("expected ErrDuplicateReport, but get %v", err)
+	}
+}
@@ -0,0 +1,61 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/sirupsen/logrus"
+	"hmdp-Go/src/model"
+	"hmdp-Go/src/utils"
+)
+
+var ErrSensitiveContent = errors.New("内容包含敏感词")
+
+// InitSensitiveFilter 加载敏感词词库，词库文件修改后自动重新加载
+func InitSensitiveFilter() {
+	if err := utils.SensitiveWords.LoadFile(utils.SENSITIVE_WORDS_PATH); err != nil {
+		logrus.Warnf("load sensitive words failed: %v", err)
+	}
+	go utils.SensitiveWords.Watch(context.Background(), utils.SENSITIVE_WORDS_PATH, utils.SENSITIVE_RELOAD_INTERVAL*time.Second)
+}
+
+// filterSensitive 按策略处理文本：reject 命中时返回 ErrSensitiveContent；mask 把敏感词替换为*；
+// review 不修改文本，返回命中的敏感词，由调用方隐藏内容并提交审核
+func filterSensitive(policy string, texts ...*string) ([]string, error) {
+	var hits []string
+	for _, text := range texts {
+		words := utils.SensitiveWords.Find(*text)
+		if len(words) == 0 {
+			continue
+		}
+		switch policy {
+		case utils.SENSITIVE_REJECT:
+			return nil, ErrSensitiveContent
+		case utils.SENSITIVE_MASK:
+			*text = utils.SensitiveWords.Mask(*text)
+		case utils.SENSITIVE_REVIEW:
+			hits = append(hits, words...)
+		}
+	}
+	return hits, nil
+}
+
+// flagForReview 以系统(用户id为0)的名义提交一个待处理的举报，管理员在举报队列中审核
+// 内容已经有系统提交的待处理举报时(例如隐藏期间再次修改)沿用原来的举报
+func flagForReview(tx *gorm.DB, targetType int, targetId int64, words []string) error {
+	report := model.Report{
+		TargetType: targetType,
+		TargetId:   targetId,
+		Reason:     "敏感词: " + strings.Join(words, ","),
+		Status:     model.REPORT_PENDING,
+		CreateTime: time.Now(),
+		UpdateTime: time.Now(),
+	}
+	if err := report.SaveReport(tx); !errors.Is(err, model.ErrDuplicateReport) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,193 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	redisConfig "github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+	redisClient "hmdp-Go/src/config/redis"
+	"hmdp-Go/src/model"
+	"hmdp-Go/src/utils"
+)
+
+// 店铺查询可选的缓存策略
+const (
+	SHOP_CACHE_NONE           = "none"           // 直接查询数据库
+	SHOP_CACHE_ASIDE          = "cache-aside"    // 旁路缓存
+	SHOP_CACHE_NULL           = "null-cache"     // 缓存空对象
+	SHOP_CACHE_MUTEX          = "mutex"          // 互斥锁重建
+	SHOP_CACHE_LOGICAL_EXPIRE = "logical-expire" // 逻辑过期
+	SHOP_CACHE_BLOOM_NULL     = "bloom-null"     // 布隆过滤器 + 缓存空对象，布隆过滤器已作用于所有策略，等同于 null-cache
+)
+
+// SHOP_CACHE_DEFAULT_CLASS 没有单独配置的请求类别使用的功能开关字段
+const SHOP_CACHE_DEFAULT_CLASS = "default"
+
+var (
+	ErrUnknownCacheStrategy = errors.New("unknown shop cache strategy")
+	ErrUnknownRequestClass  = errors.New("unknown request class")
+)
+
+// 请求类别为用户的角色，由服务端根据登录用户决定
+var shopCacheClasses = map[string]bool{
+	SHOP_CACHE_DEFAULT_CLASS: true,
+	model.ROLE_USER:          true,
+	model.ROLE_MERCHANT:      true,
+	model.ROLE_ADMIN:         true,
+}
+
+var shopCacheStrategies = map[string]bool{
+	SHOP_CACHE_NONE:           true,
+	SHOP_CACHE_ASIDE:          true,
+	SHOP_CACHE_NULL:           true,
+	SHOP_CACHE_MUTEX:          true,
+	SHOP_CACHE_LOGICAL_EXPIRE: true,
+	SHOP_CACHE_BLOOM_NULL:     true,
+}
+
+// ShopCacheStrategyConfig 当前生效的缓存策略：Default 来自配置文件或环境变量，Classes 来自Redis中的功能开关
+type ShopCacheStrategyConfig struct {
+	Default string            `json:"default"`
+	Classes map[string]string `json:"classes"`
+}
+
+var shopStrategyConfig atomic.Pointer[ShopCacheStrategyConfig]
+
+var initShopStrategyOnce sync.Once
+
+// InitShopCacheStrategy 加载缓存策略的配置，并定时刷新Redis中的功能开关
+func InitShopCacheStrategy() {
+	initShopStrategyOnce.Do(func() {
+		refreshShopCacheStrategy(context.Background())
+		go func() {
+			ticker := time.NewTicker(utils.SHOP_CACHE_STRATEGY_REFRESH * time.Second)
+			defer ticker.Stop()
+			for range ticker.C {
+				refreshShopCacheStrategy(context.Background())
+			}
+		}()
+	})
+}
+
+// defaultShopCacheStrategy 环境变量优先于配置文件中的默认值
+func defaultShopCacheStrategy() string {
+	if strategy := os.Getenv(utils.SHOP_CACHE_STRATEGY_ENV); shopCacheStrategies[strategy] {
+		return strategy
+	} else if strategy != "" {
+		logrus.Warnf("ignore unknown shop cache strategy %q from %s", strategy, utils.SHOP_CACHE_STRATEGY_ENV)
+	}
+	return utils.SHOP_CACHE_STRATEGY
+}
+
+// refreshShopCacheStrategy 从Redis中读取功能开关，读取失败时保留上一次的配置
+func refreshShopCacheStrategy(ctx context.Context) {
+	config := &ShopCacheStrategyConfig{
+		Default: defaultShopCacheStrategy(),
+		Classes: make(map[string]string),
+	}
+	flags, err := redisClient.GetRedisClient().HGetAll(ctx, utils.FEATURE_SHOP_CACHE_STRATEGY_KEY).Result()
+	if err != nil && !errors.Is(err, redisConfig.Nil) {
+		logrus.Warnf("refresh shop cache strategy failed: %v", err)
+		if shopStrategyConfig.Load() != nil {
+			return
+		}
+	}
+	for class, strategy := range flags {
+		if !shopCacheStrategies[strategy] || !shopCacheClasses[class] {
+			continue
+		}
+		if class == SHOP_CACHE_DEFAULT_CLASS {
+			config.Default = strategy
+		} else {
+			config.Classes[class] = strategy
+		}
+	}
+	shopStrategyConfig.Store(config)
+}
+
+// ShopCacheStrategyOf 返回请求类别对应的缓存策略，没有单独配置的类别使用默认策略
+func ShopCacheStrategyOf(class string) string {
+	config := shopStrategyConfig.Load()
+	if config == nil {
+		return defaultShopCacheStrategy()
+	}
+	if strategy, ok := config.Classes[class]; ok {
+		return strategy
+	}
+	return config.Default
+}
+
+// QueryShopCacheStrategies 查询当前生效的缓存策略
+func (*ShopService) QueryShopCacheStrategies() ShopCacheStrategyConfig {
+	if config := shopStrategyConfig.Load(); config != nil {
+		return *config
+	}
+	return ShopCacheStrategyConfig{Default: defaultShopCacheStrategy(), Classes: map[string]string{}}
+}
+
+// SetShopCacheStrategy 修改功能开关，class 为空表示修改默认策略，strategy 为空表示删除该类别的配置
+// 其他实例在下一次刷新时生效
+func (*ShopService) SetShopCacheStrategy(class string, strategy string) error {
+	if class == "" {
+		class = SHOP_CACHE_DEFAULT_CLASS
+	}
+	if !shopCacheClasses[class] {
+		return fmt.Errorf("%w: %s", ErrUnknownRequestClass, class)
+	}
+	ctx := context.Background()
+	rdb := redisClient.GetRedisClient()
+	var err error
+	if strategy == "" {
+		err = rdb.HDel(ctx, utils.FEATURE_SHOP_CACHE_STRATEGY_KEY, class).Err()
+	} else if !shopCacheStrategies[strategy] {
+		return fmt.Errorf("%w: %s", ErrUnknownCacheStrategy, strategy)
+	} else {
+		err = rdb.HSet(ctx, utils.FEATURE_SHOP_CACHE_STRATEGY_KEY, class, strategy).Err()
+	}
+	if err != nil {
+		return err
+	}
+	refreshShopCacheStrategy(ctx)
+	return nil
+}
+
+// QueryShopByIdWithStrategy 使用指定的缓存策略查询店铺，店铺不存在时返回空对象
+func (*ShopService) QueryShopByIdWithStrategy(id int64, strategy string) (model.Shop, error) {
+	switch strategy {
+	case SHOP_CACHE_NONE:
+		shop, err := ShopManager.QueryShopById(id)
+		return emptyIfNotFound(shop, notFound(err))
+	case SHOP_CACHE_ASIDE:
+		return emptyIfNotFound(ShopManager.QueryShopByIdWithCache(id))
+	case SHOP_CACHE_NULL, SHOP_CACHE_BLOOM_NULL:
+		return ShopManager.QueryShopByIdWithCacheNull(id)
+	case SHOP_CACHE_MUTEX:
+		return ShopManager.QueryShopByIdPassThrough(id)
+	case SHOP_CACHE_LOGICAL_EXPIRE:
+		return ShopManager.QueryShopByIdWithLogicExpire(id)
+	default:
+		return model.Shop{}, fmt.Errorf("%w: %s", ErrUnknownCacheStrategy, strategy)
+	}
+}
+
+// QueryShopByIdForClass 按照请求类别选择缓存策略查询店铺
+// 开启热点升级时，热点店铺统一使用逻辑过期，避免热点key过期时缓存击穿；
+// 布隆过滤器在热点探测之前检查，不存在的店铺不会被统计为热点，也不会因为升级而访问数据库
+func (*ShopService) QueryShopByIdForClass(id int64, class string) (model.Shop, error) {
+	if !shopBloom.mayExist(id) {
+		return model.Shop{}, nil
+	}
+	strategy := ShopCacheStrategyOf(class)
+	if utils.SHOP_CACHE_HOT_KEY_PROMOTE && strategy != SHOP_CACHE_NONE &&
+		shopHotKeys.Record(strconv.FormatInt(id, 10)) {
+		strategy = SHOP_CACHE_LOGICAL_EXPIRE
+	}
+	return ShopManager.QueryShopByIdWithStrategy(id, strategy)
+}
@@ -2,16 +2,20 @@ package service
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/jinzhu/gorm"
 	redisConfig "github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+	"hmdp-Go/src/cache"
 	"hmdp-Go/src/config/mysql"
 	redisClient "hmdp-Go/src/config/redis"
+	"hmdp-Go/src/dto"
+	"hmdp-Go/src/middleware"
 	"hmdp-Go/src/model"
 	"hmdp-Go/src/utils"
 	"strconv"
+	"sync"
 	"time"
 )
 
@@ -20,32 +24,162 @@ type ShopService struct {
 
 var ShopManager *ShopService
 
-var distLock *utils.DistributedLock
+var ErrNoShopPermission = errors.New("无权管理该店铺")
+
+// 店铺缓存：几种缓存策略共用同一个加载函数
+// 逻辑过期的数据格式不同，使用单独的key前缀；查询最频繁的缓存空对象策略开启了本地缓存
+// 所有策略都先经过布隆过滤器，一定不存在的店铺不会访问Redis和数据库；加载和回填缓存期间持有店铺的读锁
+var (
+	shopCacheAside = cache.New[int64, model.Shop](utils.CACHE_SHOP_KEY, loadShop,
+		cache.WithStrategy(cache.StrategyCacheAside), cache.WithTTL(time.Minute, 0), cache.WithGuard(shopBloom.guard), cache.WithLoadLock(lockShopForLoad))
+	shopCacheNull = cache.New[int64, model.Shop](utils.CACHE_SHOP_KEY, loadShop,
+		cache.WithStrategy(cache.StrategyNullValue), cache.WithTTL(time.Minute, 0), cache.WithNullTTL(time.Minute),
+		cache.WithLocalCache(10000, 30*time.Second), cache.WithGuard(shopBloom.guard), cache.WithLoadLock(lockShopForLoad))
+	shopCacheMutex = cache.New[int64, model.Shop](utils.CACHE_SHOP_KEY, loadShop,
+		cache.WithStrategy(cache.StrategyMutex), cache.WithTTL(time.Minute, 0), cache.WithNullTTL(time.Minute),
+		cache.WithLock(utils.CACHE_LOCK_KEY, 10*time.Second), cache.WithGuard(shopBloom.guard), cache.WithLoadLock(lockShopForLoad))
+	shopCacheLogical = cache.New[int64, model.Shop](utils.CACHE_SHOP_LOGIC_KEY, loadShop,
+		cache.WithStrategy(cache.StrategyLogicalExpire), cache.WithTTL(utils.HOT_KEY_EXISTS_TIME*time.Second, 0),
+		cache.WithLock(utils.CACHE_LOCK_KEY, 10*time.Second), cache.WithGuard(shopBloom.guard), cache.WithLoadLock(lockShopForLoad))
+)
+
+// 热点店铺探测：访问量达到阈值的店铺自动切换为逻辑过期缓存，冷却后降级
+var shopHotKeys = cache.NewHotKeyDetector(cache.HotKeyConfig{
+	Window:        utils.HOT_SHOP_WINDOW * time.Second,
+	Buckets:       6,
+	HotThreshold:  utils.HOT_SHOP_THRESHOLD,
+	CoolThreshold: utils.HOT_SHOP_COOL_THRESHOLD,
+}, promoteHotShop, demoteHotShop)
+
+// InitShopHotKeyDetector 启动热点店铺探测
+func InitShopHotKeyDetector() {
+	shopHotKeys.Start(context.Background())
+}
+
+func promoteHotShop(key string) {
+	id, err := strconv.ParseInt(key, 10, 64)
+	if err != nil {
+		return
+	}
+	logrus.Infof("shop %d becomes hot key, warm up logical expire cache", id)
+	if err = ShopManager.WarmShopCache(id); err != nil {
+		logrus.Warnf("warm hot shop %d failed: %v", id, err)
+	}
+}
+
+func demoteHotShop(key string) {
+	id, err := strconv.ParseInt(key, 10, 64)
+	if err != nil {
+		return
+	}
+	logrus.Infof("shop %d cools down, remove logical expire cache", id)
+	if err = shopCacheLogical.Delete(context.Background(), id); err != nil {
+		logrus.Warnf("remove hot shop %d cache failed: %v", id, err)
+	}
+}
 
-const (
-	MAX_REDIS_DATA_QUEUE = 10
+var (
+	shopRWLock     *utils.ReadWriteLock
+	shopRWLockOnce sync.Once
 )
 
-var redisDataQueue chan int64
+// getShopRWLock 店铺读写锁：重建缓存时从查询数据库到写入缓存都持有读锁，修改店铺时加写锁，避免把修改之前的旧数据写回缓存
+func getShopRWLock() *utils.ReadWriteLock {
+	shopRWLockOnce.Do(func() {
+		shopRWLock = utils.NewReadWriteLock(redisClient.GetRedisClient())
+	})
+	return shopRWLock
+}
+
+func shopRWLockKey(id int64) string {
+	return utils.SHOP_RW_LOCK_KEY + strconv.FormatInt(id, 10)
+}
 
-func init() {
-	redisDataQueue = make(chan int64, MAX_REDIS_DATA_QUEUE)
-	distLock = utils.NewDistributedLock(redisClient.GetRedisClient())
-	go ShopManager.SyncUpdateCache()
+// lockShopForLoad 缓存客户端在加载店铺并写入缓存期间持有读锁，多个实例可以同时加载同一个店铺，
+// 店铺正在修改时最多等待 SHOP_READ_LOCK_WAIT
+func lockShopForLoad(ctx context.Context, key string) (func(), error) {
+	lockKey := utils.SHOP_RW_LOCK_KEY + key
+	waitCtx, cancel := context.WithTimeout(ctx, utils.SHOP_READ_LOCK_WAIT*time.Millisecond)
+	defer cancel()
+	_, token, err := getShopRWLock().RLock(waitCtx, lockKey, 10*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	return func() {
+		getShopRWLock().RUnlock(context.WithoutCancel(ctx), lockKey, token)
+	}, nil
+}
+
+func loadShop(_ context.Context, id int64) (model.Shop, error) {
+	var shop model.Shop
+	shop.Id = id
+	err := shop.QueryShopById(id)
+	return shop, notFound(err)
+}
+
+// notFound 把数据库的记录不存在转换为缓存的 ErrNotFound
+func notFound(err error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return cache.ErrNotFound
+	}
+	return err
 }
 
 func (*ShopService) QueryShopById(id int64) (model.Shop, error) {
+	if !shopBloom.mayExist(id) {
+		return model.Shop{}, gorm.ErrRecordNotFound
+	}
 	var shop model.Shop
 	shop.Id = id
 	err := shop.QueryShopById(id)
 	return shop, err
 }
 
-func (*ShopService) SaveShop(shop *model.Shop) error {
-	err := shop.SaveShop()
+// SaveShop 保存店铺，商家创建的店铺自动归属于该商家
+func (*ShopService) SaveShop(operator dto.UserDTO, shop *model.Shop) error {
+	err := mysql.GetMysqlDB().Transaction(func(tx *gorm.DB) error {
+		if err := shop.SaveShop(tx); err != nil {
+			return err
+		}
+		if err := OutboxManager.BloomAdd(tx, shopBloom, shop.Id); err != nil {
+			return err
+		}
+		if !middleware.HasRole(operator, model.ROLE_MERCHANT) {
+			return nil
+		}
+		owner := model.ShopOwner{
+			ShopId:     shop.Id,
+			UserId:     operator.Id,
+			CreateTime: time.Now(),
+		}
+		return owner.SaveShopOwner(tx)
+	})
+	if err == nil {
+		shopBloom.add(shop.Id)
+		OutboxManager.Notify()
+	}
 	return err
 }
 
+// CheckShopAccess 管理员可以管理所有店铺，商家只能管理自己的店铺
+func (*ShopService) CheckShopAccess(operator dto.UserDTO, shopId int64) error {
+	if middleware.HasRole(operator, model.ROLE_ADMIN) {
+		return nil
+	}
+	if !middleware.HasRole(operator, model.ROLE_MERCHANT) {
+		return ErrNoShopPermission
+	}
+	var owner model.ShopOwner
+	isOwner, err := owner.IsShopOwner(operator.Id, shopId)
+	if err != nil {
+		return err
+	}
+	if !isOwner {
+		return ErrNoShopPermission
+	}
+	return nil
+}
+
 func (*ShopService) UpdateShop(shop *model.Shop) error {
 	err := shop.UpdateShop(mysql.GetMysqlDB())
 	return err
@@ -65,48 +199,23 @@ func (*ShopService) QueryByName(name string, current int) ([]model.Shop, error)
 
 // QueryShopByIdWithCache 如果缓存未命中，则查询数据库，将数据库结果写入缓存，并设置超时时间
 func (*ShopService) QueryShopByIdWithCache(id int64) (model.Shop, error) {
-	redisKey := utils.CACHE_SHOP_KEY + strconv.FormatInt(id, 10)
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
-
-	shopInfo, err := redisClient.GetRedisClient().Get(ctx, redisKey).Result()
-	if err == nil {
-		var shop model.Shop
-		err = json.Unmarshal([]byte(shopInfo), &shop)
-		if err != nil {
-			return model.Shop{}, err
-		}
-		return shop, nil
-	}
-
-	if errors.Is(err, redisConfig.Nil) {
-		var shop model.Shop
-		shop.Id = id
-		err = shop.QueryShopById(id)
-		if err != nil {
-			return model.Shop{}, err
-		}
-
-		redisValue, err := json.Marshal(shop)
-		if err != nil {
-			return model.Shop{}, err
-		}
-
-		// 超时剔除策略
-		err = redisClient.GetRedisClient().Set(ctx, redisKey, string(redisValue), time.Minute).Err()
-
-		if err != nil {
-			return model.Shop{}, err
-		}
-		return shop, nil
-	}
-
-	return model.Shop{}, err
+	return shopCacheAside.Get(context.Background(), id)
 }
 
 // UpdateShopWithCacheCallBack 缓存更新的最佳实践方法
+// 持有店铺的写锁直到事务提交，期间加载店铺的请求会等待；加载店铺的请求写入缓存之后才释放读锁，
+// 所以在写锁之前读到旧数据的请求也会在事务提交之前写完缓存，随后由发件箱删除，不会把旧数据写回缓存
 func (*ShopService) UpdateShopWithCacheCallBack(db *gorm.DB, shop *model.Shop) error {
-	return db.Transaction(func(tx *gorm.DB) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	lockKey := shopRWLockKey(shop.Id)
+	lockCtx, token, err := getShopRWLock().Lock(ctx, lockKey, 10*time.Second)
+	if err != nil {
+		return err
+	}
+	defer getShopRWLock().Unlock(context.Background(), lockKey, token)
+
+	err = db.Transaction(func(tx *gorm.DB) error {
 		err := shop.QueryShopById(shop.Id)
 		if err != nil {
 			return err
@@ -118,232 +227,73 @@ func (*ShopService) UpdateShopWithCacheCallBack(db *gorm.DB, shop *model.Shop) e
 			return err
 		}
 
-		// delete the cache
-		redisKey := utils.CACHE_SHOP_KEY + strconv.FormatInt(shop.Id, 10)
-		ctx, cancel := context.WithCancel(context.Background())
-		defer cancel()
-
-		err = redisClient.GetRedisClient().Del(ctx, redisKey).Err()
-
-		if err != nil {
+		// 缓存删除写入发件箱，与数据库更新一起提交，提交后再延迟删除一次
+		keys := []string{shopCacheNull.Key(shop.Id), shopCacheLogical.Key(shop.Id)}
+		if err = OutboxManager.CacheDelete(tx, keys, utils.OUTBOX_DOUBLE_DELETE_DELAY*time.Second); err != nil {
 			return err
 		}
-
-		return nil
+		return utils.CheckLock(lockCtx)
 	})
+	if err == nil {
+		OutboxManager.Notify()
+	}
+	return err
 }
 
-func (*ShopService) UpdateShopWithCache(shop *model.Shop) error {
+// UpdateShopWithCache 只有店铺的主人和管理员才能修改店铺
+func (*ShopService) UpdateShopWithCache(operator dto.UserDTO, shop *model.Shop) error {
+	if err := ShopManager.CheckShopAccess(operator, shop.Id); err != nil {
+		return err
+	}
 	return ShopManager.UpdateShopWithCacheCallBack(mysql.GetMysqlDB(), shop)
 }
 
 // QueryShopByIdWithCacheNull 缓存穿透的解决方法: 缓存空对象
 func (*ShopService) QueryShopByIdWithCacheNull(id int64) (model.Shop, error) {
-	redisKey := utils.CACHE_SHOP_KEY + strconv.FormatInt(id, 10)
-
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
-
-	shopInfoStr, err := redisClient.GetRedisClient().Get(ctx, redisKey).Result()
+	return emptyIfNotFound(shopCacheNull.Get(context.Background(), id))
+}
 
-	if err == nil {
-		var shopInfo model.Shop
-		if shopInfoStr == "" {
-			return model.Shop{}, nil
-		}
-		err = json.Unmarshal([]byte(shopInfoStr), &shopInfo)
-		if err != nil {
-			return model.Shop{}, err
-		}
-		return shopInfo, nil
+// QueryShopByIdWithHotKey 普通店铺使用缓存空对象，探测到的热点店铺使用逻辑过期，避免热点key过期时缓存击穿
+func (*ShopService) QueryShopByIdWithHotKey(id int64) (model.Shop, error) {
+	if shopHotKeys.Record(strconv.FormatInt(id, 10)) {
+		return ShopManager.QueryShopByIdWithLogicExpire(id)
 	}
+	return ShopManager.QueryShopByIdWithCacheNull(id)
+}
 
-	if errors.Is(err, redisConfig.Nil) {
-		var shopInfo model.Shop
-		shopInfo.Id = id
-		err = shopInfo.QueryShopById(id)
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			err = redisClient.GetRedisClient().Set(ctx, redisKey, "", time.Minute).Err()
-			if err != nil {
-				return model.Shop{}, err
-			}
-			return model.Shop{}, nil
-		}
-
-		redisValue, err := json.Marshal(shopInfo)
-		if err != nil {
-			return model.Shop{}, err
-		}
-		err = redisClient.GetRedisClient().Set(ctx, redisKey, string(redisValue), time.Minute).Err()
-		if err != nil {
-			return model.Shop{}, err
-		}
-		return shopInfo, nil
-	}
-	return model.Shop{}, nil
+// QueryHotShops 查询当前的热点店铺
+func (*ShopService) QueryHotShops() []cache.HotKey {
+	return shopHotKeys.HotKeys()
 }
 
 // QueryShopByIdPassThrough 利用互斥锁解决热点 Key 问题(也就是缓存击穿问题)
 func (*ShopService) QueryShopByIdPassThrough(id int64) (model.Shop, error) {
-	redisKey := utils.CACHE_SHOP_KEY + strconv.FormatInt(id, 10)
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
-
-	shopInfoStr, err := redisClient.GetRedisClient().Get(ctx, redisKey).Result()
-
-	if err == nil {
-		if shopInfoStr == "" {
-			return model.Shop{}, err
-		}
-
-		var shopInfo model.Shop
-		err = json.Unmarshal([]byte(shopInfoStr), &shopInfo)
-		if err != nil {
-			return model.Shop{}, err
-		}
-		return shopInfo, err
-	}
-
-	if errors.Is(err, redisConfig.Nil) {
-		lockKey := utils.CACHE_LOCK_KEY + strconv.FormatInt(id, 10)
-		ctx := context.Background()
-		flag, token, err := distLock.LockWithWatchDog(ctx, lockKey, 10*time.Second)
-		if err != nil {
-			return model.Shop{}, err
-		}
-
-		// 没有获取到锁
-		if !flag {
-			time.Sleep(time.Millisecond * 50)
-			return ShopManager.QueryShopByIdPassThrough(id)
-		}
-
-		// 重新建立缓存
-		defer distLock.UnlockWithWatchDog(ctx, lockKey, token)
-		var shopInfo model.Shop
-		err = shopInfo.QueryShopById(id)
-
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			err = redisClient.GetRedisClient().Set(ctx, redisKey, "", time.Minute).Err()
-			return model.Shop{}, err
-		}
-
-		if err != nil {
-			return model.Shop{}, err
-		}
-
-		redisValue, err := json.Marshal(shopInfo)
-		if err != nil {
-			return model.Shop{}, err
-		}
-
-		err = redisClient.GetRedisClient().Set(ctx, redisKey, string(redisValue), time.Minute).Err()
-		if err != nil {
-			return model.Shop{}, err
-		}
-		return shopInfo, nil
-	}
-	return model.Shop{}, err
+	return emptyIfNotFound(shopCacheMutex.Get(context.Background(), id))
 }
 
 // @Description: use the logic expire to deal with the cache pass through
-// 注意：逻辑过期一定要先进行数据预热，将我们热点数据加载到缓存中
+// 注意：逻辑过期最好先进行数据预热(WarmShopCache)，未预热的店铺会在第一次访问时同步加载
 func (*ShopService) QueryShopByIdWithLogicExpire(id int64) (model.Shop, error) {
-	redisKey := utils.CACHE_SHOP_KEY + strconv.FormatInt(id, 10)
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
-
-	redisDataStr, err := redisClient.GetRedisClient().Get(ctx, redisKey).Result()
-
-	// hot key is in redis
-	if errors.Is(err, redisConfig.Nil) {
-		return model.Shop{}, nil
-	}
-
-	if err == nil {
-		if redisDataStr == "" {
-			return model.Shop{}, nil
-		}
-
-		var redisData utils.RedisData[model.Shop]
-		err = json.Unmarshal([]byte(redisDataStr), &redisData)
-		if err != nil {
-			return model.Shop{}, err
-		}
-
-		if redisData.ExpireTime.After(time.Now()) {
-			return redisData.Data, nil
-		}
-		// 否则过期,需要重新建立缓存
-
-		lockKey := utils.CACHE_LOCK_KEY + strconv.FormatInt(id, 10)
-		ctx := context.Background()
-		flag, token, err := distLock.LockWithWatchDog(ctx, lockKey, 10*time.Second)
-		if err != nil {
-			return model.Shop{}, err
-		}
+	return emptyIfNotFound(shopCacheLogical.Get(context.Background(), id))
+}
 
-		// if not get the lock
-		if !flag {
-			return redisData.Data, nil
+// WarmShopCache 将热点店铺预热到逻辑过期缓存中
+func (*ShopService) WarmShopCache(ids ...int64) error {
+	ctx := context.Background()
+	for _, id := range ids {
+		if err := shopCacheLogical.Warm(ctx, id); err != nil && !errors.Is(err, cache.ErrNotFound) {
+			return err
 		}
-
-		// if get the lock
-		defer distLock.UnlockWithWatchDog(ctx, lockKey, token)
-		redisDataQueue <- id
-		// go func() {
-		// 	var shopInfo model.Shop
-		// 	err = shopInfo.QueryShopById(id)
-		// 	if err != nil {
-		// 		return
-		// 	}
-		// 	var redisDataToSave utils.RedisData[model.Shop]
-		//
-		// 	redisDataToSave.Data = shopInfo
-		// 	// the time of hot key exists
-		// 	redisDataToSave.ExpireTime = time.Now().Add(time.Second * utils.HOT_KEY_EXISTS_TIME)
-		//
-		// 	redisValue,err := json.Marshal(redisDataToSave)
-		// 	err = redisClient.GetRedisClient().Set(ctx , redisKey , string(redisValue) , 0).Err()
-		// 	if err != nil {
-		// 		return
-		// 	}
-		// 	return
-		// }()
-		//
-		return redisData.Data, nil
 	}
-
-	return model.Shop{}, err
+	return nil
 }
 
-func (*ShopService) SyncUpdateCache() {
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
-	for {
-		id := <-redisDataQueue
-
-		redisKey := utils.CACHE_SHOP_KEY + strconv.FormatInt(id, 10)
-
-		var shopInfo model.Shop
-		err := shopInfo.QueryShopById(id)
-
-		if err != nil {
-			continue
-		}
-
-		var redisDataToSave utils.RedisData[model.Shop]
-
-		redisDataToSave.Data = shopInfo
-		// the time of hot key exists
-		redisDataToSave.ExpireTime = time.Now().Add(time.Second * utils.HOT_KEY_EXISTS_TIME)
-
-		redisValue, err := json.Marshal(redisDataToSave)
-		err = redisClient.GetRedisClient().Set(ctx, redisKey, string(redisValue), 0).Err()
-		if err != nil {
-			continue
-		}
+// emptyIfNotFound 店铺不存在时返回空对象，与缓存空对象的语义保持一致
+func emptyIfNotFound(shop model.Shop, err error) (model.Shop, error) {
+	if errors.Is(err, cache.ErrNotFound) {
+		return model.Shop{}, nil
 	}
+	return shop, err
 }
 
 // 查询店铺列表（支持地理位置排序）
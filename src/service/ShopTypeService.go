@@ -3,11 +3,11 @@ package service
 import (
 	"context"
 	"encoding/json"
-	"errors"
-	redisConfig "github.com/redis/go-redis/v9"
+	"hmdp-Go/src/cache"
 	redisClient "hmdp-Go/src/config/redis"
 	"hmdp-Go/src/model"
 	"hmdp-Go/src/utils"
+	"time"
 )
 
 type ShopTypeService struct {
@@ -21,45 +21,14 @@ func (*ShopTypeService) QueryShopTypeList() ([]model.ShopType, error) {
 	return shopTypeList, err
 }
 
-func (*ShopTypeService) QueryShopTypeListWithCache() ([]model.ShopType, error) {
-	redisKey := utils.CACHE_SHOP_LIST
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
-
-	shopListStr, err := redisClient.GetRedisClient().Get(ctx, redisKey).Result()
-
-	if err == nil {
-		var shoplist []model.ShopType
-		err = json.Unmarshal([]byte(shopListStr), &shoplist)
-		if err != nil {
-			return []model.ShopType{}, err
-		}
-		return shoplist, nil
-	}
-
-	if errors.Is(err, redisConfig.Nil) {
-		var shoplist []model.ShopType
-		var shopTypeUtils model.ShopType
-		shoplist, err = shopTypeUtils.QueryTypeList()
-		if err != nil {
-			return []model.ShopType{}, nil
-		}
-
-		redisValue, err := json.Marshal(shoplist)
-		if err != nil {
-			return []model.ShopType{}, err
-		}
-
-		err = redisClient.GetRedisClient().Set(ctx, redisKey, string(redisValue), 0).Err()
-
-		if err != nil {
-			return []model.ShopType{}, err
-		}
-
-		return shoplist, err
-	}
+// 店铺类型几乎不会变化，使用逻辑过期策略，过期后后台刷新
+var shopTypeCache = cache.New[string, []model.ShopType](utils.CACHE_SHOP_TYPE_KEY, func(_ context.Context, _ string) ([]model.ShopType, error) {
+	var shopTypeUtils model.ShopType
+	return shopTypeUtils.QueryTypeList()
+}, cache.WithStrategy(cache.StrategyLogicalExpire), cache.WithTTL(time.Hour, 10*time.Minute))
 
-	return []model.ShopType{}, err
+func (*ShopTypeService) QueryShopTypeListWithCache() ([]model.ShopType, error) {
+	return shopTypeCache.Get(context.Background(), "list")
 }
 
 func (*ShopTypeService) QueryTypeListWithCacheList() ([]model.ShopType, error) {
@@ -4,12 +4,19 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"github.com/jinzhu/gorm"
+	redisConfig "github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+	"hmdp-Go/src/cache"
+	"hmdp-Go/src/config/mysql"
 	redisClient "hmdp-Go/src/config/redis"
 	"hmdp-Go/src/dto"
 	"hmdp-Go/src/middleware"
 	"hmdp-Go/src/model"
 	"hmdp-Go/src/utils"
+	"strings"
 	"time"
+	"unicode/utf8"
 )
 
 type UserService struct {
@@ -17,22 +24,134 @@ type UserService struct {
 
 var UserManager *UserService
 
-func (*UserService) GetUserById(id int64) (model.User, error) {
+var (
+	ErrCodeSendTooFrequent   = errors.New("验证码发送过于频繁，请稍后再试")
+	ErrCodeSendLimitExceeded = errors.New("今日验证码发送次数已达上限")
+	ErrCodeExpired           = errors.New("验证码不存在或已过期")
+	ErrCodeWrong             = errors.New("验证码错误")
+	ErrCodeTooManyFailures   = errors.New("验证码错误次数过多，请重新获取")
+	ErrInvalidNickName       = fmt.Errorf("昵称不能为空，且不能超过%d个字", utils.NICK_NAME_MAX_LENGTH)
+)
+
+// sendCodeLimitScript 同时检查手机号和IP的发送间隔与每日次数，全部通过才记录本次发送
+// 返回 0: 允许发送 1: 手机号过于频繁 2: 手机号超过每日上限 3: IP过于频繁 4: IP超过每日上限
+var sendCodeLimitScript = redisConfig.NewScript(`
+if redis.call("EXISTS", KEYS[1]) == 1 then
+	return 1
+end
+if tonumber(redis.call("GET", KEYS[2]) or "0") >= tonumber(ARGV[2]) then
+	return 2
+end
+if redis.call("EXISTS", KEYS[3]) == 1 then
+	return 3
+end
+if tonumber(redis.call("GET", KEYS[4]) or "0") >= tonumber(ARGV[3]) then
+	return 4
+end
+redis.call("SET", KEYS[1], 1, "EX", ARGV[1])
+redis.call("SET", KEYS[3], 1, "EX", ARGV[1])
+if redis.call("INCR", KEYS[2]) == 1 then
+	redis.call("EXPIRE", KEYS[2], ARGV[4])
+end
+if redis.call("INCR", KEYS[4]) == 1 then
+	redis.call("EXPIRE", KEYS[4], ARGV[4])
+end
+return 0
+`)
+
+// verifyCodeScript 原子地校验验证码
+// 返回 0: 校验通过 -1: 验证码不存在 -2: 输错次数过多，验证码已作废 >0: 剩余可尝试次数
+var verifyCodeScript = redisConfig.NewScript(`
+local code = redis.call("GET", KEYS[1])
+if not code then
+	return -1
+end
+if code == ARGV[1] then
+	redis.call("DEL", KEYS[1], KEYS[2])
+	return 0
+end
+local fails = redis.call("INCR", KEYS[2])
+if fails == 1 then
+	redis.call("EXPIRE", KEYS[2], ARGV[3])
+end
+if fails >= tonumber(ARGV[2]) then
+	redis.call("DEL", KEYS[1], KEYS[2])
+	return -2
+end
+return tonumber(ARGV[2]) - fails
+`)
+
+// 用户信息缓存，博客列表等高频接口都需要查询作者信息
+var userCache = cache.New[int64, model.User](utils.CACHE_USER_KEY, func(_ context.Context, id int64) (model.User, error) {
 	var userUtils model.User
 	user, err := userUtils.GetUserById(id)
+	return user, notFound(err)
+}, cache.WithTTL(30*time.Minute, 5*time.Minute), cache.WithNullTTL(2*time.Minute), cache.WithLocalCache(5000, time.Minute),
+	cache.WithGuard(userBloom.guard))
+
+func (*UserService) GetUserById(id int64) (model.User, error) {
+	user, err := userCache.Get(context.Background(), id)
+	if errors.Is(err, cache.ErrNotFound) {
+		return model.User{}, gorm.ErrRecordNotFound
+	}
 	return user, err
 }
 
-func (*UserService) SaveCode(phone string) error {
+// InitRoleLoader 鉴权时从用户缓存中读取最新的角色，角色变更(商家入驻、撤销管理员)立即生效
+func InitRoleLoader() {
+	middleware.SetRoleLoader(func(userId int64) (string, error) {
+		user, err := UserManager.GetUserById(userId)
+		return user.Role, err
+	})
+}
+
+// SaveCode 生成验证码并发送短信，同一手机号和IP的发送频率受到限制
+func (*UserService) SaveCode(phone string, ip string) error {
 
 	if !utils.RegexUtil.IsPhoneValid(phone) {
-		return errors.New("phone number is valid")
+		return errors.New("phone number is not valid")
 	}
-	verifyCode := utils.RandomUtil.GenerateVerifyCode()
+
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
-	err := redisClient.GetRedisClient().Set(ctx, utils.LOGIN_CODE_KEY+phone, verifyCode, time.Minute*utils.LOGIN_VERIFY_CODE_TTL).Err()
-	return err
+
+	today := time.Now().Format("20060102")
+	keys := []string{
+		utils.LOGIN_INTERVAL_KEY + "phone:" + phone,
+		utils.LOGIN_DAILY_KEY + "phone:" + phone + ":" + today,
+		utils.LOGIN_INTERVAL_KEY + "ip:" + ip,
+		utils.LOGIN_DAILY_KEY + "ip:" + ip + ":" + today,
+	}
+	result, err := sendCodeLimitScript.Run(ctx, redisClient.GetRedisClient(), keys,
+		utils.LOGIN_CODE_SEND_INTERVAL, utils.LOGIN_CODE_PHONE_DAILY_MAX,
+		utils.LOGIN_CODE_IP_DAILY_MAX, utils.LOGIN_CODE_DAILY_KEY_TTL).Int64()
+	if err != nil {
+		return err
+	}
+	switch result {
+	case 1, 3:
+		return ErrCodeSendTooFrequent
+	case 2, 4:
+		return ErrCodeSendLimitExceeded
+	}
+
+	verifyCode := utils.RandomUtil.GenerateVerifyCode()
+	codeKey := utils.LOGIN_CODE_KEY + phone
+	// 新的验证码重新计算输错次数
+	pipe := redisClient.GetRedisClient().TxPipeline()
+	pipe.Set(ctx, codeKey, verifyCode, time.Minute*utils.LOGIN_VERIFY_CODE_TTL)
+	pipe.Del(ctx, utils.LOGIN_CODE_FAIL_KEY+phone)
+	if _, err = pipe.Exec(ctx); err != nil {
+		return err
+	}
+
+	content := fmt.Sprintf(utils.SMS_CODE_TEMPLATE, verifyCode, utils.LOGIN_VERIFY_CODE_TTL)
+	if err = utils.SmsClient.Send(phone, content); err != nil {
+		logrus.Errorf("send sms to %s failed: %v", phone, err)
+		redisClient.GetRedisClient().Del(ctx, codeKey)
+		return errors.New("验证码发送失败，请稍后重试")
+	}
+	return nil
 }
 
 func (*UserService) Login(loginInfo *dto.LoginFormDto) (string, error) {
@@ -51,32 +170,48 @@ func (*UserService) Login(loginInfo *dto.LoginFormDto) (string, error) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	cacheCode, err := redisClient.GetRedisClient().Get(ctx, utils.LOGIN_CODE_KEY+loginInfo.Phone).Result()
+	// 校验成功后删除验证码(一次性)，输错次数过多则直接作废
+	keys := []string{utils.LOGIN_CODE_KEY + loginInfo.Phone, utils.LOGIN_CODE_FAIL_KEY + loginInfo.Phone}
+	result, err := verifyCodeScript.Run(ctx, redisClient.GetRedisClient(), keys,
+		loginInfo.Code, utils.LOGIN_CODE_MAX_FAIL_TIMES, utils.LOGIN_VERIFY_CODE_TTL*60).Int64()
 	if err != nil {
 		return "", err
 	}
-
-	if cacheCode != loginInfo.Code {
-		return "", errors.New("a wrong verify code!")
+	switch {
+	case result == -1:
+		return "", ErrCodeExpired
+	case result == -2:
+		return "", ErrCodeTooManyFailures
+	case result > 0:
+		return "", fmt.Errorf("%w，还可以尝试%d次", ErrCodeWrong, result)
 	}
 
 	var user model.User
 	err = user.GetUserByPhone(loginInfo.Phone)
 	if err != nil {
 		user.Phone = loginInfo.Phone
-		user.NickName = utils.USER_NICK_NAME_PREFIX + utils.RandomUtil.GenerateRandomStr(10)
+		user.NickName = generateNickName()
+		user.Role = model.ROLE_USER
 		user.CreateTime = time.Now()
 		user.UpdateTime = time.Now()
-		err = user.SaveUser()
+		err = mysql.GetMysqlDB().Transaction(func(tx *gorm.DB) error {
+			if err := user.SaveUser(tx); err != nil {
+				return err
+			}
+			return OutboxManager.BloomAdd(tx, userBloom, user.Id)
+		})
 		if err != nil {
 			return "", err
 		}
+		userBloom.add(user.Id)
+		OutboxManager.Notify()
 	}
 
 	var userDTO dto.UserDTO
 	userDTO.Id = user.Id
 	userDTO.Icon = user.Icon
 	userDTO.NickName = user.NickName
+	userDTO.Role = user.GetRole()
 
 	j := middleware.NewJWT()
 	clamis := j.CreateClaims(userDTO)
@@ -89,6 +224,43 @@ func (*UserService) Login(loginInfo *dto.LoginFormDto) (string, error) {
 	return token, nil
 }
 
+// generateNickName 随机生成的昵称可能恰好包含敏感词，重新生成几次，仍然包含时替换为*
+func generateNickName() string {
+	var nickName string
+	for i := 0; i < 10; i++ {
+		nickName = utils.USER_NICK_NAME_PREFIX + utils.RandomUtil.GenerateRandomStr(10)
+		if !utils.SensitiveWords.Contains(nickName) {
+			return nickName
+		}
+	}
+	return utils.SensitiveWords.Mask(nickName)
+}
+
+// UpdateNickName 修改昵称，返回保存的昵称；token 中的昵称在重新登录后才会更新
+func (*UserService) UpdateNickName(userId int64, nickName string) (string, error) {
+	nickName = strings.TrimSpace(nickName)
+	if nickName == "" || utf8.RuneCountInString(nickName) > utils.NICK_NAME_MAX_LENGTH {
+		return "", ErrInvalidNickName
+	}
+	// 昵称无法隐藏后审核，需要审核的昵称直接拒绝
+	words, err := filterSensitive(utils.SENSITIVE_POLICY_NICKNAME, &nickName)
+	if err != nil {
+		return "", err
+	}
+	if len(words) > 0 {
+		return "", ErrSensitiveContent
+	}
+
+	var user model.User
+	if err = user.UpdateNickName(userId, nickName); err != nil {
+		return "", err
+	}
+	if err = userCache.Delete(context.Background(), userId); err != nil {
+		logrus.Warnf("remove cache of user %d failed: %v", userId, err)
+	}
+	return nickName, nil
+}
+
 // Sign 用户签到
 func (s *UserService) Sign(userID int64) error {
 	// 1. 获取当前日期
@@ -15,6 +15,7 @@ import (
 	"io/ioutil"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -35,6 +36,23 @@ func init() {
 	voucherScript = redisConfig.NewScript(string(script))
 }
 
+// idGenerator 订单id生成器，由 ID_GENERATOR 配置选择，没有初始化时使用 RedisWorker
+var idGenerator utils.IdGenerator = utils.RedisWork
+
+// InitIdGenerator 按配置创建id生成器，snowflake 模式下租用机器id失败时无法生成订单id，直接退出
+func InitIdGenerator() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	generator, err := utils.NewIdGenerator(ctx)
+	if err != nil {
+		panic(err)
+	}
+	if snowflake, ok := generator.(*utils.Snowflake); ok {
+		logrus.Infof("use snowflake id generator, worker id %d", snowflake.WorkerId())
+	}
+	idGenerator = generator
+}
+
 func InitOrderHandler() {
 	// 创建消费者组
 	ctx := context.Background()
@@ -61,7 +79,7 @@ func (vo *VoucherOrderService) SeckillVoucher(voucherId int64, userId int64) err
 	if now.After(voucher.EndTime) {
 		return errors.New("秒杀已结束")
 	}
-	orderId, err := utils.RedisWork.NextId("order")
+	orderId, err := idGenerator.NextId("order")
 	if err != nil {
 		return err
 	}
@@ -237,32 +255,77 @@ func handleFailedMessage(msg redisConfig.XMessage, err error) {
 	}
 }
 
-// 处理优惠券消息(使用自动看门狗的锁)
+var (
+	orderLock          utils.Locker
+	orderLockOnce      sync.Once
+	orderSemaphore     *utils.Semaphore
+	orderSemaphoreOnce sync.Once
+)
+
+// getOrderLock 订单锁在同一个实例上共享，可重入锁的看门狗由第一次加锁和最后一次解锁的实例管理
+// redlock 模式下主Redis故障切换时也不会出现同一个用户的两个订单锁持有者
+func getOrderLock() utils.Locker {
+	orderLockOnce.Do(func() {
+		orderLock = utils.NewLocker()
+	})
+	return orderLock
+}
+
+// getOrderSemaphore 订单写入信号量，许可的看门狗由获取许可的实例管理
+func getOrderSemaphore() *utils.Semaphore {
+	orderSemaphoreOnce.Do(func() {
+		orderSemaphore = utils.NewSemaphore(redisClient.GetRedisClient())
+	})
+	return orderSemaphore
+}
+
+func orderLockKey(userId int64) string {
+	return fmt.Sprintf("lock:order:%d", userId)
+}
+
+// 处理优惠券消息(使用自动看门狗的可重入锁)
 func processVoucherMessage(msg redisConfig.XMessage) error {
 	var order model.VoucherOrder
 	if err := mapstructure.Decode(msg.Values, &order); err != nil {
 		return err
 	}
 
-	lockKey := fmt.Sprintf("lock:order:%d", order.UserId)
-	lock := utils.NewDistributedLock(redisClient.GetRedisClient())
-
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
+	ctx = utils.WithLockOwner(ctx)
 
-	// 使用自动管理看门狗的锁
-	acquired, token, err := lock.LockWithWatchDog(ctx, lockKey, 10*time.Second)
-	if err != nil || !acquired {
+	lockKey := orderLockKey(order.UserId)
+	// 同一用户的订单串行处理，锁被占用时等待到超时为止
+	if _, err := getOrderLock().LockReentrantWait(ctx, lockKey, 10*time.Second); err != nil {
+		logrus.Warnf("获取订单锁失败(%s): %v", lockKey, err)
 		return errors.New("系统繁忙，请重试")
 	}
-	defer lock.UnlockWithWatchDog(ctx, lockKey, token)
+	// 解锁时需要使用同一个持有者，但不能受超时影响
+	defer getOrderLock().UnlockReentrant(context.WithoutCancel(ctx), lockKey, 10*time.Second)
 
-	return createVoucherOrder(order)
+	return createVoucherOrder(ctx, order)
 }
 
-// 创建优惠券订单
-func createVoucherOrder(order model.VoucherOrder) error {
-	// 直接执行事务，无需加锁
+// 创建优惠券订单，可以单独调用，也可以在已经持有用户锁的调用链中重入
+func createVoucherOrder(ctx context.Context, order model.VoucherOrder) error {
+	ctx = utils.WithLockOwner(ctx)
+	lockKey := orderLockKey(order.UserId)
+	lockCtx, err := getOrderLock().LockReentrantWait(ctx, lockKey, 10*time.Second)
+	if err != nil {
+		logrus.Warnf("获取订单锁失败(%s)，可以通过 /admin/locks?key=%s 查看持有者: %v", lockKey, lockKey, err)
+		return errors.New("系统繁忙，请重试")
+	}
+	defer getOrderLock().UnlockReentrant(context.WithoutCancel(ctx), lockKey, 10*time.Second)
+
+	// 限制同一张优惠券并发写订单的数量，减少库存行上的锁竞争
+	semaphoreKey := fmt.Sprintf("%s%d", utils.ORDER_SEMAPHORE_KEY, order.VoucherId)
+	permitCtx, permitId, err := getOrderSemaphore().Acquire(ctx, semaphoreKey, utils.ORDER_WRITER_PERMITS, 10*time.Second)
+	if err != nil {
+		logrus.Warnf("获取订单信号量失败(%s): %v", semaphoreKey, err)
+		return errors.New("系统繁忙，请重试")
+	}
+	defer getOrderSemaphore().Release(context.WithoutCancel(ctx), semaphoreKey, permitId)
+
 	return mysql.GetMysqlDB().Transaction(func(tx *gorm.DB) error {
 		// 保留一人一单检查（锁已保证安全，此检查可防极端情况）
 		purchasedFlag, err := new(model.VoucherOrder).HasPurchasedVoucher(order.UserId, order.VoucherId, tx)
@@ -279,6 +342,19 @@ func createVoucherOrder(order model.VoucherOrder) error {
 		// 创建订单
 		order.CreateTime = time.Now()
 		order.UpdateTime = time.Now()
-		return order.CreateVoucherOrder(tx)
+		if err := order.CreateVoucherOrder(tx); err != nil {
+			return err
+		}
+
+		// 提交之前确认仍然持有锁，看门狗续期失败时回滚，消息会留在Pending List中重试
+		if err := utils.CheckLock(lockCtx); err != nil {
+			logrus.Warnf("订单锁已丢失，回滚订单(用户%d): %v", order.UserId, err)
+			return err
+		}
+		if err := utils.CheckLock(permitCtx); err != nil {
+			logrus.Warnf("订单信号量许可已丢失，回滚订单(用户%d): %v", order.UserId, err)
+			return err
+		}
+		return nil
 	})
 }
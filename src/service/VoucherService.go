@@ -4,8 +4,8 @@ import (
 	"context"
 	"fmt"
 	"github.com/sirupsen/logrus"
+	"hmdp-Go/src/cache"
 	"hmdp-Go/src/config/mysql"
-	"hmdp-Go/src/config/redis"
 	"hmdp-Go/src/model"
 	"hmdp-Go/src/utils"
 	"strconv"
@@ -17,15 +17,32 @@ type VoucherService struct {
 
 var VoucherManager *VoucherService
 
+// 店铺的优惠券列表缓存，秒杀券的库存会变化，所以过期时间比较短
+var voucherCache = cache.New[int64, []model.Voucher](utils.CACHE_VOUCHER_KEY, func(_ context.Context, shopId int64) ([]model.Voucher, error) {
+	var vocherUtils model.Voucher
+	return vocherUtils.QueryVoucherByShop(shopId)
+}, cache.WithStrategy(cache.StrategyCacheAside), cache.WithTTL(30*time.Second, 10*time.Second))
+
 func (*VoucherService) AddVoucher(voucher *model.Voucher) error {
 	err := voucher.AddVoucher(mysql.GetMysqlDB())
-	return err
+	if err != nil {
+		return err
+	}
+	evictVoucherCache(voucher.ShopId)
+	return nil
 }
 
 // QueryVoucherOfShop 查询优惠卷
 func (*VoucherService) QueryVoucherOfShop(shopId int64) ([]model.Voucher, error) {
-	var vocherUtils model.Voucher
-	return vocherUtils.QueryVoucherByShop(shopId)
+	return voucherCache.Get(context.Background(), shopId)
+}
+
+func evictVoucherCache(shopId int64) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := voucherCache.Delete(ctx, shopId); err != nil {
+		logrus.Warnf("delete voucher cache of shop %d failed: %v", shopId, err)
+	}
 }
 
 func (vs *VoucherService) AddSeckillVoucher(voucher *model.Voucher) error {
@@ -57,39 +74,32 @@ func (vs *VoucherService) AddSeckillVoucher(voucher *model.Voucher) error {
 		return fmt.Errorf("写入秒杀表失败: %w", err)
 	}
 
-	// 4. 提交数据库事务（确保前两步完全成功）
+	// 4. 秒杀库存写入Redis、删除优惠券缓存和发布事件都写入发件箱，与数据库一起提交
+	// 库存在下单时会被扣减，只能初始化一次，重复投递不能覆盖
+	stockKey := utils.SECKILL_STOCK_KEY + strconv.FormatInt(voucher.Id, 10)
+	if err := OutboxManager.RedisInit(tx, stockKey, strconv.Itoa(voucher.Stock), 24*time.Hour); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("写入发件箱失败: %w", err)
+	}
+	if err := OutboxManager.CacheDelete(tx, []string{voucherCache.Key(voucher.ShopId)}); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("写入发件箱失败: %w", err)
+	}
+	event := map[string]string{
+		"type":      "seckill_voucher_created",
+		"voucherId": strconv.FormatInt(voucher.Id, 10),
+		"shopId":    strconv.FormatInt(voucher.ShopId, 10),
+		"stock":     strconv.Itoa(voucher.Stock),
+	}
+	if err := OutboxManager.Publish(tx, utils.EVENT_STREAM, event); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("写入发件箱失败: %w", err)
+	}
+
+	// 5. 提交数据库事务，提交后唤醒发件箱的投递任务
 	if err := tx.Commit().Error; err != nil {
 		return fmt.Errorf("事务提交失败: %w", err)
 	}
-
-	// 5. 事务成功后，异步更新Redis
-	go func() {
-		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
-		defer cancel()
-
-		redisKey := utils.SECKILL_STOCK_KEY + strconv.FormatInt(voucher.Id, 10)
-		if err := redis.GetRedisClient().Set(ctx, redisKey, voucher.Stock, 24*time.Hour).Err(); err != nil {
-			// Redis更新失败时，可通过以下方式补偿：
-			// a. 记录日志并报警
-			logrus.Errorf("Redis缓存更新失败: key=%s, error=%v", redisKey, err)
-			// b. 启动重试机制
-			retryUpdateRedis(redisKey, voucher.Stock)
-		}
-	}()
-
+	OutboxManager.Notify()
 	return nil
 }
-
-// 辅助函数：Redis更新重试
-func retryUpdateRedis(key string, stock int) {
-	for i := 0; i < 3; i++ {
-		time.Sleep(time.Duration(i+1) * time.Second) // 退避策略
-		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
-		err := redis.GetRedisClient().Set(ctx, key, stock, 24*time.Hour).Err()
-		cancel()
-		if err == nil {
-			return
-		}
-		logrus.Warnf("Redis重试%d次失败: %v", i+1, err)
-	}
-}
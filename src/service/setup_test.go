@@ -0,0 +1,86 @@
+package service
+
+import (
+	"database/sql"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/sqlite"
+	"github.com/redis/go-redis/v9"
+	"hmdp-Go/src/config/mysql"
+	redisClient "hmdp-Go/src/config/redis"
+	"hmdp-Go/src/model"
+)
+
+// 博客等缓存的本地缓存是包级别的，每个测试的自增id从不同的起点开始，避免读到其他测试留下的本地缓存
+var testIdBase atomic.Int64
+
+// setupTestStores 用内存中的 sqlite 和 miniredis 替换 MySQL 和 Redis，测试结束后恢复
+func setupTestStores(t *testing.T) *miniredis.Miniredis {
+	t.Helper()
+	// 内存数据库只存在于创建它的连接中，所有查询共用一个连接
+	sqlDB, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	db, err := gorm.Open("sqlite3", sqlDB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tables := []interface{ TableName() string }{
+		&model.Blog{}, &model.BlogComments{}, &model.User{}, &model.Report{}, &model.Outbox{}, &model.Follow{},
+		&model.MerchantApply{},
+	}
+	for _, table := range tables {
+		if err = db.Table(table.TableName()).AutoMigrate(table).Error; err != nil {
+			t.Fatalf("create table %s failed: %v", table.TableName(), err)
+		}
+	}
+	// 与 MySQL 中基于生成列的唯一索引相同：同一用户对同一内容只有一个待处理的举报
+	if err = db.Exec(fmt.Sprintf("CREATE UNIQUE INDEX uk_user_target_pending ON tb_report (user_id, target_type, target_id) WHERE status = %d",
+		model.REPORT_PENDING)).Error; err != nil {
+		t.Fatalf("create report index failed: %v", err)
+	}
+	idBase := testIdBase.Add(1_000_000)
+	for _, table := range []string{model.BLOG_TABLE_NAME, model.BLOG_COMMENTS_TABLE_NAME} {
+		if err = db.Exec("INSERT INTO sqlite_sequence (name, seq) VALUES (?, ?)", table, idBase).Error; err != nil {
+			t.Fatalf("set id base of %s failed: %v", table, err)
+		}
+	}
+
+	mr := miniredis.RunT(t)
+	oldDB, oldRDB := mysql.GetMysqlDB(), redisClient.GetRedisClient()
+	mysql.SetMysqlDB(db)
+	redisClient.SetRedisClient(redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+	t.Cleanup(func() {
+		mysql.SetMysqlDB(oldDB)
+		redisClient.SetRedisClient(oldRDB)
+		db.Close()
+	})
+	return mr
+}
+
+// createTestUser 创建用户，昵称为 user<id>
+func createTestUser(t *testing.T, id int64) {
+	t.Helper()
+	user := model.User{Id: id, NickName: fmt.Sprintf("user%d", id), Role: model.ROLE_USER, CreateTime: time.Now(), UpdateTime: time.Now()}
+	if err := mysql.GetMysqlDB().Table(user.TableName()).Create(&user).Error; err != nil {
+		t.Fatalf("create user %d failed: %v", id, err)
+	}
+}
+
+// createTestBlog 创建正常状态的博客，返回博客id
+func createTestBlog(t *testing.T, userId int64) int64 {
+	t.Helper()
+	blog := model.Blog{UserId: userId, Title: "title", Content: "content", Status: model.NORMAL, CreateTime: time.Now(), UpdateTime: time.Now()}
+	id, err := blog.SaveBlog(mysql.GetMysqlDB())
+	if err != nil {
+		t.Fatalf("create blog failed: %v", err)
+	}
+	return id
+}
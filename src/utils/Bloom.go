@@ -0,0 +1,16 @@
+package utils
+
+// Bloom 布隆过滤器的公共接口，进程内的 BloomFilter 和基于Redis的 RedisBloomFilter 都实现了该接口
+// CountingBloomFilter 额外支持删除，ScalableBloomFilter 在元素数量超过容量后自动扩容
+// Contains 返回 false 表示元素一定不存在
+type Bloom interface {
+	Add(data []byte)
+	Contains(data []byte) bool
+}
+
+var (
+	_ Bloom = (*BloomFilter)(nil)
+	_ Bloom = (*RedisBloomFilter)(nil)
+	_ Bloom = (*CountingBloomFilter)(nil)
+	_ Bloom = (*ScalableBloomFilter)(nil)
+)
@@ -2,8 +2,11 @@ package utils
 
 import (
 	"encoding/binary"
+	"errors"
 	"hash/fnv"
 	"math"
+	"math/bits"
+	"sync"
 )
 
 type BloomFilter struct {
@@ -11,6 +14,7 @@ type BloomFilter struct {
 	k        uint64                // 哈希函数数量
 	bits     []byte                // 位数组
 	hashFunc []func([]byte) uint64 // 哈希函数集
+	mutex    sync.RWMutex          // 保护位数组的并发读写
 }
 
 // NewBloomFilter 创建新的布隆过滤器
@@ -31,7 +35,17 @@ func NewBloomFilter(n uint64, p float64) *BloomFilter {
 	// 初始化位数组(按8位对齐)
 	bits := make([]byte, (m+7)/8)
 
-	// 初始化哈希函数
+	return &BloomFilter{
+		m:        m,
+		k:        k,
+		bits:     bits,
+		hashFunc: newHashFuncs(k),
+	}
+
+}
+
+// newHashFuncs 初始化 k 个使用不同种子的哈希函数
+func newHashFuncs(k uint64) []func([]byte) uint64 {
 	hashFunc := make([]func([]byte) uint64, k)
 	for i := range hashFunc {
 		seed := uint32(i)
@@ -39,14 +53,16 @@ func NewBloomFilter(n uint64, p float64) *BloomFilter {
 			return hashWithSeed(data, seed)
 		}
 	}
+	return hashFunc
+}
 
-	return &BloomFilter{
-		m:        m,
-		k:        k,
-		bits:     bits,
-		hashFunc: hashFunc,
+// bloomLocations 计算元素在 m 位的位数组中对应的 k 个位置
+func bloomLocations(hashFunc []func([]byte) uint64, m uint64, data []byte) []uint64 {
+	locations := make([]uint64, len(hashFunc))
+	for i, hashFn := range hashFunc {
+		locations[i] = hashFn(data) % m
 	}
-
+	return locations
 }
 
 // optimalM 计算最优的位数组大小
@@ -76,6 +92,8 @@ func hashWithSeed(data []byte, seed uint32) uint64 {
 
 // Add 添加元素到布隆过滤器
 func (bf *BloomFilter) Add(data []byte) {
+	bf.mutex.Lock()
+	defer bf.mutex.Unlock()
 	for _, hashFn := range bf.hashFunc {
 		// 计算哈希值并取模
 		hash := hashFn(data) % bf.m
@@ -91,6 +109,8 @@ func (bf *BloomFilter) Add(data []byte) {
 
 // Contains 检查元素是否可能在布隆过滤器中
 func (bf *BloomFilter) Contains(data []byte) bool {
+	bf.mutex.RLock()
+	defer bf.mutex.RUnlock()
 	for _, hashFn := range bf.hashFunc {
 		hash := hashFn(data) % bf.m
 		byteIndex := hash / 8
@@ -103,3 +123,53 @@ func (bf *BloomFilter) Contains(data []byte) bool {
 	}
 	return true
 }
+
+// EstimatedFalsePositiveRate 根据位数组中被置为1的比例估计当前的误判率
+func (bf *BloomFilter) EstimatedFalsePositiveRate() float64 {
+	bf.mutex.RLock()
+	defer bf.mutex.RUnlock()
+	var ones int
+	for _, b := range bf.bits {
+		ones += bits.OnesCount8(b)
+	}
+	return math.Pow(float64(ones)/float64(bf.m), float64(bf.k))
+}
+
+// bloomMagic 快照文件的格式标识
+var bloomMagic = []byte("BLM1")
+
+var ErrInvalidBloomSnapshot = errors.New("invalid bloom filter snapshot")
+
+// MarshalBinary 将布隆过滤器序列化为快照：magic(4) + m(8) + k(8) + 位数组
+func (bf *BloomFilter) MarshalBinary() ([]byte, error) {
+	bf.mutex.RLock()
+	defer bf.mutex.RUnlock()
+
+	data := make([]byte, 0, len(bloomMagic)+16+len(bf.bits))
+	data = append(data, bloomMagic...)
+	data = binary.BigEndian.AppendUint64(data, bf.m)
+	data = binary.BigEndian.AppendUint64(data, bf.k)
+	data = append(data, bf.bits...)
+	return data, nil
+}
+
+// UnmarshalBinary 从快照中恢复布隆过滤器
+func (bf *BloomFilter) UnmarshalBinary(data []byte) error {
+	header := len(bloomMagic) + 16
+	if len(data) < header || string(data[:len(bloomMagic)]) != string(bloomMagic) {
+		return ErrInvalidBloomSnapshot
+	}
+	m := binary.BigEndian.Uint64(data[len(bloomMagic):])
+	k := binary.BigEndian.Uint64(data[len(bloomMagic)+8:])
+	if m == 0 || k == 0 || uint64(len(data)-header) != (m+7)/8 {
+		return ErrInvalidBloomSnapshot
+	}
+
+	bf.mutex.Lock()
+	defer bf.mutex.Unlock()
+	bf.m = m
+	bf.k = k
+	bf.bits = append([]byte(nil), data[header:]...)
+	bf.hashFunc = newHashFuncs(k)
+	return nil
+}
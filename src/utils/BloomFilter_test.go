@@ -38,3 +38,32 @@ func TestBloomFilter(t *testing.T) {
 		}
 	}
 }
+
+func TestBloomFilterSnapshot(t *testing.T) {
+	bf := NewBloomFilter(1000, 0.01)
+	for i := 0; i < 500; i++ {
+		bf.Add([]byte(fmt.Sprintf("shop:%d", i)))
+	}
+	data, err := bf.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var restored BloomFilter
+	if err = restored.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 1000; i++ {
+		key := []byte(fmt.Sprintf("shop:%d", i))
+		if bf.Contains(key) != restored.Contains(key) {
+			t.Fatalf("restored filter differs on %s", key)
+		}
+	}
+
+	if err = restored.UnmarshalBinary(data[:len(data)-1]); err == nil {
+		t.Fatal("expected error for truncated snapshot")
+	}
+	if err = restored.UnmarshalBinary([]byte("invalid")); err == nil {
+		t.Fatal("expected error for invalid snapshot")
+	}
+}
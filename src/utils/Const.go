@@ -5,5 +5,80 @@ const (
 	DEFAULTPAGESIZE = 5
 	UPLOADPATH      = "/home/loser/project/Hmdp/Hmdp-java/hmdp/nginx-1.18.0/html/hmdp/imgs"
 
+	COMMENT_PAGE_SIZE     = 10
+	COMMENT_REPLY_PREVIEW = 3   // 评论列表中每条一级评论附带的回复数
+	COMMENT_MAX_LENGTH    = 500 // 评论的最大字数
+
+	REPORT_REASON_MAX_LENGTH   = 200 // 举报理由的最大字数
+	REPORT_AUTO_HIDE_THRESHOLD = 5   // 被这么多不同用户举报后自动隐藏，等待审核
+
 	USER_NICK_NAME_PREFIX = "user_"
+	NICK_NAME_MAX_LENGTH  = 20
+
+	SMS_SENDER_TYPE   = "log" // log | file
+	SMS_FILE_PATH     = "sms.log"
+	SMS_CODE_TEMPLATE = "【黑马点评】您的验证码为%s，%d分钟内有效，请勿泄露给他人。"
+
+	// 店铺查询的缓存策略: none | cache-aside | null-cache | mutex | logical-expire | bloom-null
+	// 环境变量 SHOP_CACHE_STRATEGY_ENV 可以覆盖默认值，Redis中的功能开关可以按请求类别(用户角色)在运行时覆盖
+	SHOP_CACHE_STRATEGY         = "null-cache"
+	SHOP_CACHE_STRATEGY_ENV     = "HMDP_SHOP_CACHE_STRATEGY"
+	SHOP_CACHE_HOT_KEY_PROMOTE  = true // 是否把探测到的热点店铺切换为逻辑过期
+	SHOP_CACHE_STRATEGY_REFRESH = 10   // 功能开关的刷新间隔(秒)
+
+	// 布隆过滤器：定时重建以清除已删除的id
+	// memory 模式每个实例各自维护，并保存快照加快重启；redis 模式所有实例共享同一份位数组
+	BLOOM_MODE                = "memory" // memory | redis
+	BLOOM_REBUILD_INTERVAL    = 30 * 60  // 秒
+	BLOOM_MIN_CAPACITY        = 10000
+	BLOOM_REDIS_CAPACITY      = 1000000 // redis 模式下所有实例必须使用相同的容量
+	BLOOM_FALSE_POSITIVE_RATE = 0.001
+	BLOOM_SNAPSHOT_DIR        = "data/bloom"
+
+	// 事务发件箱
+	OUTBOX_POLL_INTERVAL       = 500 // 毫秒
+	OUTBOX_BATCH_SIZE          = 100
+	OUTBOX_MAX_ATTEMPTS        = 10
+	OUTBOX_LAST_ERROR_LENGTH   = 1024 // 失败原因最多保存的字符数，与 last_error 列的长度一致
+	OUTBOX_RETENTION           = 24   // 投递成功的事件保留的小时数
+	OUTBOX_DOUBLE_DELETE_DELAY = 1    // 延迟双删的间隔(秒)
+
+	// 关注流：粉丝数少于 FEED_PUSH_THRESHOLD 的作者发布的博客异步分批推送到粉丝的收件箱(推模式)，
+	// 其余作者的博客只写入作者的发件箱，粉丝查询时拉取并合并(拉模式)
+	FEED_PUSH_THRESHOLD    = 5000
+	FEED_FANOUT_BATCH      = 500  // 每批推送的粉丝数，一批使用一个 pipeline
+	FEED_BOX_MAX_SIZE      = 1000 // 收件箱和发件箱保留的最大博客数
+	FEED_FANOUT_CLAIM_IDLE = 60   // 推送失败或实例宕机时，未确认的消息在空闲这么多秒后被重新认领
+	FEED_BIG_FOLLOWING_TTL = 300  // 用户关注的拉模式作者的缓存时间(秒)
+
+	// 删除博客后清理图片的延迟(秒)，在此之前恢复的博客保留图片
+	BLOG_IMAGE_CLEANUP_DELAY = 7 * 24 * 60 * 60
+
+	// 读写锁和信号量
+	SHOP_READ_LOCK_WAIT  = 500 // 加载店铺时等待写锁释放的最长时间(毫秒)
+	ORDER_WRITER_PERMITS = 10  // 每张优惠券同时写入订单的最大并发数
+
+	// 全局id: incr 每个id访问一次Redis；segment 每个实例一次预留一段序号，在本地发放
+	ID_MODE             = "segment" // incr | segment
+	ID_SEGMENT_SIZE     = 1000
+	ID_SEGMENT_PREFETCH = 0.2 // 剩余序号少于这个比例时提前预留下一段
+	ID_COUNT_KEY_TTL    = 2   // 每天的计数器保留的天数
+
+	// 订单等业务使用的id生成器: redis 使用 RedisWorker；snowflake 在本地生成，不需要访问Redis
+	// 可以从 redis 切换到 snowflake(id仍然递增)，反过来切换会生成更小的id
+	ID_GENERATOR           = "redis" // redis | snowflake
+	SNOWFLAKE_WORKER_ID    = -1      // 机器id，-1 表示从Redis租用
+	SNOWFLAKE_LEASE_TTL    = 600     // 机器id租约的有效期(秒)
+	SNOWFLAKE_MAX_BACKWARD = 5       // 可以等待的最大时钟回拨(毫秒)
+
+	// 敏感词：词库文件修改后自动重新加载；每类内容的处理策略为 reject | mask | review
+	SENSITIVE_WORDS_PATH      = "resource/sensitive_words.txt"
+	SENSITIVE_RELOAD_INTERVAL = 10 // 检查词库文件是否修改的间隔(秒)
+	SENSITIVE_POLICY_BLOG     = "review"
+	SENSITIVE_POLICY_COMMENT  = "mask"
+	SENSITIVE_POLICY_NICKNAME = "reject" // 昵称无法隐藏，review 按 reject 处理
 )
+
+// TRUSTED_PROXIES 可信的反向代理(nginx)，只有来自这些地址的请求才会从 X-Forwarded-For 中取客户端IP，
+// 其余请求直接使用连接的地址，避免伪造请求头绕过按IP的限流
+var TRUSTED_PROXIES = []string{"127.0.0.1", "::1"}
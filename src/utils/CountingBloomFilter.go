@@ -0,0 +1,97 @@
+package utils
+
+import (
+	"math"
+	"sync"
+)
+
+// CountingBloomFilter 计数布隆过滤器，每个位置使用一个计数器代替单个位，因此支持删除元素
+// 计数器达到上限后不再变化，避免删除时出现假阴性
+type CountingBloomFilter struct {
+	m        uint64
+	k        uint64
+	counters []uint8
+	nonZero  uint64 // 不为0的计数器数量，用于估计误判率
+	hashFunc []func([]byte) uint64
+	mutex    sync.RWMutex
+}
+
+// NewCountingBloomFilter 创建计数布隆过滤器，参数含义与 NewBloomFilter 相同
+// 每个计数器占用 1 个字节，内存是普通布隆过滤器的 8 倍
+func NewCountingBloomFilter(n uint64, p float64) *CountingBloomFilter {
+	if p <= 0 || p >= 1 {
+		panic("false positive rate must be between 0 and 1")
+	}
+	if n == 0 {
+		panic("number of elements must be positive")
+	}
+	m := optimalM(n, p)
+	k := optimalK(n, m)
+	return &CountingBloomFilter{
+		m:        m,
+		k:        k,
+		counters: make([]uint8, m),
+		hashFunc: newHashFuncs(k),
+	}
+}
+
+// Add 添加元素
+func (cbf *CountingBloomFilter) Add(data []byte) {
+	cbf.mutex.Lock()
+	defer cbf.mutex.Unlock()
+	for _, location := range bloomLocations(cbf.hashFunc, cbf.m, data) {
+		switch cbf.counters[location] {
+		case math.MaxUint8:
+			// 计数器已饱和，不再增加
+		case 0:
+			cbf.nonZero++
+			cbf.counters[location]++
+		default:
+			cbf.counters[location]++
+		}
+	}
+}
+
+// Contains 检查元素是否可能存在
+func (cbf *CountingBloomFilter) Contains(data []byte) bool {
+	cbf.mutex.RLock()
+	defer cbf.mutex.RUnlock()
+	for _, location := range bloomLocations(cbf.hashFunc, cbf.m, data) {
+		if cbf.counters[location] == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Remove 删除元素，元素一定不存在时返回 false
+// 只能删除确实添加过的元素，删除从未添加过的元素(误判)会导致其他元素出现假阴性
+func (cbf *CountingBloomFilter) Remove(data []byte) bool {
+	cbf.mutex.Lock()
+	defer cbf.mutex.Unlock()
+	locations := bloomLocations(cbf.hashFunc, cbf.m, data)
+	for _, location := range locations {
+		if cbf.counters[location] == 0 {
+			return false
+		}
+	}
+	for _, location := range locations {
+		switch cbf.counters[location] {
+		case math.MaxUint8:
+			// 饱和的计数器无法知道真实的次数，保持不变
+		case 1:
+			cbf.nonZero--
+			cbf.counters[location]--
+		default:
+			cbf.counters[location]--
+		}
+	}
+	return true
+}
+
+// EstimatedFalsePositiveRate 根据不为0的计数器比例估计当前的误判率
+func (cbf *CountingBloomFilter) EstimatedFalsePositiveRate() float64 {
+	cbf.mutex.RLock()
+	defer cbf.mutex.RUnlock()
+	return math.Pow(float64(cbf.nonZero)/float64(cbf.m), float64(cbf.k))
+}
@@ -0,0 +1,73 @@
+package utils
+
+import (
+	"fmt"
+	"testing"
+)
+
+// measureFalsePositiveRate 用从未添加过的元素统计实际的误判率
+func measureFalsePositiveRate(bf Bloom, trials int) float64 {
+	falsePositives := 0
+	for i := 0; i < trials; i++ {
+		if bf.Contains([]byte(fmt.Sprintf("absent:%d", i))) {
+			falsePositives++
+		}
+	}
+	return float64(falsePositives) / float64(trials)
+}
+
+func TestCountingBloomFilter(t *testing.T) {
+	const n, p = 10000, 0.01
+	cbf := NewCountingBloomFilter(n, p)
+	for i := 0; i < n; i++ {
+		cbf.Add([]byte(fmt.Sprintf("shop:%d", i)))
+	}
+
+	observed := measureFalsePositiveRate(cbf, 100000)
+	estimated := cbf.EstimatedFalsePositiveRate()
+	if observed > 2*p {
+		t.Fatalf("observed false positive rate %.4f exceeds %.4f", observed, 2*p)
+	}
+	if estimated < observed/2 || estimated > observed*2 {
+		t.Fatalf("estimated rate %.4f is far from observed %.4f", estimated, observed)
+	}
+
+	// 删除一半元素，剩余元素不能出现假阴性
+	for i := 0; i < n/2; i++ {
+		if !cbf.Remove([]byte(fmt.Sprintf("shop:%d", i))) {
+			t.Fatalf("remove shop:%d failed", i)
+		}
+	}
+	for i := n / 2; i < n; i++ {
+		if !cbf.Contains([]byte(fmt.Sprintf("shop:%d", i))) {
+			t.Fatalf("false negative on shop:%d", i)
+		}
+	}
+	removedPresent := 0
+	for i := 0; i < n/2; i++ {
+		if cbf.Contains([]byte(fmt.Sprintf("shop:%d", i))) {
+			removedPresent++
+		}
+	}
+	// 删除后的元素只会因为误判而被认为存在
+	if rate := float64(removedPresent) / float64(n/2); rate > 2*p {
+		t.Fatalf("removed elements still present at rate %.4f", rate)
+	}
+	if after := cbf.EstimatedFalsePositiveRate(); after >= estimated {
+		t.Fatalf("estimated rate should drop after removal, before %.4f after %.4f", estimated, after)
+	}
+}
+
+func TestCountingBloomFilterSaturation(t *testing.T) {
+	cbf := NewCountingBloomFilter(10, 0.01)
+	for i := 0; i < 300; i++ {
+		cbf.Add([]byte("hot"))
+	}
+	for i := 0; i < 300; i++ {
+		cbf.Remove([]byte("hot"))
+	}
+	// 计数器饱和后不再递减，元素仍然存在而不是出现假阴性
+	if !cbf.Contains([]byte("hot")) {
+		t.Fatal("saturated counters should keep the element present")
+	}
+}
@@ -0,0 +1,29 @@
+package utils
+
+import (
+	"context"
+	"time"
+
+	redisClient "hmdp-Go/src/config/redis"
+)
+
+// IdGenerator 全局唯一id生成器，keyPrefix 区分业务
+type IdGenerator interface {
+	NextId(keyPrefix string) (int64, error)
+}
+
+var (
+	_ IdGenerator = (*RedisWorker)(nil)
+	_ IdGenerator = (*Snowflake)(nil)
+)
+
+// NewIdGenerator 按 ID_GENERATOR 配置创建id生成器
+func NewIdGenerator(ctx context.Context) (IdGenerator, error) {
+	if ID_GENERATOR != "snowflake" {
+		return &RedisWorker{}, nil
+	}
+	if SNOWFLAKE_WORKER_ID >= 0 {
+		return NewSnowflake(SNOWFLAKE_WORKER_ID)
+	}
+	return NewLeasedSnowflake(ctx, redisClient.GetRedisClient(), SNOWFLAKE_LEASE_TTL*time.Second)
+}
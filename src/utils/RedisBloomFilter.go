@@ -0,0 +1,114 @@
+package utils
+
+import (
+	"context"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+)
+
+// redisBloomBatchSize 批量写入时每个pipeline包含的元素数量
+const redisBloomBatchSize = 1000
+
+// RedisBloomFilter 位数组保存在Redis中的布隆过滤器，所有实例共享同一份数据，重启后不会丢失
+// 每次 Add/Contains 的 k 个位操作通过一次pipeline完成
+type RedisBloomFilter struct {
+	client   *redis.Client
+	key      string
+	m        uint64
+	k        uint64
+	hashFunc []func([]byte) uint64
+}
+
+// NewRedisBloomFilter 创建基于Redis的布隆过滤器，参数含义与 NewBloomFilter 相同
+// 相同 key 的过滤器在所有实例上必须使用相同的 n 和 p
+func NewRedisBloomFilter(client *redis.Client, key string, n uint64, p float64) *RedisBloomFilter {
+	if p <= 0 || p >= 1 {
+		panic("false positive rate must be between 0 and 1")
+	}
+	if n == 0 {
+		panic("number of elements must be positive")
+	}
+	m := optimalM(n, p)
+	k := optimalK(n, m)
+	return &RedisBloomFilter{
+		client:   client,
+		key:      key,
+		m:        m,
+		k:        k,
+		hashFunc: newHashFuncs(k),
+	}
+}
+
+// Key 返回保存位数组的Redis key
+func (bf *RedisBloomFilter) Key() string {
+	return bf.key
+}
+
+// Add 添加元素，Redis不可用时只记录日志，需要确认写入的调用方使用 AddAll
+func (bf *RedisBloomFilter) Add(data []byte) {
+	if err := bf.AddAll(context.Background(), data); err != nil {
+		logrus.Warnf("bloom filter %s add failed: %v", bf.key, err)
+	}
+}
+
+// AddAll 批量添加元素
+func (bf *RedisBloomFilter) AddAll(ctx context.Context, items ...[]byte) error {
+	return bf.addTo(ctx, bf.key, items)
+}
+
+// Contains 检查元素是否可能存在，Redis不可用时返回 true，退化为不过滤
+func (bf *RedisBloomFilter) Contains(data []byte) bool {
+	ctx := context.Background()
+	pipe := bf.client.Pipeline()
+	cmds := make([]*redis.IntCmd, 0, bf.k)
+	for _, location := range bloomLocations(bf.hashFunc, bf.m, data) {
+		cmds = append(cmds, pipe.GetBit(ctx, bf.key, int64(location)))
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		logrus.Warnf("bloom filter %s contains failed: %v", bf.key, err)
+		return true
+	}
+	for _, cmd := range cmds {
+		if cmd.Val() == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Exists 判断Redis中是否已经有该过滤器的数据
+func (bf *RedisBloomFilter) Exists(ctx context.Context) (bool, error) {
+	n, err := bf.client.Exists(ctx, bf.key).Result()
+	return n > 0, err
+}
+
+// Rebuild 用全量数据重建过滤器：先写入临时key，再通过RENAME原子替换，重建期间读取不受影响
+// RENAME会丢弃重建期间其他实例写入旧key的元素，调用方需要保证同一时间只有一个实例重建，并在替换后补充这些元素
+func (bf *RedisBloomFilter) Rebuild(ctx context.Context, items ...[]byte) error {
+	if len(items) == 0 {
+		return bf.client.Del(ctx, bf.key).Err()
+	}
+	tmpKey := bf.key + ":rebuilding:" + RandomUtil.GenerateRandomStr(8)
+	if err := bf.addTo(ctx, tmpKey, items); err != nil {
+		bf.client.Del(ctx, tmpKey)
+		return err
+	}
+	return bf.client.Rename(ctx, tmpKey, bf.key).Err()
+}
+
+func (bf *RedisBloomFilter) addTo(ctx context.Context, key string, items [][]byte) error {
+	for start := 0; start < len(items); start += redisBloomBatchSize {
+		end := min(start+redisBloomBatchSize, len(items))
+		pipe := bf.client.Pipeline()
+		for _, data := range items[start:end] {
+			for _, location := range bloomLocations(bf.hashFunc, bf.m, data) {
+				pipe.SetBit(ctx, key, int64(location), 1)
+			}
+		}
+		if _, err := pipe.Exec(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestRedisBloomFilter(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	ctx := context.Background()
+
+	bf := NewRedisBloomFilter(rdb, "bloom:shop", 1000, 0.01)
+	bf.Add([]byte("1"))
+	if !bf.Contains([]byte("1")) {
+		t.Fatal("expected 1 to be present")
+	}
+
+	// 另一个实例使用同一个key，可以看到相同的数据
+	other := NewRedisBloomFilter(rdb, "bloom:shop", 1000, 0.01)
+	if !other.Contains([]byte("1")) {
+		t.Fatal("filter should be shared across instances")
+	}
+
+	items := make([][]byte, 0, 500)
+	for i := 100; i < 600; i++ {
+		items = append(items, []byte(fmt.Sprint(i)))
+	}
+	if err := bf.Rebuild(ctx, items...); err != nil {
+		t.Fatal(err)
+	}
+	if keys := mr.Keys(); len(keys) != 1 || keys[0] != "bloom:shop" {
+		t.Fatalf("temporary key should be renamed, but get %v", keys)
+	}
+	for _, item := range items {
+		if !bf.Contains(item) {
+			t.Fatalf("expected %s to be present after rebuild", item)
+		}
+	}
+	falsePositives := 0
+	for i := 10000; i < 11000; i++ {
+		if bf.Contains([]byte(fmt.Sprint(i))) {
+			falsePositives++
+		}
+	}
+	if falsePositives > 50 {
+		t.Fatalf("too many false positives: %d", falsePositives)
+	}
+
+	// Redis不可用时放行
+	mr.Close()
+	if !bf.Contains([]byte("absent")) {
+		t.Fatal("expected fail open when redis is down")
+	}
+}
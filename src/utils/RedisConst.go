@@ -2,17 +2,51 @@ package utils
 
 const (
 	LOGIN_CODE_KEY       = "login:code:"
+	LOGIN_CODE_FAIL_KEY  = "login:code:fail:"
+	LOGIN_INTERVAL_KEY   = "login:code:interval:"
+	LOGIN_DAILY_KEY      = "login:code:daily:"
 	CACHE_SHOP_KEY       = "cache:shop:"
+	CACHE_SHOP_LOGIC_KEY = "cache:shop:logic:"
+	CACHE_SHOP_TYPE_KEY  = "cache:shop-type:"
+	CACHE_BLOG_KEY       = "cache:blog:"
+	CACHE_COMMENTS_KEY   = "cache:blog:comments:"
+	CACHE_USER_KEY       = "cache:user:"
+	CACHE_VOUCHER_KEY    = "cache:voucher:shop:"
 	CACHE_SHOP_LIST      = "shop:list"
 	CACHE_LOCK_KEY       = "shop:lock:"
 	SECKILL_STOCK_KEY    = "seckill:stock:"
 	BLOG_LIKE_KEY        = "blog:like:"
 	FOLLOW_USER_KEY      = "follow:"
 	FEED_KEY             = "feed:"
+	FEED_AUTHOR_KEY      = "feed:author:"
+	FEED_BIG_AUTHORS_KEY = "feed:big-authors"
+	FEED_BIG_AUTHORS_VER = "feed:big-authors:version" // 拉模式作者增加时加一
+	FEED_BIG_FOLLOWING   = "feed:big-following:"      // 用户关注的拉模式作者，格式为 版本|id,id
 	SHOP_GEO_KEY         = "shop:geo:"
 	USER_SIGN_KEY        = "sign:"
 	DISTRIBUTED_LOCK_KEY = "lock:voucher:"
 	UVKeyPrefix          = "uv:"
+	RATE_LIMIT_KEY       = "rate:limit:"
+	BLOOM_KEY            = "bloom:"
+	ID_COUNT_KEY         = "icr:"
+	SNOWFLAKE_WORKER_KEY = "snowflake:worker:"
+
+	LOCK_UNLOCK_CHANNEL    = "lock:unlock:"
+	LOCK_META_KEY          = "lockmeta:"
+	LOCK_AUDIT_STREAM      = "stream.lock.audit"
+	OUTBOX_RELAY_LOCK_KEY  = "lock:outbox:relay"
+	BLOOM_REBUILD_LOCK_KEY = "lock:bloom:rebuild:"
+	SHOP_RW_LOCK_KEY       = "lock:shop:rw:"
+	ORDER_SEMAPHORE_KEY    = "semaphore:order:"
+	EVENT_STREAM           = "stream.events"
+	EVENT_STREAM_MAX_LEN   = 100000
+	FEED_FANOUT_STREAM     = "stream.feed.fanout"
+	FEED_FANOUT_GROUP      = "g1"
+
+	FEATURE_SHOP_CACHE_STRATEGY_KEY = "feature:shop:cache:strategy"
+
+	CACHE_INVALIDATE_CHANNEL = "cache:invalidate"
+	BLOOM_ADD_CHANNEL        = "bloom:add"
 )
 
 const (
@@ -23,3 +57,26 @@ const (
 	LOGIN_VERIFY_CODE_TTL = 2
 	HOT_KEY_EXISTS_TIME   = 10
 )
+
+// 热点店铺探测：HOT_SHOP_WINDOW 秒内访问次数达到阈值成为热点，低于冷却阈值后降级
+const (
+	HOT_SHOP_WINDOW         = 60
+	HOT_SHOP_THRESHOLD      = 300
+	HOT_SHOP_COOL_THRESHOLD = 60
+)
+
+// 热门博客的评论：HOT_COMMENTS_WINDOW 秒内评论第一页的访问次数达到阈值时缓存第一页，低于冷却阈值后删除缓存
+const (
+	HOT_COMMENTS_WINDOW         = 60
+	HOT_COMMENTS_THRESHOLD      = 100
+	HOT_COMMENTS_COOL_THRESHOLD = 20
+)
+
+// 验证码发送频率与校验次数限制
+const (
+	LOGIN_CODE_SEND_INTERVAL   = 60 // 同一手机号/IP两次发送的最小间隔(秒)
+	LOGIN_CODE_PHONE_DAILY_MAX = 10 // 每个手机号每天最多发送次数
+	LOGIN_CODE_IP_DAILY_MAX    = 20 // 每个IP每天最多发送次数
+	LOGIN_CODE_MAX_FAIL_TIMES  = 5  // 验证码最多可以输错的次数，超过后验证码失效
+	LOGIN_CODE_DAILY_KEY_TTL   = 24 * 60 * 60
+)
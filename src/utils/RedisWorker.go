@@ -2,8 +2,13 @@ package utils
 
 import (
 	"context"
-	"hmdp-Go/src/config/redis"
+	"errors"
+	"sync"
 	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+	redisClient "hmdp-Go/src/config/redis"
 )
 
 type RedisWorker struct {
@@ -14,21 +19,168 @@ var RedisWork *RedisWorker
 const (
 	BEGIN_TIMESTAMP int64 = 1704067201
 	COUNT_BITS            = 32
+	COUNT_MASK            = 1<<COUNT_BITS - 1
+)
+
+// ErrIdExhausted 当天的序号超过了 32 位
+var ErrIdExhausted = errors.New("id count of today is exhausted")
+
+var (
+	idSegments     *segmentAllocator
+	idSegmentsOnce sync.Once
 )
 
+// NextId 生成全局唯一id：高位为相对 BEGIN_TIMESTAMP 的秒数，低 32 位为当天的序号
+// ID_MODE 为 segment 时每个实例一次预留 ID_SEGMENT_SIZE 个序号在本地发放，否则每个id访问一次Redis
 func (*RedisWorker) NextId(keyPrefix string) (int64, error) {
 	now := time.Now()
-	nowSecond := now.UTC().Unix()
-	timeStamp := nowSecond - BEGIN_TIMESTAMP
-	format := now.Format("2006:01:02")
 
-	ctx, cancel := context.WithCancel(context.Background())
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	count, err := redis.GetRedisClient().Incr(ctx, "icr:"+keyPrefix+":"+format).Result()
+	var count int64
+	var err error
+	if ID_MODE == "segment" {
+		idSegmentsOnce.Do(func() {
+			idSegments = newSegmentAllocator(redisClient.GetRedisClient(), ID_SEGMENT_SIZE)
+		})
+		count, err = idSegments.next(ctx, keyPrefix, now)
+	} else {
+		count, err = incrIdCount(ctx, redisClient.GetRedisClient(), idCountKey(keyPrefix, now), 1)
+	}
 	if err != nil {
 		return 0, err
 	}
+	if count > COUNT_MASK {
+		return 0, ErrIdExhausted
+	}
+
+	return composeId(now, count), nil
+}
+
+// DecodeId 解析 NextId 生成的id，返回生成时间(精确到秒)和当天的序号，用于排查订单
+// Snowflake 生成的id按 DecodeSnowflakeId 解析，返回生成时间和序号
+func DecodeId(id int64) (time.Time, int64) {
+	if IsSnowflakeId(id) {
+		ts, _, sequence := DecodeSnowflakeId(id)
+		return ts, sequence
+	}
+	return time.Unix(id>>COUNT_BITS+BEGIN_TIMESTAMP, 0), id & COUNT_MASK
+}
+
+func composeId(now time.Time, count int64) int64 {
+	timeStamp := now.UTC().Unix() - BEGIN_TIMESTAMP
+	return timeStamp<<COUNT_BITS | count
+}
+
+// idCountKey 每天一个计数器，序号在当天内唯一
+func idCountKey(keyPrefix string, now time.Time) string {
+	return ID_COUNT_KEY + keyPrefix + ":" + now.Format("2006:01:02")
+}
+
+// incrIdCount 计数器加 n 并返回结果，计数器在 ID_COUNT_KEY_TTL 天后过期，必须长于一天，否则同一天的序号会重复
+func incrIdCount(ctx context.Context, client *redis.Client, key string, n int64) (int64, error) {
+	var incr *redis.IntCmd
+	_, err := client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		incr = pipe.IncrBy(ctx, key, n)
+		pipe.Expire(ctx, key, ID_COUNT_KEY_TTL*24*time.Hour)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return incr.Val(), nil
+}
+
+// segmentAllocator 号段分配：每个前缀在本地持有一段序号 [next, end]，用完后再从Redis预留一段，
+// 剩余不足 ID_SEGMENT_PREFETCH 比例时在后台提前预留下一段，实例重启时未发放的序号会被跳过
+type segmentAllocator struct {
+	client   *redis.Client
+	size     int64
+	mutex    sync.Mutex
+	segments map[string]*idSegment
+}
+
+type idSegment struct {
+	mutex    sync.Mutex
+	day      string
+	next     int64
+	end      int64
+	buffered *idRange // 提前预留的下一段
+	loading  bool
+}
+
+type idRange struct {
+	day        string
+	start, end int64
+}
+
+func newSegmentAllocator(client *redis.Client, size int64) *segmentAllocator {
+	return &segmentAllocator{client: client, size: size, segments: make(map[string]*idSegment)}
+}
+
+func (a *segmentAllocator) segment(keyPrefix string) *idSegment {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	seg, ok := a.segments[keyPrefix]
+	if !ok {
+		seg = &idSegment{}
+		a.segments[keyPrefix] = seg
+	}
+	return seg
+}
+
+// next 返回 now 当天的下一个序号
+func (a *segmentAllocator) next(ctx context.Context, keyPrefix string, now time.Time) (int64, error) {
+	seg := a.segment(keyPrefix)
+	day := now.Format("2006:01:02")
+
+	seg.mutex.Lock()
+	defer seg.mutex.Unlock()
+
+	// 当前号段用完或者已经跨天，优先使用提前预留的号段
+	if seg.day != day || seg.next > seg.end {
+		if seg.buffered != nil && seg.buffered.day == day {
+			seg.day, seg.next, seg.end = day, seg.buffered.start, seg.buffered.end
+			seg.buffered = nil
+		} else {
+			r, err := a.reserve(ctx, keyPrefix, now)
+			if err != nil {
+				return 0, err
+			}
+			seg.day, seg.next, seg.end = day, r.start, r.end
+		}
+	}
 
-	return timeStamp<<COUNT_BITS | count, nil
+	count := seg.next
+	seg.next++
+	if !seg.loading && seg.buffered == nil && seg.end-seg.next < int64(float64(a.size)*ID_SEGMENT_PREFETCH) {
+		seg.loading = true
+		go a.prefetch(seg, keyPrefix, now)
+	}
+	return count, nil
+}
+
+func (a *segmentAllocator) prefetch(seg *idSegment, keyPrefix string, now time.Time) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	r, err := a.reserve(ctx, keyPrefix, now)
+
+	seg.mutex.Lock()
+	defer seg.mutex.Unlock()
+	seg.loading = false
+	if err != nil {
+		logrus.Warnf("prefetch id segment of %s failed: %v", keyPrefix, err)
+		return
+	}
+	seg.buffered = &r
+}
+
+// reserve 从Redis预留一段序号
+func (a *segmentAllocator) reserve(ctx context.Context, keyPrefix string, now time.Time) (idRange, error) {
+	end, err := incrIdCount(ctx, a.client, idCountKey(keyPrefix, now), a.size)
+	if err != nil {
+		return idRange{}, err
+	}
+	return idRange{day: now.Format("2006:01:02"), start: end - a.size + 1, end: end}, nil
 }
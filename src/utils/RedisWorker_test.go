@@ -0,0 +1,87 @@
+package utils
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestSegmentAllocator(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	now := time.Now()
+
+	// 两个实例并发发放，序号不重复
+	allocators := []*segmentAllocator{newSegmentAllocator(client, 100), newSegmentAllocator(client, 100)}
+	var mutex sync.Mutex
+	seen := make(map[int64]bool)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 250; j++ {
+				count, err := allocators[i%2].next(context.Background(), "order", now)
+				if err != nil {
+					t.Errorf("next failed: %v", err)
+					return
+				}
+				mutex.Lock()
+				if seen[count] {
+					t.Errorf("duplicate count %d", count)
+				}
+				seen[count] = true
+				mutex.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if len(seen) != 2500 {
+		t.Fatalf("expected 2500 counts, but get %d", len(seen))
+	}
+
+	key := idCountKey("order", now)
+	if ttl := mr.TTL(key); ttl <= 24*time.Hour {
+		t.Fatalf("count key should expire after more than one day, but get %v", ttl)
+	}
+	// 号段按整段预留，Redis中的计数器只会比已发放的序号多出预留的部分
+	total, _ := client.Get(context.Background(), key).Int64()
+	if total%100 != 0 || total < 2500 || total > 2500+4*100 {
+		t.Fatalf("unexpected reserved total %d", total)
+	}
+}
+
+func TestSegmentAllocatorNextDay(t *testing.T) {
+	mr := miniredis.RunT(t)
+	allocator := newSegmentAllocator(redis.NewClient(&redis.Options{Addr: mr.Addr()}), 100)
+	today := time.Date(2026, 1, 1, 23, 59, 59, 0, time.Local)
+
+	for i := 0; i < 3; i++ {
+		if _, err := allocator.next(context.Background(), "order", today); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 跨天后从新的计数器重新预留，不继续使用前一天的号段
+	count, err := allocator.next(context.Background(), "order", today.Add(time.Second))
+	if err != nil || count != 1 {
+		t.Fatalf("expected count 1 on the next day, but get %d %v", count, err)
+	}
+}
+
+func TestDecodeId(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 30, 45, 0, time.UTC)
+	id := composeId(now, 123456)
+	ts, count := DecodeId(id)
+	if !ts.Equal(now) || count != 123456 {
+		t.Fatalf("expected %v and 123456, but get %v and %d", now, ts, count)
+	}
+
+	// 与原来的布局兼容：高位为秒数，低 32 位为序号
+	if id != (now.Unix()-BEGIN_TIMESTAMP)<<32|123456 {
+		t.Fatalf("id layout changed: %d", id)
+	}
+}
@@ -0,0 +1,89 @@
+package utils
+
+import (
+	"sync"
+)
+
+const (
+	scalableGrowth     = 2   // 每一层的容量是上一层的倍数
+	scalableTightening = 0.5 // 每一层的误判率是上一层的倍数，保证总的误判率收敛
+)
+
+// ScalableBloomFilter 可扩容的布隆过滤器，当前层的元素数量达到容量后自动增加新的一层
+// 总误判率不超过 p / (1 - scalableTightening)
+type ScalableBloomFilter struct {
+	layers []*scalableLayer
+	mutex  sync.RWMutex
+}
+
+type scalableLayer struct {
+	filter   *BloomFilter
+	capacity uint64
+	count    uint64
+	p        float64
+}
+
+// NewScalableBloomFilter 创建可扩容的布隆过滤器，n 为第一层的容量，p 为第一层的误判率
+func NewScalableBloomFilter(n uint64, p float64) *ScalableBloomFilter {
+	sbf := &ScalableBloomFilter{}
+	sbf.addLayer(n, p)
+	return sbf
+}
+
+func (sbf *ScalableBloomFilter) addLayer(n uint64, p float64) {
+	sbf.layers = append(sbf.layers, &scalableLayer{
+		filter:   NewBloomFilter(n, p),
+		capacity: n,
+		p:        p,
+	})
+}
+
+// Add 添加元素，已经可能存在的元素不会重复添加，避免无谓地消耗容量
+func (sbf *ScalableBloomFilter) Add(data []byte) {
+	sbf.mutex.Lock()
+	defer sbf.mutex.Unlock()
+	if sbf.contains(data) {
+		return
+	}
+	last := sbf.layers[len(sbf.layers)-1]
+	if last.count >= last.capacity {
+		sbf.addLayer(last.capacity*scalableGrowth, last.p*scalableTightening)
+		last = sbf.layers[len(sbf.layers)-1]
+	}
+	last.filter.Add(data)
+	last.count++
+}
+
+// Contains 检查元素是否可能存在，任意一层包含即认为可能存在
+func (sbf *ScalableBloomFilter) Contains(data []byte) bool {
+	sbf.mutex.RLock()
+	defer sbf.mutex.RUnlock()
+	return sbf.contains(data)
+}
+
+func (sbf *ScalableBloomFilter) contains(data []byte) bool {
+	for i := len(sbf.layers) - 1; i >= 0; i-- {
+		if sbf.layers[i].filter.Contains(data) {
+			return true
+		}
+	}
+	return false
+}
+
+// Layers 返回当前的层数
+func (sbf *ScalableBloomFilter) Layers() int {
+	sbf.mutex.RLock()
+	defer sbf.mutex.RUnlock()
+	return len(sbf.layers)
+}
+
+// EstimatedFalsePositiveRate 各层相互独立，总误判率为 1 - ∏(1 - p_i)
+func (sbf *ScalableBloomFilter) EstimatedFalsePositiveRate() float64 {
+	sbf.mutex.RLock()
+	defer sbf.mutex.RUnlock()
+	notFalsePositive := 1.0
+	for _, layer := range sbf.layers {
+		notFalsePositive *= 1 - layer.filter.EstimatedFalsePositiveRate()
+	}
+	return 1 - notFalsePositive
+}
@@ -0,0 +1,43 @@
+package utils
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestScalableBloomFilter(t *testing.T) {
+	const n, p = 1000, 0.01
+	sbf := NewScalableBloomFilter(n, p)
+
+	// 插入容量的 10 倍，普通布隆过滤器此时的误判率接近 100%
+	for i := 0; i < 10*n; i++ {
+		sbf.Add([]byte(fmt.Sprintf("blog:%d", i)))
+	}
+	if sbf.Layers() < 3 {
+		t.Fatalf("expected the filter to grow, but get %d layers", sbf.Layers())
+	}
+	for i := 0; i < 10*n; i++ {
+		if !sbf.Contains([]byte(fmt.Sprintf("blog:%d", i))) {
+			t.Fatalf("false negative on blog:%d", i)
+		}
+	}
+
+	// 总误判率的上界为 p / (1 - tightening)
+	bound := p / (1 - scalableTightening)
+	observed := measureFalsePositiveRate(sbf, 100000)
+	estimated := sbf.EstimatedFalsePositiveRate()
+	if observed > bound {
+		t.Fatalf("observed false positive rate %.4f exceeds bound %.4f", observed, bound)
+	}
+	if estimated < observed/2 || estimated > observed*2 {
+		t.Fatalf("estimated rate %.4f is far from observed %.4f", estimated, observed)
+	}
+
+	plain := NewBloomFilter(n, p)
+	for i := 0; i < 10*n; i++ {
+		plain.Add([]byte(fmt.Sprintf("blog:%d", i)))
+	}
+	if plainRate := measureFalsePositiveRate(plain, 10000); plainRate < 10*observed {
+		t.Fatalf("plain filter rate %.4f should degrade far beyond scalable %.4f", plainRate, observed)
+	}
+}
@@ -0,0 +1,60 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// SmsSender 短信发送接口，接入真实短信服务商时实现该接口即可
+type SmsSender interface {
+	Send(phone string, content string) error
+}
+
+var SmsClient SmsSender = NewSmsSender(SMS_SENDER_TYPE)
+
+// NewSmsSender 根据类型创建短信发送器: log 只打印日志, file 写入本地文件
+func NewSmsSender(kind string) SmsSender {
+	switch kind {
+	case "file":
+		return NewFileSmsSender(SMS_FILE_PATH)
+	default:
+		return &LogSmsSender{}
+	}
+}
+
+// LogSmsSender 把短信内容打印到日志中，用于本地开发
+type LogSmsSender struct {
+}
+
+func (*LogSmsSender) Send(phone string, content string) error {
+	logrus.Infof("[SMS] phone=%s content=%s", phone, content)
+	return nil
+}
+
+// FileSmsSender 把短信内容追加到本地文件中，便于测试时查看验证码
+type FileSmsSender struct {
+	path  string
+	mutex sync.Mutex
+}
+
+func NewFileSmsSender(path string) *FileSmsSender {
+	return &FileSmsSender{path: path}
+}
+
+func (fs *FileSmsSender) Send(phone string, content string) error {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+
+	file, err := os.OpenFile(fs.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = fmt.Fprintf(file, "%s\t%s\t%s\n", time.Now().Format(time.DateTime), phone, content)
+	return err
+}
@@ -0,0 +1,32 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFileSmsSender(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sms.log")
+	sender := NewFileSmsSender(path)
+
+	if err := sender.Send("13800000000", "code 123456"); err != nil {
+		t.Fatalf("expected no err, but get %v", err)
+	}
+	if err := sender.Send("13900000000", "code 654321"); err != nil {
+		t.Fatalf("expected no err, but get %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 lines, but get %d", len(lines))
+	}
+	if !strings.Contains(lines[1], "13900000000") || !strings.Contains(lines[1], "654321") {
+		t.Fatalf("unexpected line: %s", lines[1])
+	}
+}
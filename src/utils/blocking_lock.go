@@ -0,0 +1,138 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// 阻塞式加锁：没有拿到锁时等待解锁通知，并按带随机抖动的指数退避重试，直到 ctx 超时
+// 解锁通知通过进程内共用的订阅分发(见 unlockNotifier)，可能丢失(例如锁过期而不是被释放)，退避重试作为兜底
+
+const (
+	lockMinBackoff = 10 * time.Millisecond
+	lockMaxBackoff = 500 * time.Millisecond
+)
+
+var ErrLockTimeout = errors.New("wait for lock timeout")
+
+// UnlockChannel 返回 key 的解锁通知频道
+func UnlockChannel(key string) string {
+	return LOCK_UNLOCK_CHANNEL + key
+}
+
+// Lock 获取锁并启动看门狗，锁被占用时一直等待到 ctx 结束
+// 返回的 lockCtx 在锁丢失时被取消，token 用于解锁
+func (dl *DistributedLock) Lock(ctx context.Context, key string, ttl time.Duration) (context.Context, string, error) {
+	var token string
+	err := waitLock(ctx, dl.client, key, func(ctx context.Context) (bool, error) {
+		acquired, t, err := dl.LockWithWatchDog(ctx, key, ttl)
+		token = t
+		return acquired, err
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return dl.LockContext(key), token, nil
+}
+
+// LockReentrantWait 阻塞式获取可重入锁，重入时返回第一次加锁时的 lockCtx
+func (dl *DistributedLock) LockReentrantWait(ctx context.Context, key string, ttl time.Duration) (context.Context, error) {
+	err := waitLock(ctx, dl.client, key, func(ctx context.Context) (bool, error) {
+		return dl.LockReentrant(ctx, key, ttl)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return dl.LockContext(key), nil
+}
+
+// waitLock 调用 tryLock 直到成功，等待期间订阅 key 的解锁通知
+// 传给 tryLock 的 ctx 携带开始等待的时间，加锁成功时记录到锁的元数据中
+func waitLock(ctx context.Context, client *redis.Client, key string, tryLock func(ctx context.Context) (bool, error)) (err error) {
+	start := time.Now()
+	ctx = context.WithValue(ctx, lockWaitStartKey{}, start)
+	contended := false
+	defer func() {
+		recordLockAcquire(key, contended, time.Since(start), err)
+	}()
+
+	acquired, err := tryLock(ctx)
+	if err != nil || acquired {
+		return err
+	}
+	contended = true
+
+	// 先订阅再重试，避免错过订阅之前发布的解锁通知
+	unlocked, stop, err := getUnlockNotifier(client).watch(ctx, key)
+	if err != nil {
+		return lockWaitError(ctx, key, err)
+	}
+	defer stop()
+
+	backoff := lockMinBackoff
+	for {
+		acquired, err = tryLock(ctx)
+		if err != nil {
+			return lockWaitError(ctx, key, err)
+		}
+		if acquired {
+			return nil
+		}
+
+		timer := time.NewTimer(jitter(backoff))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return lockWaitError(ctx, key, ctx.Err())
+		case <-unlocked:
+			timer.Stop()
+		case <-timer.C:
+			backoff = min(backoff*2, lockMaxBackoff)
+		}
+	}
+}
+
+// WaitUnlock 等待 key 被释放，锁不存在时立即返回；没有收到通知时最多等待一个退避上限后返回，调用方需要自行重试
+// 适用于等待者不需要拿到锁、只需要在持有者完成后重新检查结果的场景，例如缓存重建
+func (dl *DistributedLock) WaitUnlock(ctx context.Context, key string) error {
+	unlocked, stop, err := getUnlockNotifier(dl.client).watch(ctx, key)
+	if err != nil {
+		return lockWaitError(ctx, key, err)
+	}
+	defer stop()
+	exists, err := dl.client.Exists(ctx, key).Result()
+	if err != nil {
+		return lockWaitError(ctx, key, err)
+	}
+	if exists == 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(jitter(lockMaxBackoff))
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return lockWaitError(ctx, key, ctx.Err())
+	case <-unlocked:
+	case <-timer.C:
+	}
+	return nil
+}
+
+// jitter 在 [d/2, d) 之间随机，避免大量等待者同时重试
+func jitter(d time.Duration) time.Duration {
+	half := d / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+func lockWaitError(ctx context.Context, key string, err error) error {
+	if ctx.Err() != nil {
+		return fmt.Errorf("%w: %s", ErrLockTimeout, key)
+	}
+	return err
+}
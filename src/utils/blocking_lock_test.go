@@ -0,0 +1,181 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestLockWakeUpOnUnlock(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	holder := NewDistributedLock(rdb)
+	waiter := NewDistributedLock(rdb)
+	key := "lock:shop:1"
+
+	_, token, err := holder.Lock(context.Background(), key, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	released := make(chan time.Time, 1)
+	go func() {
+		// 持有足够久，让等待者的退避间隔达到上限
+		time.Sleep(700 * time.Millisecond)
+		released <- time.Now()
+		holder.UnlockWithWatchDog(context.Background(), key, token)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	_, waiterToken, err := waiter.Lock(ctx, key, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer waiter.UnlockWithWatchDog(context.Background(), key, waiterToken)
+	if latency := time.Since(<-released); latency > 100*time.Millisecond {
+		t.Fatalf("waiter should wake up on unlock notification, latency=%v", latency)
+	}
+}
+
+func TestLockTimeout(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	lock := NewDistributedLock(rdb)
+	key := "lock:shop:2"
+
+	if _, _, err := lock.Lock(context.Background(), key, 10*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if _, _, err := NewDistributedLock(rdb).Lock(ctx, key, 10*time.Second); !errors.Is(err, ErrLockTimeout) {
+		t.Fatalf("expected ErrLockTimeout, but get %v", err)
+	}
+}
+
+func TestLockReentrantWait(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	lock := NewDistributedLock(rdb)
+	key := "lock:order:3"
+	owner := WithLockOwner(context.Background())
+
+	if _, err := lock.LockReentrantWait(owner, key, 10*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		lock.UnlockReentrant(owner, key, 10*time.Second)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	other := WithLockOwner(ctx)
+	if _, err := lock.LockReentrantWait(other, key, 10*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if count, _ := lock.HoldCount(other, key); count != 1 {
+		t.Fatalf("expected hold count 1, but get %d", count)
+	}
+}
+
+func TestLockLost(t *testing.T) {
+	mr := miniredis.RunT(t)
+	lock := NewDistributedLock(redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+	key := "lock:order:4"
+
+	lockCtx, token, err := lock.Lock(context.Background(), key, 2*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = CheckLock(lockCtx); err != nil {
+		t.Fatalf("lock should be held, but get %v", err)
+	}
+
+	// 模拟锁过期后被其他实例抢走，看门狗下一次续期时发现锁已丢失
+	mr.Set(key, "other-owner")
+	select {
+	case <-lockCtx.Done():
+	case <-time.After(2 * time.Second):
+		t.Fatal("lock context should be cancelled when the lock is lost")
+	}
+	if err = CheckLock(lockCtx); !errors.Is(err, ErrLockLost) {
+		t.Fatalf("expected ErrLockLost, but get %v", err)
+	}
+	lock.UnlockWithWatchDog(context.Background(), key, token)
+	if v, _ := mr.Get(key); v != "other-owner" {
+		t.Fatal("unlock should not delete the lock of other owners")
+	}
+}
+
+func TestLockContextReleased(t *testing.T) {
+	mr := miniredis.RunT(t)
+	lock := NewDistributedLock(redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+	owner := WithLockOwner(context.Background())
+	key := "lock:order:5"
+
+	lockCtx, err := lock.LockReentrantWait(owner, key, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nestedCtx, err := lock.LockReentrantWait(owner, key, 10*time.Second)
+	if err != nil || nestedCtx != lockCtx {
+		t.Fatalf("reentrant acquisition should share the lock context, err=%v", err)
+	}
+
+	lock.UnlockReentrant(owner, key, 10*time.Second)
+	if CheckLock(lockCtx) != nil {
+		t.Fatal("lock is still held once")
+	}
+	lock.UnlockReentrant(owner, key, 10*time.Second)
+	if !errors.Is(CheckLock(lockCtx), ErrLockLost) {
+		t.Fatal("lock context should be cancelled after release")
+	}
+}
+
+func TestWaitersShareUnlockSubscription(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	holder := NewDistributedLock(rdb)
+	key := "lock:shop:5"
+
+	_, token, err := holder.Lock(context.Background(), key, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const waiters = 20
+	done := make(chan error, waiters)
+	for i := 0; i < waiters; i++ {
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+			defer cancel()
+			done <- NewDistributedLock(rdb).WaitUnlock(ctx, key)
+		}()
+	}
+	time.Sleep(100 * time.Millisecond)
+	// 所有等待者共用一个模式订阅，不会为每个等待者创建订阅连接
+	if n := rdb.PubSubNumPat(context.Background()).Val(); n != 1 {
+		t.Fatalf("expected 1 pattern subscription, but get %d", n)
+	}
+	if channels := rdb.PubSubChannels(context.Background(), "*").Val(); len(channels) != 0 {
+		t.Fatalf("expected no channel subscriptions, but get %v", channels)
+	}
+
+	holder.UnlockWithWatchDog(context.Background(), key, token)
+	for i := 0; i < waiters; i++ {
+		if err := <-done; err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 没有等待者时关闭订阅
+	time.Sleep(50 * time.Millisecond)
+	if n := rdb.PubSubNumPat(context.Background()).Val(); n != 0 {
+		t.Fatalf("expected subscription to be closed, but get %d", n)
+	}
+}
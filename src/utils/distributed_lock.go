@@ -2,23 +2,25 @@ package utils
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"github.com/google/uuid"
 	"github.com/redis/go-redis/v9"
-	"github.com/sirupsen/logrus"
-	"sync"
 	"time"
 )
 
+// ErrLockLost 看门狗续期失败或者锁已经不属于当前持有者，临界区应当放弃提交
+var ErrLockLost = errors.New("distributed lock lost")
+
 type DistributedLock struct {
 	client    *redis.Client
-	watchDogs map[string]context.CancelFunc // 存储看门狗的取消函数
-	mutex     sync.Mutex                    // 保护watchDogs的并发访问
+	watchDogs *watchDogs // 每个 key 的看门狗
 }
 
 func NewDistributedLock(client *redis.Client) *DistributedLock {
 	return &DistributedLock{
 		client:    client,
-		watchDogs: make(map[string]context.CancelFunc),
+		watchDogs: newWatchDogs(client),
 	}
 }
 
@@ -35,70 +37,65 @@ func (dl *DistributedLock) LockWithWatchDog(ctx context.Context, key string, ttl
 	}
 
 	// 启动看门狗
-	dl.mutex.Lock()
-	defer dl.mutex.Unlock()
+	dl.startWatchDog(ctx, key, token, ttl, renewScript)
 
-	// 如果已有看门狗，先停止它（防止重复）
-	if cancel, ok := dl.watchDogs[key]; ok {
-		cancel()
-	}
+	return true, token, nil
+}
 
-	// 创建新的看门狗上下文
-	dogCtx, cancel := context.WithCancel(context.Background())
-	dl.watchDogs[key] = cancel
+// startWatchDog 为 key 启动看门狗，script 用于校验持有者并续期
+func (dl *DistributedLock) startWatchDog(parent context.Context, key, token string, ttl time.Duration, script *redis.Script) context.Context {
+	return dl.watchDogs.start(parent, key, key, token, ttl, func(ctx context.Context) (int64, error) {
+		return script.Run(ctx, dl.client, []string{key}, token, int(ttl/time.Second)).Int64()
+	})
+}
 
-	// 启动看门狗协程
-	go dl.watchDog(dogCtx, key, token, ttl)
+func (dl *DistributedLock) stopWatchDog(key string) {
+	dl.watchDogs.stop(key)
+}
 
-	return true, token, nil
+// LockContext 返回 key 的锁上下文，锁丢失时被取消，context.Cause 为 ErrLockLost
+// 当前实例没有持有该锁时返回一个已经取消的上下文
+func (dl *DistributedLock) LockContext(key string) context.Context {
+	return dl.watchDogs.lockContext(key, key)
+}
+
+// CheckLock 锁仍然被持有时返回 nil，否则返回锁丢失的原因，适合在提交事务之前调用
+func CheckLock(lockCtx context.Context) error {
+	if lockCtx.Err() == nil {
+		return nil
+	}
+	if cause := context.Cause(lockCtx); errors.Is(cause, ErrLockLost) {
+		return cause
+	}
+	return fmt.Errorf("%w: lock released", ErrLockLost)
 }
 
 // UnlockWithWatchDog 自动停止看门狗的解锁方法
 func (dl *DistributedLock) UnlockWithWatchDog(ctx context.Context, key, token string) error {
 	// 先停止看门狗
-	dl.mutex.Lock()
-	if cancel, ok := dl.watchDogs[key]; ok {
-		cancel()
-		delete(dl.watchDogs, key)
-	}
-	dl.mutex.Unlock()
-
-	// 执行解锁操作
-	script := `
-        if redis.call("GET", KEYS[1]) == ARGV[1] then
-            return redis.call("DEL", KEYS[1])
-        else
-            return 0
-        end
-    `
-	_, err := dl.client.Eval(ctx, script, []string{key}, token).Result()
+	dl.stopWatchDog(key)
+
+	// 执行解锁操作，释放成功后通知等待的请求
+	_, err := unlockScript.Run(ctx, dl.client, []string{key}, token, UnlockChannel(key)).Result()
 	return err
 }
 
-// watchDog 自动续期的看门狗实现
-func (dl *DistributedLock) watchDog(ctx context.Context, key, token string, ttl time.Duration) {
-	ticker := time.NewTicker(ttl / 2)
-	defer ticker.Stop()
-
-	for {
-		select {
-		case <-ticker.C:
-			// 续期时验证令牌
-			script := `
-                if redis.call("GET", KEYS[1]) == ARGV[1] then
-                    return redis.call("EXPIRE", KEYS[1], ARGV[2])
-                else
-                    return 0
-                end
-            `
-			result, err := dl.client.Eval(ctx, script, []string{key}, token, int(ttl/time.Second)).Result()
-			if err != nil || result == nil {
-				logrus.Warnf("锁续期失败: key=%s, err=%v", key, err)
-				return
-			}
-
-		case <-ctx.Done():
-			return
-		}
-	}
-}
+// unlockScript 只有锁的持有者才能解锁，删除和发布解锁通知在同一个脚本中原子执行
+var unlockScript = redis.NewScript(`
+    if redis.call("GET", KEYS[1]) == ARGV[1] then
+        redis.call("DEL", KEYS[1])
+        redis.call("PUBLISH", ARGV[2], KEYS[1])
+        return 1
+    else
+        return 0
+    end
+`)
+
+// renewScript 只有锁的持有者才能续期
+var renewScript = redis.NewScript(`
+    if redis.call("GET", KEYS[1]) == ARGV[1] then
+        return redis.call("EXPIRE", KEYS[1], ARGV[2])
+    else
+        return 0
+    end
+`)
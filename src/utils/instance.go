@@ -0,0 +1,24 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"sync"
+)
+
+var (
+	instanceId     string
+	instanceIdOnce sync.Once
+)
+
+// InstanceId 返回当前实例的标识(主机名-进程号)，用于在多个实例之间区分锁的持有者、日志的来源等
+func InstanceId() string {
+	instanceIdOnce.Do(func() {
+		host, err := os.Hostname()
+		if err != nil {
+			host = "unknown"
+		}
+		instanceId = fmt.Sprintf("%s-%d", host, os.Getpid())
+	})
+	return instanceId
+}
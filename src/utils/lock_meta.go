@@ -0,0 +1,283 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// 锁的诊断信息：同一个锁的所有持有者记录在一个hash lockmeta:<key> 中，<持有者> 字段保存持有实例、加锁时间和等待时间，
+// <持有者>#renewCount 字段保存续期次数，随锁一起续期，释放时删除对应的字段；
+// 每个实例在内存中按锁的名称(去掉末尾的id)统计加锁次数、等待和超时，用于观察锁竞争
+
+// LockMeta 一次持有的元数据
+type LockMeta struct {
+	Owner       string `json:"owner"`
+	Instance    string `json:"instance"`
+	AcquireTime int64  `json:"acquireTime"` // 毫秒时间戳
+	RenewCount  int64  `json:"renewCount"`
+	WaitTime    int64  `json:"waitTime"` // 毫秒
+}
+
+// LockInfo 锁的当前状态，Holders 为持有者 -> 重入次数(hash)或者许可过期时间(zset)，普通锁的持有者为 token
+type LockInfo struct {
+	Key     string            `json:"key"`
+	Type    string            `json:"type"`
+	TTL     int64             `json:"ttl"` // 毫秒，-1 表示不过期
+	Mode    string            `json:"mode,omitempty"`
+	Holders map[string]string `json:"holders"`
+	Meta    []LockMeta        `json:"meta"`
+}
+
+// LockStat 当前实例上一类锁的竞争统计
+type LockStat struct {
+	Name          string  `json:"name"`
+	Acquired      int64   `json:"acquired"`  // 阻塞式加锁成功的次数
+	Contended     int64   `json:"contended"` // 第一次尝试失败，需要等待的次数
+	Timeouts      int64   `json:"timeouts"`
+	Failed        int64   `json:"failed"` // Redis错误
+	Lost          int64   `json:"lost"`   // 看门狗发现锁丢失的次数
+	ForceReleased int64   `json:"forceReleased"`
+	AvgWait       float64 `json:"avgWait"` // 毫秒
+	MaxWait       int64   `json:"maxWait"` // 毫秒
+}
+
+var (
+	ErrLockNotFound = errors.New("lock not found")
+	ErrLockChanged  = errors.New("lock holders changed, inspect it again")
+)
+
+type lockWaitStartKey struct{}
+
+type lockCounters struct {
+	acquired, contended, timeouts, failed, lost, forceReleased atomic.Int64
+	waitTotal, waitMax                                         atomic.Int64 // 纳秒
+}
+
+var lockMetrics sync.Map // 锁名称 -> *lockCounters
+
+// lockMetaRenewSuffix 续期次数字段的后缀，通过 HINCRBY 累加
+const lockMetaRenewSuffix = "#renewCount"
+
+func lockMetaKey(key string) string {
+	return LOCK_META_KEY + key
+}
+
+// lockName 去掉 key 末尾的数字id，例如 lock:order:12 -> lock:order:
+func lockName(key string) string {
+	return strings.TrimRightFunc(key, unicode.IsDigit)
+}
+
+func lockMetricsOf(key string) *lockCounters {
+	name := lockName(key)
+	if counters, ok := lockMetrics.Load(name); ok {
+		return counters.(*lockCounters)
+	}
+	counters, _ := lockMetrics.LoadOrStore(name, &lockCounters{})
+	return counters.(*lockCounters)
+}
+
+// recordLockAcquire 记录一次阻塞式加锁的结果
+func recordLockAcquire(key string, contended bool, wait time.Duration, err error) {
+	counters := lockMetricsOf(key)
+	if contended {
+		counters.contended.Add(1)
+	}
+	switch {
+	case err == nil:
+		counters.acquired.Add(1)
+		counters.waitTotal.Add(int64(wait))
+		for {
+			old := counters.waitMax.Load()
+			if int64(wait) <= old || counters.waitMax.CompareAndSwap(old, int64(wait)) {
+				break
+			}
+		}
+	case errors.Is(err, ErrLockTimeout):
+		counters.timeouts.Add(1)
+	default:
+		counters.failed.Add(1)
+	}
+}
+
+// LockMetrics 返回当前实例上所有锁的竞争统计，按名称排序
+func LockMetrics() []LockStat {
+	var stats []LockStat
+	lockMetrics.Range(func(name, value any) bool {
+		counters := value.(*lockCounters)
+		stat := LockStat{
+			Name:          name.(string),
+			Acquired:      counters.acquired.Load(),
+			Contended:     counters.contended.Load(),
+			Timeouts:      counters.timeouts.Load(),
+			Failed:        counters.failed.Load(),
+			Lost:          counters.lost.Load(),
+			ForceReleased: counters.forceReleased.Load(),
+			MaxWait:       time.Duration(counters.waitMax.Load()).Milliseconds(),
+		}
+		if stat.Acquired > 0 {
+			stat.AvgWait = float64(counters.waitTotal.Load()) / float64(stat.Acquired) / float64(time.Millisecond)
+		}
+		stats = append(stats, stat)
+		return true
+	})
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Name < stats[j].Name })
+	return stats
+}
+
+// ScanLocks 列出匹配 pattern 的锁，最多 limit 个
+func ScanLocks(ctx context.Context, client *redis.Client, pattern string, limit int) ([]LockInfo, error) {
+	var locks []LockInfo
+	iter := client.Scan(ctx, 0, pattern, 100).Iterator()
+	for iter.Next(ctx) && len(locks) < limit {
+		info, err := InspectLock(ctx, client, iter.Val())
+		if errors.Is(err, ErrLockNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		locks = append(locks, info)
+	}
+	return locks, iter.Err()
+}
+
+// InspectLock 查询锁的持有者、剩余时间和元数据
+func InspectLock(ctx context.Context, client *redis.Client, key string) (LockInfo, error) {
+	info := LockInfo{Key: key, Holders: make(map[string]string)}
+	var err error
+	if info.Type, err = client.Type(ctx, key).Result(); err != nil {
+		return info, err
+	}
+	switch info.Type {
+	case "none":
+		return info, ErrLockNotFound
+	case "string":
+		token, err := client.Get(ctx, key).Result()
+		if err != nil && !errors.Is(err, redis.Nil) {
+			return info, err
+		}
+		info.Holders[token] = ""
+	case "hash":
+		fields, err := client.HGetAll(ctx, key).Result()
+		if err != nil {
+			return info, err
+		}
+		for field, value := range fields {
+			switch {
+			case field == "mode":
+				info.Mode = value
+			case strings.HasPrefix(field, "exp:"):
+			default:
+				info.Holders[field] = value
+			}
+		}
+	case "zset":
+		members, err := client.ZRangeWithScores(ctx, key, 0, -1).Result()
+		if err != nil {
+			return info, err
+		}
+		for _, member := range members {
+			info.Holders[member.Member.(string)] = strconv.FormatInt(int64(member.Score), 10)
+		}
+	}
+
+	ttl, err := client.PTTL(ctx, key).Result()
+	if err != nil {
+		return info, err
+	}
+	info.TTL = ttl.Milliseconds()
+	if ttl < 0 {
+		info.TTL = -1
+	}
+
+	fields, err := client.HGetAll(ctx, lockMetaKey(key)).Result()
+	if err != nil {
+		return info, err
+	}
+	for field, value := range fields {
+		if strings.HasSuffix(field, lockMetaRenewSuffix) {
+			continue
+		}
+		// 读锁的元数据共享同一个过期时间，崩溃的持有者留下的字段不再展示
+		if _, ok := info.Holders[field]; !ok {
+			continue
+		}
+		var meta LockMeta
+		if json.Unmarshal([]byte(value), &meta) != nil {
+			continue
+		}
+		meta.RenewCount, _ = strconv.ParseInt(fields[field+lockMetaRenewSuffix], 10, 64)
+		info.Meta = append(info.Meta, meta)
+	}
+	sort.Slice(info.Meta, func(i, j int) bool { return info.Meta[i].AcquireTime < info.Meta[j].AcquireTime })
+	return info, nil
+}
+
+// forceUnlockScript 只有持有者与查询时一致才删除锁和元数据，避免删除查询之后重新加的锁
+// KEYS[1] 锁，KEYS[2] 元数据；ARGV[1] 查询时的类型，ARGV[2] 解锁通知的channel，其余为查询时的持有者
+var forceUnlockScript = redis.NewScript(`
+local t = redis.call('TYPE', KEYS[1])['ok']
+if t ~= ARGV[1] then
+	return 0
+end
+local holders = {}
+if t == 'string' then
+	holders = {redis.call('GET', KEYS[1])}
+elseif t == 'hash' then
+	for _, field in ipairs(redis.call('HKEYS', KEYS[1])) do
+		if field ~= 'mode' and string.sub(field, 1, 4) ~= 'exp:' then
+			table.insert(holders, field)
+		end
+	end
+elseif t == 'zset' then
+	holders = redis.call('ZRANGE', KEYS[1], 0, -1)
+end
+if #holders ~= #ARGV - 2 then
+	return 0
+end
+local expected = {}
+for i = 3, #ARGV do
+	expected[ARGV[i]] = true
+end
+for _, holder in ipairs(holders) do
+	if not expected[holder] then
+		return 0
+	end
+end
+redis.call('DEL', KEYS[1], KEYS[2])
+redis.call('PUBLISH', ARGV[2], KEYS[1])
+return 1
+`)
+
+// ForceUnlock 强制删除锁和元数据并通知等待者，返回删除前的状态
+// 查询和删除之间持有者发生变化时返回 ErrLockChanged，需要重新查询确认
+// 原持有者的看门狗会在下一次续期时发现锁丢失并取消锁上下文
+func ForceUnlock(ctx context.Context, client *redis.Client, key string) (LockInfo, error) {
+	info, err := InspectLock(ctx, client, key)
+	if err != nil {
+		return info, err
+	}
+	args := []interface{}{info.Type, UnlockChannel(key)}
+	for holder := range info.Holders {
+		args = append(args, holder)
+	}
+	released, err := forceUnlockScript.Run(ctx, client, []string{key, lockMetaKey(key)}, args...).Int()
+	if err != nil {
+		return info, err
+	}
+	if released == 0 {
+		return info, ErrLockChanged
+	}
+	lockMetricsOf(key).forceReleased.Add(1)
+	return info, nil
+}
@@ -0,0 +1,191 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestLockMeta(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	lock := NewDistributedLock(client)
+	key := "lock:meta:1"
+
+	// 先被占用 100ms，等待时间记录到元数据中
+	_, first, err := lock.Lock(context.Background(), key, 2*time.Second)
+	if err != nil {
+		t.Fatalf("first lock failed: %v", err)
+	}
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		lock.UnlockWithWatchDog(context.Background(), key, first)
+	}()
+	other := NewDistributedLock(client)
+	_, token, err := other.Lock(context.Background(), key, 2*time.Second)
+	if err != nil {
+		t.Fatalf("second lock failed: %v", err)
+	}
+
+	info, err := InspectLock(context.Background(), client, key)
+	if err != nil {
+		t.Fatalf("inspect lock failed: %v", err)
+	}
+	if _, ok := info.Holders[token]; !ok || info.Type != "string" || info.TTL <= 0 {
+		t.Fatalf("unexpected lock info %+v", info)
+	}
+	if len(info.Meta) != 1 {
+		t.Fatalf("expected 1 meta, but get %+v", info.Meta)
+	}
+	meta := info.Meta[0]
+	if meta.Owner != token || meta.Instance != InstanceId() || meta.WaitTime < 50 || meta.AcquireTime == 0 {
+		t.Fatalf("unexpected meta %+v", meta)
+	}
+
+	// 续期时增加续期次数
+	time.Sleep(1100 * time.Millisecond)
+	if count := mr.HGet(lockMetaKey(key), token+lockMetaRenewSuffix); count != "1" {
+		t.Fatalf("expected renew count 1, but get %q", count)
+	}
+
+	if err = other.UnlockWithWatchDog(context.Background(), key, token); err != nil {
+		t.Fatalf("unlock failed: %v", err)
+	}
+	if mr.Exists(lockMetaKey(key)) {
+		t.Fatal("meta should be deleted after unlock")
+	}
+	if _, err = InspectLock(context.Background(), client, key); !errors.Is(err, ErrLockNotFound) {
+		t.Fatalf("expected ErrLockNotFound, but get %v", err)
+	}
+}
+
+func TestScanLocks(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	ctx := WithLockOwner(context.Background())
+
+	if _, _, err := NewDistributedLock(client).LockWithWatchDog(ctx, "lock:scan:1", 10*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewDistributedLock(client).LockReentrant(ctx, "lock:scan:2", 10*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := NewReadWriteLock(client).RLock(ctx, "lock:scan:3", 10*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	mr.Set("cache:shop:1", "{}")
+
+	locks, err := ScanLocks(context.Background(), client, "lock:*", 10)
+	if err != nil {
+		t.Fatalf("scan locks failed: %v", err)
+	}
+	if len(locks) != 3 {
+		t.Fatalf("expected 3 locks, but get %+v", locks)
+	}
+	owner, _ := LockOwner(ctx)
+	for _, lock := range locks {
+		if len(lock.Meta) != 1 {
+			t.Fatalf("lock %s should have meta, but get %+v", lock.Key, lock.Meta)
+		}
+		switch lock.Key {
+		case "lock:scan:2":
+			if lock.Holders[owner] != "1" {
+				t.Fatalf("unexpected reentrant holders %+v", lock.Holders)
+			}
+		case "lock:scan:3":
+			if lock.Mode != "read" || lock.Holders[owner] != "1" {
+				t.Fatalf("unexpected read lock %+v", lock)
+			}
+		}
+	}
+}
+
+func TestForceUnlock(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	lock := NewDistributedLock(client)
+	key := "lock:force:1"
+
+	lockCtx, token, err := lock.Lock(context.Background(), key, 2*time.Second)
+	if err != nil {
+		t.Fatalf("lock failed: %v", err)
+	}
+	info, err := ForceUnlock(context.Background(), client, key)
+	if err != nil {
+		t.Fatalf("force unlock failed: %v", err)
+	}
+	if _, ok := info.Holders[token]; !ok {
+		t.Fatalf("released info should contain the holder, but get %+v", info)
+	}
+	if mr.Exists(key) || mr.Exists(lockMetaKey(key)) {
+		t.Fatal("lock and meta should be deleted")
+	}
+
+	// 原持有者在下一次续期时发现锁丢失
+	select {
+	case <-lockCtx.Done():
+	case <-time.After(2 * time.Second):
+		t.Fatal("holder's lock context should be cancelled")
+	}
+	if _, err = ForceUnlock(context.Background(), client, key); !errors.Is(err, ErrLockNotFound) {
+		t.Fatalf("expected ErrLockNotFound, but get %v", err)
+	}
+}
+
+func TestForceUnlockChangedHolder(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	key := "lock:force:2"
+	mr.Set(key, "token-1")
+
+	info, err := InspectLock(context.Background(), client, key)
+	if err != nil {
+		t.Fatalf("inspect lock failed: %v", err)
+	}
+	// 查询之后锁被释放，又被其他请求获取
+	mr.Set(key, "token-2")
+	args := []interface{}{info.Type, UnlockChannel(key)}
+	for holder := range info.Holders {
+		args = append(args, holder)
+	}
+	released, err := forceUnlockScript.Run(context.Background(), client, []string{key, lockMetaKey(key)}, args...).Int()
+	if err != nil {
+		t.Fatalf("force unlock script failed: %v", err)
+	}
+	if released != 0 {
+		t.Fatal("lock acquired after inspection should not be released")
+	}
+	if value, _ := mr.Get(key); value != "token-2" {
+		t.Fatalf("expected token-2, but get %q", value)
+	}
+}
+
+func TestLockMetrics(t *testing.T) {
+	mr := miniredis.RunT(t)
+	lock := NewDistributedLock(redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+	key := "lock:metrics:1"
+
+	if _, _, err := lock.Lock(context.Background(), key, 10*time.Second); err != nil {
+		t.Fatalf("lock failed: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, _, err := NewDistributedLock(lock.client).Lock(ctx, key, 10*time.Second); !errors.Is(err, ErrLockTimeout) {
+		t.Fatalf("expected ErrLockTimeout, but get %v", err)
+	}
+
+	for _, stat := range LockMetrics() {
+		if stat.Name != "lock:metrics:" {
+			continue
+		}
+		if stat.Acquired != 1 || stat.Contended != 1 || stat.Timeouts != 1 {
+			t.Fatalf("unexpected stat %+v", stat)
+		}
+		return
+	}
+	t.Fatal("metrics of lock:metrics: not found")
+}
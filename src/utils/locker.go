@@ -0,0 +1,38 @@
+package utils
+
+import (
+	"context"
+	"time"
+
+	redisClient "hmdp-Go/src/config/redis"
+)
+
+// Locker 互斥锁，单节点的 DistributedLock 和多节点的 Redlock 都实现了它
+type Locker interface {
+	// LockWithWatchDog 尝试加锁，成功时启动看门狗并返回解锁用的 token
+	LockWithWatchDog(ctx context.Context, key string, ttl time.Duration) (bool, string, error)
+	// Lock 阻塞式加锁，返回的 lockCtx 在锁丢失时被取消
+	Lock(ctx context.Context, key string, ttl time.Duration) (context.Context, string, error)
+	UnlockWithWatchDog(ctx context.Context, key, token string) error
+
+	// 可重入锁，持有者标识通过 WithLockOwner 保存在 ctx 中
+	LockReentrant(ctx context.Context, key string, ttl time.Duration) (bool, error)
+	LockReentrantWait(ctx context.Context, key string, ttl time.Duration) (context.Context, error)
+	UnlockReentrant(ctx context.Context, key string, ttl time.Duration) (int64, error)
+
+	// LockContext 返回 key 的锁上下文，当前实例没有持有该锁时返回一个已经取消的上下文
+	LockContext(key string) context.Context
+}
+
+var (
+	_ Locker = (*DistributedLock)(nil)
+	_ Locker = (*Redlock)(nil)
+)
+
+// NewLocker 按配置的 LOCK_MODE 创建锁，redlock 模式使用相互独立的节点，否则使用主Redis
+func NewLocker() Locker {
+	if redisClient.LOCK_MODE == "redlock" {
+		return NewRedlock(redisClient.GetLockClients()...)
+	}
+	return NewDistributedLock(redisClient.GetRedisClient())
+}
@@ -0,0 +1,253 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+// Redlock 在 N 个相互独立的Redis节点上加锁，超过半数节点加锁成功，并且剩余有效期扣除时钟漂移后仍然大于 0 才算成功，
+// 失败时释放所有节点上的锁；单个主节点故障或者主从切换时不会出现两个持有者
+// 解锁通知只订阅第一个节点，收不到通知时依靠退避重试，锁的元数据也只记录在第一个节点上
+const (
+	redlockDriftFactor = 0.01                  // 时钟漂移占 ttl 的比例
+	redlockNodeTimeout = 50 * time.Millisecond // 单个节点的超时时间，远小于 ttl，避免在故障节点上等待太久
+)
+
+type Redlock struct {
+	clients   []*redis.Client
+	watchDogs *watchDogs
+}
+
+// NewRedlock 节点数必须是不少于 3 的奇数，少于 3 个节点时多数派没有意义，偶数个节点不会比少一个节点容忍更多故障
+func NewRedlock(clients ...*redis.Client) *Redlock {
+	if len(clients) < 3 || len(clients)%2 == 0 {
+		panic(fmt.Sprintf("redlock requires an odd number of at least 3 nodes, got %d", len(clients)))
+	}
+	return &Redlock{clients: clients, watchDogs: newWatchDogs(clients[0])}
+}
+
+// nodeResult 单个节点上脚本的执行结果
+type nodeResult struct {
+	value int64
+	err   error
+}
+
+type nodeFunc func(ctx context.Context, client *redis.Client) (int64, error)
+
+func (rl *Redlock) quorum() int {
+	return len(rl.clients)/2 + 1
+}
+
+// eachNode 在所有节点上并发执行 fn
+func (rl *Redlock) eachNode(ctx context.Context, fn nodeFunc) []nodeResult {
+	return rl.onNodes(ctx, func(int) bool { return true }, fn)
+}
+
+// onNodes 在 pick 选中的节点上并发执行 fn，没有选中的节点结果为零值
+func (rl *Redlock) onNodes(ctx context.Context, pick func(i int) bool, fn nodeFunc) []nodeResult {
+	results := make([]nodeResult, len(rl.clients))
+	var wg sync.WaitGroup
+	for i, client := range rl.clients {
+		if !pick(i) {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			nodeCtx, cancel := context.WithTimeout(ctx, redlockNodeTimeout)
+			defer cancel()
+			results[i].value, results[i].err = fn(nodeCtx, client)
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+// acquire 在所有节点上执行 try，成功的节点达到多数并且锁仍然有效时返回 true
+// 否则在成功或者结果未知(超时)的节点上执行 release，返回值为各节点的结果
+func (rl *Redlock) acquire(ctx context.Context, ttl time.Duration, try, release nodeFunc) ([]nodeResult, bool, error) {
+	start := time.Now()
+	results := rl.eachNode(ctx, try)
+
+	acquired, failed := 0, 0
+	var lastErr error
+	for _, r := range results {
+		if r.err != nil {
+			failed++
+			lastErr = r.err
+		} else if r.value > 0 {
+			acquired++
+		}
+	}
+	drift := time.Duration(float64(ttl)*redlockDriftFactor) + 2*time.Millisecond
+	validity := ttl - time.Since(start) - drift
+	if acquired >= rl.quorum() && validity > 0 {
+		return results, true, nil
+	}
+
+	rl.onNodes(context.WithoutCancel(ctx), func(i int) bool {
+		return results[i].err != nil || results[i].value > 0
+	}, release)
+	// 失败的节点太多，已经不可能拿到多数节点
+	if failed > len(rl.clients)-rl.quorum() {
+		return results, false, fmt.Errorf("redlock: %d of %d nodes failed: %w", failed, len(rl.clients), lastErr)
+	}
+	return results, false, nil
+}
+
+// renew 看门狗续期，多数节点续期成功时返回 1
+func (rl *Redlock) renew(ctx context.Context, fn nodeFunc) (int64, error) {
+	renewed, failed := 0, 0
+	var lastErr error
+	for _, r := range rl.eachNode(ctx, fn) {
+		if r.err != nil {
+			failed++
+			lastErr = r.err
+		} else if r.value > 0 {
+			renewed++
+		}
+	}
+	if renewed >= rl.quorum() {
+		return 1, nil
+	}
+	if failed > len(rl.clients)-rl.quorum() {
+		return 0, lastErr
+	}
+	return 0, nil
+}
+
+// LockWithWatchDog 在多数节点上加锁，成功时启动看门狗
+func (rl *Redlock) LockWithWatchDog(ctx context.Context, key string, ttl time.Duration) (bool, string, error) {
+	token := uuid.New().String()
+	_, acquired, err := rl.acquire(ctx, ttl,
+		func(ctx context.Context, client *redis.Client) (int64, error) {
+			ok, err := client.SetNX(ctx, key, token, ttl).Result()
+			if ok {
+				return 1, err
+			}
+			return 0, err
+		},
+		func(ctx context.Context, client *redis.Client) (int64, error) {
+			return unlockScript.Run(ctx, client, []string{key}, token, UnlockChannel(key)).Int64()
+		})
+	if err != nil || !acquired {
+		return false, "", err
+	}
+	rl.watchDogs.start(ctx, key, key, token, ttl, func(ctx context.Context) (int64, error) {
+		return rl.renew(ctx, func(ctx context.Context, client *redis.Client) (int64, error) {
+			return renewScript.Run(ctx, client, []string{key}, token, int(ttl/time.Second)).Int64()
+		})
+	})
+	return true, token, nil
+}
+
+// Lock 阻塞式加锁
+func (rl *Redlock) Lock(ctx context.Context, key string, ttl time.Duration) (context.Context, string, error) {
+	var token string
+	err := waitLock(ctx, rl.clients[0], key, func(ctx context.Context) (bool, error) {
+		acquired, t, err := rl.LockWithWatchDog(ctx, key, ttl)
+		token = t
+		return acquired, err
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return rl.LockContext(key), token, nil
+}
+
+// UnlockWithWatchDog 在所有节点上解锁，包括加锁时失败的节点
+func (rl *Redlock) UnlockWithWatchDog(ctx context.Context, key, token string) error {
+	rl.watchDogs.stop(key)
+	var lastErr error
+	for _, r := range rl.eachNode(ctx, func(ctx context.Context, client *redis.Client) (int64, error) {
+		return unlockScript.Run(ctx, client, []string{key}, token, UnlockChannel(key)).Int64()
+	}) {
+		if r.err == nil {
+			return nil
+		}
+		lastErr = r.err
+	}
+	return lastErr
+}
+
+// LockReentrant 在多数节点上获取可重入锁，第一次获取时启动看门狗
+func (rl *Redlock) LockReentrant(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	owner, ok := LockOwner(ctx)
+	if !ok {
+		return false, ErrNoLockOwner
+	}
+	results, acquired, err := rl.acquire(ctx, ttl,
+		func(ctx context.Context, client *redis.Client) (int64, error) {
+			return reentrantLockScript.Run(ctx, client, []string{key}, owner, ttl.Milliseconds()).Int64()
+		},
+		func(ctx context.Context, client *redis.Client) (int64, error) {
+			return reentrantUnlockScript.Run(ctx, client, []string{key}, owner, ttl.Milliseconds(), UnlockChannel(key)).Int64()
+		})
+	if err != nil || !acquired {
+		return false, err
+	}
+	// 各节点的重入次数可能不同(之前某个节点加锁失败)，以最大值判断是否第一次获取
+	if maxValue(results) == 1 {
+		rl.watchDogs.start(ctx, key, key, owner, ttl, func(ctx context.Context) (int64, error) {
+			return rl.renew(ctx, func(ctx context.Context, client *redis.Client) (int64, error) {
+				return reentrantRenewScript.Run(ctx, client, []string{key}, owner, int(ttl/time.Second)).Int64()
+			})
+		})
+	}
+	return true, nil
+}
+
+// LockReentrantWait 阻塞式获取可重入锁
+func (rl *Redlock) LockReentrantWait(ctx context.Context, key string, ttl time.Duration) (context.Context, error) {
+	err := waitLock(ctx, rl.clients[0], key, func(ctx context.Context) (bool, error) {
+		return rl.LockReentrant(ctx, key, ttl)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rl.LockContext(key), nil
+}
+
+// UnlockReentrant 在所有节点上释放一次，返回各节点中最大的剩余次数
+func (rl *Redlock) UnlockReentrant(ctx context.Context, key string, ttl time.Duration) (int64, error) {
+	owner, ok := LockOwner(ctx)
+	if !ok {
+		return 0, ErrNoLockOwner
+	}
+	results := rl.eachNode(ctx, func(ctx context.Context, client *redis.Client) (int64, error) {
+		return reentrantUnlockScript.Run(ctx, client, []string{key}, owner, ttl.Milliseconds(), UnlockChannel(key)).Int64()
+	})
+	count := maxValue(results)
+	if count < 0 {
+		for _, r := range results {
+			if r.err != nil {
+				return 0, r.err
+			}
+		}
+		return 0, ErrLockNotHeld
+	}
+	if count == 0 {
+		rl.watchDogs.stop(key)
+	}
+	return count, nil
+}
+
+func (rl *Redlock) LockContext(key string) context.Context {
+	return rl.watchDogs.lockContext(key, key)
+}
+
+// maxValue 返回执行成功的节点中的最大值，全部失败时返回 -1
+func maxValue(results []nodeResult) int64 {
+	value := int64(-1)
+	for _, r := range results {
+		if r.err == nil {
+			value = max(value, r.value)
+		}
+	}
+	return value
+}
@@ -0,0 +1,196 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// newRedlockNodes 启动 n 个相互独立的 miniredis 节点
+func newRedlockNodes(t *testing.T, n int) ([]*miniredis.Miniredis, *Redlock) {
+	nodes := make([]*miniredis.Miniredis, n)
+	clients := make([]*redis.Client, n)
+	for i := range nodes {
+		nodes[i] = miniredis.RunT(t)
+		clients[i] = redis.NewClient(&redis.Options{Addr: nodes[i].Addr(), MaxRetries: -1})
+	}
+	return nodes, NewRedlock(clients...)
+}
+
+func TestRedlock(t *testing.T) {
+	nodes, rl := newRedlockNodes(t, 3)
+	other := NewRedlock(rl.clients...)
+	key := "lock:order:1"
+
+	acquired, token, err := rl.LockWithWatchDog(context.Background(), key, 10*time.Second)
+	if err != nil || !acquired {
+		t.Fatalf("acquire failed: %v", err)
+	}
+	for i, node := range nodes {
+		if value, _ := node.Get(key); value != token {
+			t.Fatalf("node %d should hold the lock", i)
+		}
+	}
+	if acquired, _, _ = other.LockWithWatchDog(context.Background(), key, 10*time.Second); acquired {
+		t.Fatal("other holder should not acquire the lock")
+	}
+	if err = CheckLock(rl.LockContext(key)); err != nil {
+		t.Fatalf("lock context should be valid: %v", err)
+	}
+
+	if err = rl.UnlockWithWatchDog(context.Background(), key, token); err != nil {
+		t.Fatalf("unlock failed: %v", err)
+	}
+	for i, node := range nodes {
+		if node.Exists(key) {
+			t.Fatalf("node %d should be released", i)
+		}
+	}
+}
+
+func TestRedlockMinorityFailure(t *testing.T) {
+	nodes, rl := newRedlockNodes(t, 3)
+	key := "lock:order:2"
+
+	// 一个节点故障时仍然可以拿到多数节点
+	nodes[2].Close()
+	acquired, token, err := rl.LockWithWatchDog(context.Background(), key, 10*time.Second)
+	if err != nil || !acquired {
+		t.Fatalf("acquire with one node down failed: %v", err)
+	}
+	if err = rl.UnlockWithWatchDog(context.Background(), key, token); err != nil {
+		t.Fatalf("unlock failed: %v", err)
+	}
+
+	// 两个节点故障时无法加锁，并且释放唯一成功的节点
+	nodes[1].Close()
+	acquired, _, err = rl.LockWithWatchDog(context.Background(), key, 10*time.Second)
+	if acquired || err == nil {
+		t.Fatalf("expected error with majority down, but get %v %v", acquired, err)
+	}
+	if nodes[0].Exists(key) {
+		t.Fatal("partially acquired node should be released")
+	}
+}
+
+func TestRedlockMajorityHeld(t *testing.T) {
+	nodes, rl := newRedlockNodes(t, 3)
+	key := "lock:order:3"
+
+	// 其他持有者已经在多数节点上持有锁(例如主从切换后的旧锁)，只在少数节点上成功时要释放
+	nodes[0].Set(key, "other")
+	nodes[1].Set(key, "other")
+	acquired, _, err := rl.LockWithWatchDog(context.Background(), key, 10*time.Second)
+	if err != nil || acquired {
+		t.Fatalf("should not acquire when the majority is held: %v %v", acquired, err)
+	}
+	if nodes[2].Exists(key) {
+		t.Fatal("minority node should be released")
+	}
+	if value, _ := nodes[0].Get(key); value != "other" {
+		t.Fatal("other holder's lock should not be released")
+	}
+}
+
+func TestRedlockClockDrift(t *testing.T) {
+	nodes, rl := newRedlockNodes(t, 3)
+	key := "lock:order:4"
+
+	// ttl 小于时钟漂移的余量，拿到所有节点也已经失效
+	acquired, _, err := rl.LockWithWatchDog(context.Background(), key, time.Millisecond)
+	if err != nil || acquired {
+		t.Fatalf("should not acquire when validity is exhausted: %v %v", acquired, err)
+	}
+	for i, node := range nodes {
+		if node.Exists(key) {
+			t.Fatalf("node %d should be released", i)
+		}
+	}
+}
+
+func TestRedlockReentrant(t *testing.T) {
+	nodes, rl := newRedlockNodes(t, 3)
+	key := "lock:order:5"
+	ctx := WithLockOwner(context.Background())
+
+	for i := 1; i <= 2; i++ {
+		if acquired, err := rl.LockReentrant(ctx, key, 10*time.Second); err != nil || !acquired {
+			t.Fatalf("reentrant acquire %d failed: %v", i, err)
+		}
+	}
+	other := WithLockOwner(context.Background())
+	waitCtx, cancel := context.WithTimeout(other, 100*time.Millisecond)
+	defer cancel()
+	if _, err := rl.LockReentrantWait(waitCtx, key, 10*time.Second); !errors.Is(err, ErrLockTimeout) {
+		t.Fatalf("expected ErrLockTimeout, but get %v", err)
+	}
+	if _, err := rl.UnlockReentrant(other, key, 10*time.Second); !errors.Is(err, ErrLockNotHeld) {
+		t.Fatalf("expected ErrLockNotHeld, but get %v", err)
+	}
+
+	for want := int64(1); want >= 0; want-- {
+		count, err := rl.UnlockReentrant(ctx, key, 10*time.Second)
+		if err != nil || count != want {
+			t.Fatalf("expected remaining %d, but get %d %v", want, count, err)
+		}
+	}
+	for i, node := range nodes {
+		if node.Exists(key) {
+			t.Fatalf("node %d should be released", i)
+		}
+	}
+	if err := CheckLock(rl.LockContext(key)); !errors.Is(err, ErrLockLost) {
+		t.Fatalf("expected ErrLockLost after release, but get %v", err)
+	}
+}
+
+func TestRedlockWatchDog(t *testing.T) {
+	nodes, rl := newRedlockNodes(t, 3)
+	key := "lock:order:6"
+
+	acquired, token, err := rl.LockWithWatchDog(context.Background(), key, 2*time.Second)
+	if err != nil || !acquired {
+		t.Fatalf("acquire failed: %v", err)
+	}
+	defer rl.UnlockWithWatchDog(context.Background(), key, token)
+	lockCtx := rl.LockContext(key)
+
+	// 少数节点上的锁被删除不影响续期
+	nodes[0].Del(key)
+	time.Sleep(1500 * time.Millisecond)
+	if err = CheckLock(lockCtx); err != nil {
+		t.Fatalf("lock should be renewed on the majority: %v", err)
+	}
+
+	// 多数节点上的锁丢失后取消锁上下文
+	nodes[1].Del(key)
+	select {
+	case <-lockCtx.Done():
+	case <-time.After(2 * time.Second):
+		t.Fatal("lock context should be cancelled after the majority is lost")
+	}
+	if err = CheckLock(lockCtx); !errors.Is(err, ErrLockLost) {
+		t.Fatalf("expected ErrLockLost, but get %v", err)
+	}
+}
+
+func TestRedlockNodeCount(t *testing.T) {
+	for _, n := range []int{0, 1, 2, 4} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Fatalf("NewRedlock with %d nodes should panic", n)
+				}
+			}()
+			clients := make([]*redis.Client, n)
+			for i := range clients {
+				clients[i] = redis.NewClient(&redis.Options{})
+			}
+			NewRedlock(clients...)
+		}()
+	}
+}
@@ -0,0 +1,120 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+// 可重入锁：锁保存为 hash，field 为持有者标识，value 为重入次数
+// Go 没有线程id，持有者标识通过 context 传递，同一个 context 链上的调用可以重复获取同一把锁
+
+var (
+	ErrNoLockOwner  = errors.New("context has no lock owner, use WithLockOwner first")
+	ErrLockNotHeld  = errors.New("lock is not held by the owner")
+	lockOwnerCtxKey = lockOwnerKey{}
+)
+
+type lockOwnerKey struct{}
+
+// reentrantLockScript 锁不存在或者由自己持有时重入次数加一，返回重入次数；被其他持有者占用时返回 0
+var reentrantLockScript = redis.NewScript(`
+    if redis.call("EXISTS", KEYS[1]) == 0 or redis.call("HEXISTS", KEYS[1], ARGV[1]) == 1 then
+        local count = redis.call("HINCRBY", KEYS[1], ARGV[1], 1)
+        redis.call("PEXPIRE", KEYS[1], ARGV[2])
+        return count
+    end
+    return 0
+`)
+
+// reentrantUnlockScript 重入次数减一，减到 0 时删除锁并发布解锁通知；返回剩余次数，不是持有者时返回 -1
+var reentrantUnlockScript = redis.NewScript(`
+    if redis.call("HEXISTS", KEYS[1], ARGV[1]) == 0 then
+        return -1
+    end
+    local count = redis.call("HINCRBY", KEYS[1], ARGV[1], -1)
+    if count > 0 then
+        redis.call("PEXPIRE", KEYS[1], ARGV[2])
+        return count
+    end
+    redis.call("DEL", KEYS[1])
+    redis.call("PUBLISH", ARGV[3], KEYS[1])
+    return 0
+`)
+
+// reentrantRenewScript 看门狗续期：持有者仍然持有锁时续期
+var reentrantRenewScript = redis.NewScript(`
+    if redis.call("HEXISTS", KEYS[1], ARGV[1]) == 1 then
+        return redis.call("EXPIRE", KEYS[1], ARGV[2])
+    else
+        return 0
+    end
+`)
+
+// WithLockOwner 返回携带锁持有者标识的 context，已经携带时原样返回
+func WithLockOwner(ctx context.Context) context.Context {
+	if _, ok := LockOwner(ctx); ok {
+		return ctx
+	}
+	return context.WithValue(ctx, lockOwnerCtxKey, uuid.New().String())
+}
+
+// LockOwner 返回 context 中的锁持有者标识
+func LockOwner(ctx context.Context) (string, bool) {
+	owner, ok := ctx.Value(lockOwnerCtxKey).(string)
+	return owner, ok
+}
+
+// LockReentrant 获取可重入锁，同一个持有者可以重复获取，第一次获取时启动看门狗
+func (dl *DistributedLock) LockReentrant(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	owner, ok := LockOwner(ctx)
+	if !ok {
+		return false, ErrNoLockOwner
+	}
+	count, err := reentrantLockScript.Run(ctx, dl.client, []string{key}, owner, ttl.Milliseconds()).Int64()
+	if err != nil {
+		return false, err
+	}
+	if count == 0 {
+		return false, nil
+	}
+	if count == 1 {
+		dl.startWatchDog(ctx, key, owner, ttl, reentrantRenewScript)
+	}
+	return true, nil
+}
+
+// UnlockReentrant 释放一次可重入锁，返回剩余的重入次数，减到 0 时停止看门狗
+func (dl *DistributedLock) UnlockReentrant(ctx context.Context, key string, ttl time.Duration) (int64, error) {
+	owner, ok := LockOwner(ctx)
+	if !ok {
+		return 0, ErrNoLockOwner
+	}
+	count, err := reentrantUnlockScript.Run(ctx, dl.client, []string{key}, owner, ttl.Milliseconds(), UnlockChannel(key)).Int64()
+	if err != nil {
+		return 0, err
+	}
+	if count < 0 {
+		return 0, ErrLockNotHeld
+	}
+	if count == 0 {
+		dl.stopWatchDog(key)
+	}
+	return count, nil
+}
+
+// HoldCount 返回当前持有者的重入次数，没有持有锁时返回 0
+func (dl *DistributedLock) HoldCount(ctx context.Context, key string) (int64, error) {
+	owner, ok := LockOwner(ctx)
+	if !ok {
+		return 0, ErrNoLockOwner
+	}
+	count, err := dl.client.HGet(ctx, key, owner).Int64()
+	if errors.Is(err, redis.Nil) {
+		return 0, nil
+	}
+	return count, err
+}
@@ -0,0 +1,73 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestReentrantLock(t *testing.T) {
+	mr := miniredis.RunT(t)
+	lock := NewDistributedLock(redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+	key := "lock:order:1"
+
+	if _, err := lock.LockReentrant(context.Background(), key, 10*time.Second); !errors.Is(err, ErrNoLockOwner) {
+		t.Fatalf("expected ErrNoLockOwner, but get %v", err)
+	}
+
+	ctx := WithLockOwner(context.Background())
+	for i := 1; i <= 3; i++ {
+		acquired, err := lock.LockReentrant(ctx, key, 10*time.Second)
+		if err != nil || !acquired {
+			t.Fatalf("reentrant acquire %d failed: %v", i, err)
+		}
+	}
+	if count, _ := lock.HoldCount(ctx, key); count != 3 {
+		t.Fatalf("expected hold count 3, but get %d", count)
+	}
+
+	// 其他持有者无法获取，也无法释放
+	other := WithLockOwner(context.Background())
+	if acquired, _ := lock.LockReentrant(other, key, 10*time.Second); acquired {
+		t.Fatal("other owner should not acquire the lock")
+	}
+	if _, err := lock.UnlockReentrant(other, key, 10*time.Second); !errors.Is(err, ErrLockNotHeld) {
+		t.Fatalf("expected ErrLockNotHeld, but get %v", err)
+	}
+
+	for want := int64(2); want >= 0; want-- {
+		count, err := lock.UnlockReentrant(ctx, key, 10*time.Second)
+		if err != nil || count != want {
+			t.Fatalf("expected remaining %d, but get %d %v", want, count, err)
+		}
+	}
+	if mr.Exists(key) {
+		t.Fatal("lock should be deleted after the last unlock")
+	}
+	if acquired, _ := lock.LockReentrant(other, key, 10*time.Second); !acquired {
+		t.Fatal("other owner should acquire the released lock")
+	}
+}
+
+func TestReentrantLockWatchDog(t *testing.T) {
+	mr := miniredis.RunT(t)
+	lock := NewDistributedLock(redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+	ctx := WithLockOwner(context.Background())
+	key := "lock:order:2"
+
+	if acquired, err := lock.LockReentrant(ctx, key, 2*time.Second); err != nil || !acquired {
+		t.Fatalf("acquire failed: %v", err)
+	}
+	defer lock.UnlockReentrant(ctx, key, 2*time.Second)
+
+	// 看门狗每 ttl/2 续期一次，miniredis 的过期时间需要手动推进
+	mr.FastForward(1500 * time.Millisecond)
+	time.Sleep(1200 * time.Millisecond)
+	if ttl := mr.TTL(key); ttl < time.Second {
+		t.Fatalf("expected the watchdog to renew the lock, ttl=%v", ttl)
+	}
+}
@@ -0,0 +1,155 @@
+package utils
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+// ReadWriteLock 分布式读写锁：多个读者可以同时持有，写者独占
+// 锁保存为 hash：mode 为 read/write，持有者 -> 重入次数，exp:持有者 -> 过期时间(毫秒时间戳)
+// 每个持有者单独记录过期时间，宕机的读者不会因为其他读者的续期而一直占用锁
+// 持有者标识优先使用 context 中的 LockOwner，同一个持有者可以重入，但不支持持有写锁时再获取读锁
+type ReadWriteLock struct {
+	client    *redis.Client
+	watchDogs *watchDogs
+}
+
+func NewReadWriteLock(client *redis.Client) *ReadWriteLock {
+	return &ReadWriteLock{client: client, watchDogs: newWatchDogs(client)}
+}
+
+// rwPurge 清理已经过期的持有者，只剩 mode 字段时删除整个锁
+const rwPurge = `
+local function purge(key, now)
+    local fields = redis.call("HGETALL", key)
+    for i = 1, #fields, 2 do
+        local field = fields[i]
+        if string.sub(field, 1, 4) == "exp:" and tonumber(fields[i + 1]) < now then
+            redis.call("HDEL", key, field, string.sub(field, 5))
+        end
+    end
+    if redis.call("HLEN", key) <= 1 then
+        redis.call("DEL", key)
+    end
+end
+
+local function hold(key, owner, ttl, now)
+    local count = redis.call("HINCRBY", key, owner, 1)
+    redis.call("HSET", key, "exp:" .. owner, now + ttl)
+    if redis.call("PTTL", key) < ttl then
+        redis.call("PEXPIRE", key, ttl)
+    end
+    return count
+end
+`
+
+// rwReadLockScript 没有写者时获取读锁，返回重入次数，获取失败返回 0
+var rwReadLockScript = redis.NewScript(rwPurge + `
+purge(KEYS[1], tonumber(ARGV[3]))
+local mode = redis.call("HGET", KEYS[1], "mode")
+if mode == false or mode == "read" then
+    redis.call("HSET", KEYS[1], "mode", "read")
+    return hold(KEYS[1], ARGV[1], tonumber(ARGV[2]), tonumber(ARGV[3]))
+end
+return 0
+`)
+
+// rwWriteLockScript 没有其他持有者时获取写锁，写者可以重入
+var rwWriteLockScript = redis.NewScript(rwPurge + `
+purge(KEYS[1], tonumber(ARGV[3]))
+local mode = redis.call("HGET", KEYS[1], "mode")
+if mode == false or (mode == "write" and redis.call("HEXISTS", KEYS[1], ARGV[1]) == 1) then
+    redis.call("HSET", KEYS[1], "mode", "write")
+    return hold(KEYS[1], ARGV[1], tonumber(ARGV[2]), tonumber(ARGV[3]))
+end
+return 0
+`)
+
+// rwUnlockScript 重入次数减一，最后一个持有者释放时删除锁并发布解锁通知
+var rwUnlockScript = redis.NewScript(`
+if redis.call("HEXISTS", KEYS[1], ARGV[1]) == 0 then
+    return -1
+end
+local count = redis.call("HINCRBY", KEYS[1], ARGV[1], -1)
+if count > 0 then
+    return count
+end
+redis.call("HDEL", KEYS[1], ARGV[1], "exp:" .. ARGV[1])
+if redis.call("HLEN", KEYS[1]) <= 1 then
+    redis.call("DEL", KEYS[1])
+end
+redis.call("PUBLISH", ARGV[2], KEYS[1])
+return 0
+`)
+
+// rwRenewScript 看门狗续期
+var rwRenewScript = redis.NewScript(`
+if redis.call("HEXISTS", KEYS[1], ARGV[1]) == 0 then
+    return 0
+end
+local ttl = tonumber(ARGV[2])
+redis.call("HSET", KEYS[1], "exp:" .. ARGV[1], tonumber(ARGV[3]) + ttl)
+if redis.call("PTTL", KEYS[1]) < ttl then
+    redis.call("PEXPIRE", KEYS[1], ttl)
+end
+return 1
+`)
+
+// RLock 阻塞式获取读锁，返回的 lockCtx 在锁丢失时被取消，token 用于解锁
+func (rw *ReadWriteLock) RLock(ctx context.Context, key string, ttl time.Duration) (context.Context, string, error) {
+	return rw.lock(ctx, key, ttl, rwReadLockScript)
+}
+
+// Lock 阻塞式获取写锁
+func (rw *ReadWriteLock) Lock(ctx context.Context, key string, ttl time.Duration) (context.Context, string, error) {
+	return rw.lock(ctx, key, ttl, rwWriteLockScript)
+}
+
+// RUnlock 释放读锁
+func (rw *ReadWriteLock) RUnlock(ctx context.Context, key, token string) error {
+	return rw.unlock(ctx, key, token)
+}
+
+// Unlock 释放写锁
+func (rw *ReadWriteLock) Unlock(ctx context.Context, key, token string) error {
+	return rw.unlock(ctx, key, token)
+}
+
+func (rw *ReadWriteLock) lock(ctx context.Context, key string, ttl time.Duration, script *redis.Script) (context.Context, string, error) {
+	owner, ok := LockOwner(ctx)
+	if !ok {
+		owner = uuid.New().String()
+	}
+	id := key + "|" + owner
+	err := waitLock(ctx, rw.client, key, func(ctx context.Context) (bool, error) {
+		count, err := script.Run(ctx, rw.client, []string{key}, owner, ttl.Milliseconds(), time.Now().UnixMilli()).Int64()
+		if count == 1 {
+			rw.watchDogs.start(ctx, id, key, owner, ttl, func(ctx context.Context) (int64, error) {
+				return rwRenewScript.Run(ctx, rw.client, []string{key}, owner, ttl.Milliseconds(), time.Now().UnixMilli()).Int64()
+			})
+		}
+		return count > 0, err
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return rw.watchDogs.lockContext(id, key), owner, nil
+}
+
+func (rw *ReadWriteLock) unlock(ctx context.Context, key, token string) error {
+	count, err := rwUnlockScript.Run(ctx, rw.client, []string{key}, token, UnlockChannel(key)).Int64()
+	if err != nil {
+		return err
+	}
+	if count < 0 {
+		rw.watchDogs.stop(key + "|" + token)
+		return ErrLockNotHeld
+	}
+	if count == 0 {
+		rw.watchDogs.stop(key + "|" + token)
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestReadWriteLock(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rw := NewReadWriteLock(redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+	key := "lock:shop:rw:1"
+
+	// 多个读者可以同时持有
+	_, r1, err := rw.RLock(context.Background(), key, 10*time.Second)
+	if err != nil {
+		t.Fatalf("first reader failed: %v", err)
+	}
+	_, r2, err := rw.RLock(context.Background(), key, 10*time.Second)
+	if err != nil {
+		t.Fatalf("second reader failed: %v", err)
+	}
+
+	// 有读者时写者等待
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if _, _, err = rw.Lock(ctx, key, 10*time.Second); !errors.Is(err, ErrLockTimeout) {
+		t.Fatalf("expected ErrLockTimeout, but get %v", err)
+	}
+
+	if err = rw.RUnlock(context.Background(), key, r1); err != nil {
+		t.Fatalf("unlock first reader failed: %v", err)
+	}
+	if err = rw.RUnlock(context.Background(), key, r1); !errors.Is(err, ErrLockNotHeld) {
+		t.Fatalf("expected ErrLockNotHeld, but get %v", err)
+	}
+
+	// 最后一个读者释放后唤醒写者
+	acquired := make(chan string, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		_, token, err := rw.Lock(ctx, key, 10*time.Second)
+		if err != nil {
+			t.Errorf("writer failed: %v", err)
+		}
+		acquired <- token
+	}()
+	time.Sleep(50 * time.Millisecond)
+	if err = rw.RUnlock(context.Background(), key, r2); err != nil {
+		t.Fatalf("unlock second reader failed: %v", err)
+	}
+	w := <-acquired
+
+	// 持有写锁时读者等待
+	ctx2, cancel2 := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel2()
+	if _, _, err = rw.RLock(ctx2, key, 10*time.Second); !errors.Is(err, ErrLockTimeout) {
+		t.Fatalf("expected ErrLockTimeout, but get %v", err)
+	}
+	if err = rw.Unlock(context.Background(), key, w); err != nil {
+		t.Fatalf("unlock writer failed: %v", err)
+	}
+	if mr.Exists(key) {
+		t.Fatal("lock should be deleted after the writer unlocks")
+	}
+}
+
+func TestReadWriteLockReentrant(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rw := NewReadWriteLock(redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+	key := "lock:shop:rw:2"
+	ctx := WithLockOwner(context.Background())
+
+	_, token, err := rw.Lock(ctx, key, 10*time.Second)
+	if err != nil {
+		t.Fatalf("first acquire failed: %v", err)
+	}
+	if _, _, err = rw.Lock(ctx, key, 10*time.Second); err != nil {
+		t.Fatalf("reentrant acquire failed: %v", err)
+	}
+	if err = rw.Unlock(ctx, key, token); err != nil || !mr.Exists(key) {
+		t.Fatalf("lock should be held after the first unlock: %v", err)
+	}
+	if err = rw.Unlock(ctx, key, token); err != nil || mr.Exists(key) {
+		t.Fatalf("lock should be deleted after the last unlock: %v", err)
+	}
+}
+
+func TestReadWriteLockExpiredReader(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rw := NewReadWriteLock(redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+	key := "lock:shop:rw:3"
+
+	// 一个读者宕机(看门狗停止)，另一个读者正常续期，宕机读者过期后写者依然可以获取
+	_, crashed, err := rw.RLock(context.Background(), key, 200*time.Millisecond)
+	if err != nil {
+		t.Fatalf("crashed reader failed: %v", err)
+	}
+	rw.watchDogs.stop(key + "|" + crashed)
+	_, alive, err := rw.RLock(context.Background(), key, 10*time.Second)
+	if err != nil {
+		t.Fatalf("alive reader failed: %v", err)
+	}
+	time.Sleep(250 * time.Millisecond)
+	if err = rw.RUnlock(context.Background(), key, alive); err != nil {
+		t.Fatalf("unlock alive reader failed: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if _, _, err = rw.Lock(ctx, key, 10*time.Second); err != nil {
+		t.Fatalf("writer should acquire after the crashed reader expired: %v", err)
+	}
+}
@@ -0,0 +1,108 @@
+package utils
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+// Semaphore 分布式计数信号量：同一个 key 最多同时发放 permits 个许可
+// 许可保存为 zset，member 为许可id，score 为过期时间(毫秒时间戳)，获取时先清理过期的许可，
+// 持有者宕机后许可会在 ttl 之后自动回收，正常持有期间由看门狗续期
+type Semaphore struct {
+	client    *redis.Client
+	watchDogs *watchDogs
+}
+
+func NewSemaphore(client *redis.Client) *Semaphore {
+	return &Semaphore{client: client, watchDogs: newWatchDogs(client)}
+}
+
+// semaphoreAcquireScript 清理过期许可后，还有剩余许可时发放，成功返回 1
+var semaphoreAcquireScript = redis.NewScript(`
+    local now = tonumber(ARGV[3])
+    local ttl = tonumber(ARGV[4])
+    redis.call("ZREMRANGEBYSCORE", KEYS[1], "-inf", now)
+    if redis.call("ZCARD", KEYS[1]) < tonumber(ARGV[2]) then
+        redis.call("ZADD", KEYS[1], now + ttl, ARGV[1])
+        if redis.call("PTTL", KEYS[1]) < ttl then
+            redis.call("PEXPIRE", KEYS[1], ttl)
+        end
+        return 1
+    end
+    return 0
+`)
+
+// semaphoreReleaseScript 归还许可并发布通知，许可不存在(已经过期被回收)时返回 0
+var semaphoreReleaseScript = redis.NewScript(`
+    if redis.call("ZREM", KEYS[1], ARGV[1]) == 0 then
+        return 0
+    end
+    redis.call("PUBLISH", ARGV[2], KEYS[1])
+    return 1
+`)
+
+// semaphoreRenewScript 看门狗续期，许可已经被回收时返回 0
+var semaphoreRenewScript = redis.NewScript(`
+    if redis.call("ZSCORE", KEYS[1], ARGV[1]) == false then
+        return 0
+    end
+    local ttl = tonumber(ARGV[2])
+    redis.call("ZADD", KEYS[1], "XX", tonumber(ARGV[3]) + ttl, ARGV[1])
+    if redis.call("PTTL", KEYS[1]) < ttl then
+        redis.call("PEXPIRE", KEYS[1], ttl)
+    end
+    return 1
+`)
+
+// TryAcquire 尝试获取一个许可，成功时启动看门狗并返回许可id
+func (s *Semaphore) TryAcquire(ctx context.Context, key string, permits int, ttl time.Duration) (bool, string, error) {
+	permitId := uuid.New().String()
+	result, err := semaphoreAcquireScript.Run(ctx, s.client, []string{key}, permitId, permits, time.Now().UnixMilli(), ttl.Milliseconds()).Int64()
+	if err != nil || result == 0 {
+		return false, "", err
+	}
+	s.watchDogs.start(ctx, key+"|"+permitId, key, permitId, ttl, func(ctx context.Context) (int64, error) {
+		return semaphoreRenewScript.Run(ctx, s.client, []string{key}, permitId, ttl.Milliseconds(), time.Now().UnixMilli()).Int64()
+	})
+	return true, permitId, nil
+}
+
+// Acquire 阻塞式获取许可，直到 ctx 结束；返回的 lockCtx 在许可丢失时被取消
+func (s *Semaphore) Acquire(ctx context.Context, key string, permits int, ttl time.Duration) (context.Context, string, error) {
+	var permitId string
+	err := waitLock(ctx, s.client, key, func(ctx context.Context) (bool, error) {
+		acquired, id, err := s.TryAcquire(ctx, key, permits, ttl)
+		permitId = id
+		return acquired, err
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return s.watchDogs.lockContext(key+"|"+permitId, key), permitId, nil
+}
+
+// Release 归还许可，许可已经过期被回收时返回 ErrLockNotHeld
+func (s *Semaphore) Release(ctx context.Context, key, permitId string) error {
+	s.watchDogs.stop(key + "|" + permitId)
+	result, err := semaphoreReleaseScript.Run(ctx, s.client, []string{key}, permitId, UnlockChannel(key)).Int64()
+	if err != nil {
+		return err
+	}
+	if result == 0 {
+		return ErrLockNotHeld
+	}
+	return nil
+}
+
+// Available 返回当前剩余的许可数量，只用于观察，不保证随后获取一定成功
+func (s *Semaphore) Available(ctx context.Context, key string, permits int) (int, error) {
+	held, err := s.client.ZCount(ctx, key, "("+strconv.FormatInt(time.Now().UnixMilli(), 10), "+inf").Result()
+	if err != nil {
+		return 0, err
+	}
+	return max(permits-int(held), 0), nil
+}
@@ -0,0 +1,99 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestSemaphore(t *testing.T) {
+	mr := miniredis.RunT(t)
+	sem := NewSemaphore(redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+	key := "semaphore:order:1"
+
+	var permitIds []string
+	for i := 0; i < 3; i++ {
+		acquired, permitId, err := sem.TryAcquire(context.Background(), key, 3, 10*time.Second)
+		if err != nil || !acquired {
+			t.Fatalf("acquire permit %d failed: %v", i, err)
+		}
+		permitIds = append(permitIds, permitId)
+	}
+	if acquired, _, _ := sem.TryAcquire(context.Background(), key, 3, 10*time.Second); acquired {
+		t.Fatal("should not acquire more than 3 permits")
+	}
+	if available, _ := sem.Available(context.Background(), key, 3); available != 0 {
+		t.Fatalf("expected 0 available permits, but get %d", available)
+	}
+
+	if err := sem.Release(context.Background(), key, permitIds[0]); err != nil {
+		t.Fatalf("release failed: %v", err)
+	}
+	if err := sem.Release(context.Background(), key, permitIds[0]); !errors.Is(err, ErrLockNotHeld) {
+		t.Fatalf("expected ErrLockNotHeld, but get %v", err)
+	}
+	if acquired, _, _ := sem.TryAcquire(context.Background(), key, 3, 10*time.Second); !acquired {
+		t.Fatal("should acquire the released permit")
+	}
+}
+
+func TestSemaphoreExpiredPermit(t *testing.T) {
+	mr := miniredis.RunT(t)
+	sem := NewSemaphore(redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+	key := "semaphore:order:2"
+
+	// 持有者宕机后许可在 ttl 之后被回收
+	acquired, permitId, err := sem.TryAcquire(context.Background(), key, 1, 200*time.Millisecond)
+	if err != nil || !acquired {
+		t.Fatalf("acquire failed: %v", err)
+	}
+	sem.watchDogs.stop(key + "|" + permitId)
+	time.Sleep(250 * time.Millisecond)
+	if acquired, _, _ = sem.TryAcquire(context.Background(), key, 1, 10*time.Second); !acquired {
+		t.Fatal("expired permit should be reclaimed")
+	}
+}
+
+func TestSemaphoreAcquireConcurrency(t *testing.T) {
+	mr := miniredis.RunT(t)
+	sem := NewSemaphore(redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+	key := "semaphore:order:3"
+
+	var running, peak atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			_, permitId, err := sem.Acquire(ctx, key, 2, 10*time.Second)
+			if err != nil {
+				t.Errorf("acquire failed: %v", err)
+				return
+			}
+			n := running.Add(1)
+			for {
+				p := peak.Load()
+				if n <= p || peak.CompareAndSwap(p, n) {
+					break
+				}
+			}
+			time.Sleep(20 * time.Millisecond)
+			running.Add(-1)
+			if err = sem.Release(context.Background(), key, permitId); err != nil {
+				t.Errorf("release failed: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if peak.Load() > 2 {
+		t.Fatalf("expected at most 2 concurrent holders, but get %d", peak.Load())
+	}
+}
@@ -0,0 +1,196 @@
+package utils
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode"
+
+	"github.com/sirupsen/logrus"
+)
+
+// 命中敏感词时的处理策略
+const (
+	SENSITIVE_REJECT = "reject" // 拒绝保存
+	SENSITIVE_MASK   = "mask"   // 把敏感词替换为*
+	SENSITIVE_REVIEW = "review" // 原样保存，隐藏后等待人工审核
+)
+
+// SensitiveWords 全局词库，启动时从 SENSITIVE_WORDS_PATH 加载
+var SensitiveWords = NewSensitiveFilter(nil)
+
+// SensitiveFilter 基于DFA(字典树)的敏感词过滤器：忽略大小写，匹配时跳过夹在敏感词中间的空白和符号，例如 "赌 博"；
+// 同一位置有多个敏感词时取最长的一个。重新加载时整体替换字典树，不影响正在进行的匹配
+type SensitiveFilter struct {
+	root    atomic.Pointer[trieNode]
+	mutex   sync.Mutex // 保护 modTime，避免并发重新加载
+	modTime time.Time
+}
+
+type trieNode struct {
+	children map[rune]*trieNode
+	end      bool
+}
+
+func NewSensitiveFilter(words []string) *SensitiveFilter {
+	f := &SensitiveFilter{}
+	f.Reset(words)
+	return f
+}
+
+// Reset 用 words 重建字典树
+func (f *SensitiveFilter) Reset(words []string) {
+	root := &trieNode{children: make(map[rune]*trieNode)}
+	for _, word := range words {
+		node := root
+		for _, r := range strings.ToLower(strings.TrimSpace(word)) {
+			child, ok := node.children[r]
+			if !ok {
+				child = &trieNode{children: make(map[rune]*trieNode)}
+				node.children[r] = child
+			}
+			node = child
+		}
+		if node != root {
+			node.end = true
+		}
+	}
+	f.root.Store(root)
+}
+
+// LoadFile 从文件加载词库，每行一个词，忽略空行和 # 开头的注释
+func (f *SensitiveFilter) LoadFile(path string) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.loadFile(path)
+}
+
+func (f *SensitiveFilter) loadFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	var words []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		words = append(words, line)
+	}
+	if err = scanner.Err(); err != nil {
+		return err
+	}
+	f.Reset(words)
+	f.modTime = info.ModTime()
+	logrus.Infof("loaded %d sensitive words from %s", len(words), path)
+	return nil
+}
+
+// Watch 每隔 interval 检查一次文件的修改时间，修改后重新加载，直到 ctx 取消
+func (f *SensitiveFilter) Watch(ctx context.Context, path string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := f.reloadIfModified(path); err != nil {
+			logrus.Warnf("reload sensitive words from %s failed: %v", path, err)
+		}
+	}
+}
+
+func (f *SensitiveFilter) reloadIfModified(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if info.ModTime().Equal(f.modTime) {
+		return nil
+	}
+	return f.loadFile(path)
+}
+
+// match 返回从 start 开始的最长敏感词的结束位置(不包含)，没有匹配时返回 -1
+func (root *trieNode) match(runes []rune, start int) int {
+	node, end := root, -1
+	for i := start; i < len(runes); i++ {
+		child, ok := node.children[unicode.ToLower(runes[i])]
+		if !ok {
+			// 敏感词中间的空白和符号不影响匹配
+			if node != root && !unicode.IsLetter(runes[i]) && !unicode.IsNumber(runes[i]) {
+				continue
+			}
+			break
+		}
+		node = child
+		if node.end {
+			end = i + 1
+		}
+	}
+	return end
+}
+
+// scan 依次找出 text 中的敏感词，对每个匹配的位置 [start, end) 调用 fn
+func (f *SensitiveFilter) scan(runes []rune, fn func(start, end int)) {
+	root := f.root.Load()
+	for i := 0; i < len(runes); {
+		if end := root.match(runes, i); end > 0 {
+			fn(i, end)
+			i = end
+			continue
+		}
+		i++
+	}
+}
+
+// Find 返回 text 中出现的敏感词(按原文，去重)
+func (f *SensitiveFilter) Find(text string) []string {
+	var words []string
+	seen := make(map[string]bool)
+	runes := []rune(text)
+	f.scan(runes, func(start, end int) {
+		word := string(runes[start:end])
+		if !seen[word] {
+			seen[word] = true
+			words = append(words, word)
+		}
+	})
+	return words
+}
+
+func (f *SensitiveFilter) Contains(text string) bool {
+	return len(f.Find(text)) > 0
+}
+
+// Mask 把 text 中的敏感词逐字替换为*
+func (f *SensitiveFilter) Mask(text string) string {
+	runes := []rune(text)
+	masked := false
+	f.scan(runes, func(start, end int) {
+		for i := start; i < end; i++ {
+			runes[i] = '*'
+		}
+		masked = true
+	})
+	if !masked {
+		return text
+	}
+	return string(runes)
+}
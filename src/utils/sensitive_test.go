@@ -0,0 +1,64 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSensitiveFilter(t *testing.T) {
+	f := NewSensitiveFilter([]string{"赌博", "赌博网站", "毒品", "Spam"})
+
+	cases := []struct {
+		text   string
+		words  []string
+		masked string
+	}{
+		{"今天天气不错", nil, "今天天气不错"},
+		{"远离赌博和毒品", []string{"赌博", "毒品"}, "远离**和**"},
+		{"这是一个赌博网站", []string{"赌博网站"}, "这是一个****"},
+		{"赌 博, 赌-博", []string{"赌 博", "赌-博"}, "***, ***"},
+		{"no SPAM please", []string{"SPAM"}, "no **** please"},
+		{"赌钱", nil, "赌钱"},
+		{"赌博赌博", []string{"赌博"}, "****"},
+	}
+	for _, c := range cases {
+		if words := f.Find(c.text); !reflect.DeepEqual(words, c.words) {
+			t.Errorf("Find(%q) = %v, expected %v", c.text, words, c.words)
+		}
+		if masked := f.Mask(c.text); masked != c.masked {
+			t.Errorf("Mask(%q) = %q, expected %q", c.text, masked, c.masked)
+		}
+	}
+}
+
+func TestSensitiveFilterReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "words.txt")
+	if err := os.WriteFile(path, []byte("# comment\n赌博\n\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	f := NewSensitiveFilter(nil)
+	if err := f.LoadFile(path); err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if !f.Contains("赌博") || f.Contains("毒品") || f.Contains("comment") {
+		t.Fatal("unexpected words after load")
+	}
+
+	if err := os.WriteFile(path, []byte("毒品\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// 文件系统的修改时间精度可能不足，手动把修改时间调到之后
+	later := time.Now().Add(time.Second)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.reloadIfModified(path); err != nil {
+		t.Fatalf("reload failed: %v", err)
+	}
+	if f.Contains("赌博") || !f.Contains("毒品") {
+		t.Fatal("words are not reloaded")
+	}
+}
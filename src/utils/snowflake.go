@@ -0,0 +1,200 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+)
+
+// Snowflake 不依赖网络的id生成器：1 位标记 + 40 位毫秒时间戳(相对 BEGIN_TIMESTAMP) + 10 位机器id + 12 位序号
+// 机器id可以在配置中指定，也可以从Redis租用；租用时Redis暂时不可用不影响生成，直到租约过期为止
+// 标记位(第 62 位)保证从 RedisWorker 切换过来后id仍然大于之前生成的所有id：RedisWorker 的秒数要到 2058 年才会用到这一位，
+// 毫秒时间戳的 40 位同样可以用到 2058 年
+const (
+	SNOWFLAKE_WORKER_BITS   = 10
+	SNOWFLAKE_SEQUENCE_BITS = 12
+	SNOWFLAKE_MAX_WORKER    = 1<<SNOWFLAKE_WORKER_BITS - 1
+	SNOWFLAKE_MARKER        = int64(1) << 62
+	snowflakeSequenceMask   = 1<<SNOWFLAKE_SEQUENCE_BITS - 1
+)
+
+var (
+	ErrClockBackwards     = errors.New("clock moved backwards")
+	ErrNoWorkerId         = errors.New("no snowflake worker id available")
+	ErrWorkerLeaseExpired = errors.New("snowflake worker id lease expired")
+)
+
+type Snowflake struct {
+	workerId int64
+	mutex    sync.Mutex
+	lastTime int64 // 毫秒
+	sequence int64
+
+	// 租用机器id时的租约，leaseExpire 为 0 表示机器id来自配置，不会过期
+	client      *redis.Client
+	leaseValue  string
+	leaseExpire atomic.Int64
+	stopLease   context.CancelFunc
+}
+
+// NewSnowflake 使用配置中的机器id
+func NewSnowflake(workerId int64) (*Snowflake, error) {
+	if workerId < 0 || workerId > SNOWFLAKE_MAX_WORKER {
+		return nil, fmt.Errorf("snowflake worker id must be in [0, %d], but get %d", SNOWFLAKE_MAX_WORKER, workerId)
+	}
+	return &Snowflake{workerId: workerId}, nil
+}
+
+// NewLeasedSnowflake 从Redis租用一个空闲的机器id，并在后台续租，Close 时归还
+func NewLeasedSnowflake(ctx context.Context, client *redis.Client, ttl time.Duration) (*Snowflake, error) {
+	s := &Snowflake{client: client, leaseValue: InstanceId() + ":" + strconv.FormatInt(rand.Int63(), 36)}
+	offset := rand.Int63n(SNOWFLAKE_MAX_WORKER + 1)
+	for i := int64(0); i <= SNOWFLAKE_MAX_WORKER; i++ {
+		workerId := (offset + i) % (SNOWFLAKE_MAX_WORKER + 1)
+		acquired, err := client.SetNX(ctx, snowflakeWorkerKey(workerId), s.leaseValue, ttl).Result()
+		if err != nil {
+			return nil, err
+		}
+		if acquired {
+			s.workerId = workerId
+			s.leaseExpire.Store(time.Now().Add(ttl).UnixMilli())
+			leaseCtx, cancel := context.WithCancel(context.Background())
+			s.stopLease = cancel
+			go s.keepLease(leaseCtx, ttl)
+			return s, nil
+		}
+	}
+	return nil, ErrNoWorkerId
+}
+
+func snowflakeWorkerKey(workerId int64) string {
+	return SNOWFLAKE_WORKER_KEY + strconv.FormatInt(workerId, 10)
+}
+
+// snowflakeRenewScript 只有租约的持有者才能续租；key 已经过期(例如Redis故障期间没能续租)时重新占用，
+// 只有被其他实例占用时才返回 0
+var snowflakeRenewScript = redis.NewScript(`
+    local value = redis.call("GET", KEYS[1])
+    if value == ARGV[1] then
+        return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+    elseif not value then
+        redis.call("SET", KEYS[1], ARGV[1], "PX", ARGV[2])
+        return 1
+    else
+        return 0
+    end
+`)
+
+// snowflakeReleaseScript 只有租约的持有者才能归还
+var snowflakeReleaseScript = redis.NewScript(`
+    if redis.call("GET", KEYS[1]) == ARGV[1] then
+        return redis.call("DEL", KEYS[1])
+    else
+        return 0
+    end
+`)
+
+// keepLease 每 ttl/3 续租一次，续租失败时一直重试，租约过期期间停止生成，重新占用后恢复；
+// 发现机器id已经被其他实例占用时立即停止生成
+func (s *Snowflake) keepLease(ctx context.Context, ttl time.Duration) {
+	ticker := time.NewTicker(ttl / 3)
+	defer ticker.Stop()
+	key := snowflakeWorkerKey(s.workerId)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		start := time.Now()
+		result, err := snowflakeRenewScript.Run(ctx, s.client, []string{key}, s.leaseValue, ttl.Milliseconds()).Int64()
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			logrus.Warnf("renew snowflake worker %d failed: %v", s.workerId, err)
+			continue
+		}
+		if result == 0 {
+			logrus.Errorf("snowflake worker %d is taken by another instance", s.workerId)
+			s.leaseExpire.Store(-1)
+			return
+		}
+		s.leaseExpire.Store(start.Add(ttl).UnixMilli())
+	}
+}
+
+// Close 停止续租并归还机器id
+func (s *Snowflake) Close(ctx context.Context) error {
+	if s.stopLease == nil {
+		return nil
+	}
+	s.stopLease()
+	return snowflakeReleaseScript.Run(ctx, s.client, []string{snowflakeWorkerKey(s.workerId)}, s.leaseValue).Err()
+}
+
+func (s *Snowflake) WorkerId() int64 {
+	return s.workerId
+}
+
+// NextId 生成id，keyPrefix 只是为了实现 IdGenerator，不同业务的id共用一个序列
+// 时钟回拨不超过 SNOWFLAKE_MAX_BACKWARD 毫秒时等待追上，否则返回 ErrClockBackwards
+func (s *Snowflake) NextId(string) (int64, error) {
+	if expire := s.leaseExpire.Load(); expire != 0 && time.Now().UnixMilli() >= expire {
+		return 0, ErrWorkerLeaseExpired
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now().UnixMilli()
+	if now < s.lastTime {
+		backward := s.lastTime - now
+		if backward > SNOWFLAKE_MAX_BACKWARD {
+			return 0, fmt.Errorf("%w by %dms", ErrClockBackwards, backward)
+		}
+		time.Sleep(time.Duration(backward) * time.Millisecond)
+		if now = time.Now().UnixMilli(); now < s.lastTime {
+			return 0, fmt.Errorf("%w by %dms", ErrClockBackwards, s.lastTime-now)
+		}
+	}
+
+	if now == s.lastTime {
+		s.sequence = (s.sequence + 1) & snowflakeSequenceMask
+		// 当前毫秒的序号用完，等待下一毫秒
+		for s.sequence == 0 && now <= s.lastTime {
+			time.Sleep(100 * time.Microsecond)
+			now = time.Now().UnixMilli()
+		}
+	} else {
+		s.sequence = 0
+	}
+	s.lastTime = now
+
+	return composeSnowflake(now, s.workerId, s.sequence), nil
+}
+
+func composeSnowflake(millis, workerId, sequence int64) int64 {
+	return SNOWFLAKE_MARKER | (millis-BEGIN_TIMESTAMP*1000)<<(SNOWFLAKE_WORKER_BITS+SNOWFLAKE_SEQUENCE_BITS) |
+		workerId<<SNOWFLAKE_SEQUENCE_BITS | sequence
+}
+
+// IsSnowflakeId 判断id是否由 Snowflake 生成
+func IsSnowflakeId(id int64) bool {
+	return id&SNOWFLAKE_MARKER != 0
+}
+
+// DecodeSnowflakeId 解析 Snowflake 生成的id，返回生成时间、机器id和序号
+func DecodeSnowflakeId(id int64) (time.Time, int64, int64) {
+	millis := (id&^SNOWFLAKE_MARKER)>>(SNOWFLAKE_WORKER_BITS+SNOWFLAKE_SEQUENCE_BITS) + BEGIN_TIMESTAMP*1000
+	workerId := id >> SNOWFLAKE_SEQUENCE_BITS & SNOWFLAKE_MAX_WORKER
+	return time.UnixMilli(millis), workerId, id & snowflakeSequenceMask
+}
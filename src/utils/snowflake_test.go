@@ -0,0 +1,171 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestSnowflake(t *testing.T) {
+	s, err := NewSnowflake(7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = NewSnowflake(SNOWFLAKE_MAX_WORKER + 1); err == nil {
+		t.Fatal("worker id out of range should be rejected")
+	}
+
+	var mutex sync.Mutex
+	seen := make(map[int64]bool)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 5000; j++ {
+				id, err := s.NextId("order")
+				if err != nil {
+					t.Errorf("next id failed: %v", err)
+					return
+				}
+				mutex.Lock()
+				if seen[id] {
+					t.Errorf("duplicate id %d", id)
+				}
+				seen[id] = true
+				mutex.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	// 同一个生成器的id单调递增
+	last := int64(0)
+	for i := 0; i < 10000; i++ {
+		id, _ := s.NextId("order")
+		if id <= last {
+			t.Fatalf("id should be monotonic, %d after %d", id, last)
+		}
+		last = id
+	}
+
+	ts, workerId, _ := DecodeSnowflakeId(last)
+	if workerId != 7 || time.Since(ts) > time.Second || ts.After(time.Now()) {
+		t.Fatalf("unexpected decoded id: %v %d", ts, workerId)
+	}
+}
+
+func TestSnowflakeAboveRedisWorker(t *testing.T) {
+	// 同一时刻 Snowflake 的id必须大于 RedisWorker 当天可能生成的所有id，切换生成器后id仍然递增
+	for _, now := range []time.Time{
+		time.Unix(BEGIN_TIMESTAMP, 0),
+		time.Date(2026, 3, 1, 12, 30, 45, 0, time.UTC),
+		time.Date(2057, 12, 31, 23, 59, 59, 0, time.UTC),
+	} {
+		redisId := composeId(now.Add(24*time.Hour), COUNT_MASK)
+		id := composeSnowflake(now.UnixMilli(), 0, 0)
+		if id <= redisId {
+			t.Fatalf("snowflake id %d at %v should be greater than redis id %d", id, now, redisId)
+		}
+		if IsSnowflakeId(redisId) || !IsSnowflakeId(id) {
+			t.Fatalf("snowflake marker misread at %v", now)
+		}
+	}
+
+	now := time.Date(2026, 3, 1, 12, 30, 45, 123_000_000, time.UTC)
+	id := composeSnowflake(now.UnixMilli(), 7, 42)
+	ts, workerId, sequence := DecodeSnowflakeId(id)
+	if !ts.Equal(now) || workerId != 7 || sequence != 42 {
+		t.Fatalf("unexpected decoded snowflake id: %v %d %d", ts, workerId, sequence)
+	}
+	// DecodeId 能识别 Snowflake 的id
+	if ts, count := DecodeId(id); !ts.Equal(now) || count != 42 {
+		t.Fatalf("DecodeId misread snowflake id: %v %d", ts, count)
+	}
+}
+
+func TestSnowflakeClockBackwards(t *testing.T) {
+	s, _ := NewSnowflake(1)
+
+	// 小幅回拨时等待追上
+	s.lastTime = time.Now().UnixMilli() + 2
+	if _, err := s.NextId("order"); err != nil {
+		t.Fatalf("small clock backwards should be tolerated: %v", err)
+	}
+
+	s.lastTime = time.Now().UnixMilli() + 1000
+	if _, err := s.NextId("order"); !errors.Is(err, ErrClockBackwards) {
+		t.Fatalf("expected ErrClockBackwards, but get %v", err)
+	}
+}
+
+func TestLeasedSnowflake(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+
+	first, err := NewLeasedSnowflake(context.Background(), client, 3*time.Second)
+	if err != nil {
+		t.Fatalf("lease worker id failed: %v", err)
+	}
+	second, err := NewLeasedSnowflake(context.Background(), client, 3*time.Second)
+	if err != nil {
+		t.Fatalf("lease worker id failed: %v", err)
+	}
+	if first.WorkerId() == second.WorkerId() {
+		t.Fatalf("two instances lease the same worker id %d", first.WorkerId())
+	}
+	if _, err = first.NextId("order"); err != nil {
+		t.Fatalf("next id failed: %v", err)
+	}
+
+	// 机器id被其他实例占用后停止生成
+	mr.Set(snowflakeWorkerKey(second.WorkerId()), "other")
+	time.Sleep(1100 * time.Millisecond)
+	if _, err = second.NextId("order"); !errors.Is(err, ErrWorkerLeaseExpired) {
+		t.Fatalf("expected ErrWorkerLeaseExpired, but get %v", err)
+	}
+
+	if err = first.Close(context.Background()); err != nil {
+		t.Fatalf("close failed: %v", err)
+	}
+	if mr.Exists(snowflakeWorkerKey(first.WorkerId())) {
+		t.Fatal("worker id should be released after close")
+	}
+}
+
+func TestLeasedSnowflakeRecovers(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	ttl := 300 * time.Millisecond
+
+	s, err := NewLeasedSnowflake(context.Background(), client, ttl)
+	if err != nil {
+		t.Fatalf("lease worker id failed: %v", err)
+	}
+	defer s.Close(context.Background())
+	key := snowflakeWorkerKey(s.WorkerId())
+
+	// Redis故障期间没能续租，key 过期后租约也过期
+	s.leaseExpire.Store(time.Now().UnixMilli())
+	mr.FastForward(ttl + time.Millisecond)
+	if mr.Exists(key) {
+		t.Fatal("worker key should expire")
+	}
+	if _, err = s.NextId("order"); !errors.Is(err, ErrWorkerLeaseExpired) {
+		t.Fatalf("expected ErrWorkerLeaseExpired, but get %v", err)
+	}
+
+	// 下一次续租时重新占用同一个机器id，恢复生成
+	time.Sleep(ttl/3 + 50*time.Millisecond)
+	if value, _ := mr.Get(key); value != s.leaseValue {
+		t.Fatalf("worker key should be taken back, but get %q", value)
+	}
+	if _, err = s.NextId("order"); err != nil {
+		t.Fatalf("next id should recover, but get %v", err)
+	}
+}
@@ -0,0 +1,90 @@
+package utils
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// unlockNotifier 每个Redis客户端共用一个 PSUBSCRIBE lock:unlock:* 连接，在进程内把解锁通知分发给等待该 key 的请求
+// 订阅连接不在连接池中，缓存击穿时大量请求同时等待也只占用一个连接；没有等待者时关闭订阅
+type unlockNotifier struct {
+	client  *redis.Client
+	mutex   sync.Mutex
+	pubsub  *redis.PubSub
+	waiters map[string]map[chan struct{}]struct{}
+	count   int
+}
+
+var (
+	unlockNotifiersMutex sync.Mutex
+	unlockNotifiers      = make(map[*redis.Client]*unlockNotifier)
+)
+
+func getUnlockNotifier(client *redis.Client) *unlockNotifier {
+	unlockNotifiersMutex.Lock()
+	defer unlockNotifiersMutex.Unlock()
+	n, ok := unlockNotifiers[client]
+	if !ok {
+		n = &unlockNotifier{client: client, waiters: make(map[string]map[chan struct{}]struct{})}
+		unlockNotifiers[client] = n
+	}
+	return n
+}
+
+// watch 注册 key 的解锁通知，返回时订阅已经生效；等待结束后必须调用 stop
+func (n *unlockNotifier) watch(ctx context.Context, key string) (<-chan struct{}, func(), error) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	if n.pubsub == nil {
+		pubsub := n.client.PSubscribe(ctx, LOCK_UNLOCK_CHANNEL+"*")
+		if _, err := pubsub.Receive(ctx); err != nil {
+			pubsub.Close()
+			return nil, nil, err
+		}
+		n.pubsub = pubsub
+		go n.dispatch(pubsub)
+	}
+
+	ch := make(chan struct{}, 1)
+	if n.waiters[key] == nil {
+		n.waiters[key] = make(map[chan struct{}]struct{})
+	}
+	n.waiters[key][ch] = struct{}{}
+	n.count++
+
+	var once sync.Once
+	stop := func() {
+		once.Do(func() {
+			n.mutex.Lock()
+			defer n.mutex.Unlock()
+			delete(n.waiters[key], ch)
+			if len(n.waiters[key]) == 0 {
+				delete(n.waiters, key)
+			}
+			n.count--
+			if n.count == 0 {
+				n.pubsub.Close()
+				n.pubsub = nil
+			}
+		})
+	}
+	return ch, stop, nil
+}
+
+// dispatch 订阅关闭后退出，通知不会阻塞：等待者的通道中已经有未处理的通知时丢弃新的通知
+func (n *unlockNotifier) dispatch(pubsub *redis.PubSub) {
+	for msg := range pubsub.Channel() {
+		key := strings.TrimPrefix(msg.Channel, LOCK_UNLOCK_CHANNEL)
+		n.mutex.Lock()
+		for ch := range n.waiters[key] {
+			select {
+			case ch <- struct{}{}:
+			default:
+			}
+		}
+		n.mutex.Unlock()
+	}
+}
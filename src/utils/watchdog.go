@@ -0,0 +1,180 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+)
+
+// renewFunc 校验持有者并续期，返回 0 表示锁已经不属于当前持有者
+type renewFunc func(ctx context.Context) (int64, error)
+
+// watchDogs 管理一组看门狗，id 唯一标识一次持有(例如锁的key，或者key + 持有者)
+// client 不为空时同时维护锁的元数据，用于排查锁被谁持有
+type watchDogs struct {
+	client  *redis.Client
+	mutex   sync.Mutex
+	entries map[string]*watchDogEntry
+}
+
+// watchDogEntry 看门狗和锁的持有状态，lockCtx 在锁丢失或者释放时被取消
+type watchDogEntry struct {
+	stop    context.CancelFunc
+	lockCtx context.Context
+	lost    context.CancelCauseFunc
+	metaKey string
+	owner   string
+}
+
+func newWatchDogs(client *redis.Client) *watchDogs {
+	return &watchDogs{client: client, entries: make(map[string]*watchDogEntry)}
+}
+
+// start 启动看门狗，每 ttl/2 调用一次 renew，owner 为持有者标识(token、持有者或者许可id)
+// 返回的 lockCtx 继承 parent 中的值但不受 parent 取消的影响，只在锁丢失或者释放时被取消
+func (w *watchDogs) start(parent context.Context, id, key, owner string, ttl time.Duration, renew renewFunc) context.Context {
+	metaKey := lockMetaKey(key)
+	w.saveMeta(parent, metaKey, owner, ttl)
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	// 如果已有看门狗，先停止它（防止重复）
+	if entry, ok := w.entries[id]; ok {
+		entry.stop()
+		entry.lost(nil)
+	}
+
+	// 创建新的看门狗上下文
+	dogCtx, stop := context.WithCancel(context.Background())
+	lockCtx, lost := context.WithCancelCause(context.WithoutCancel(parent))
+	w.entries[id] = &watchDogEntry{stop: stop, lockCtx: lockCtx, lost: lost, metaKey: metaKey, owner: owner}
+
+	// 启动看门狗协程，续期成功时同时续期元数据
+	go watchDog(dogCtx, key, ttl, func(ctx context.Context) (int64, error) {
+		result, err := renew(ctx)
+		if err == nil && result > 0 {
+			w.renewMeta(ctx, metaKey, owner, ttl)
+		}
+		return result, err
+	}, lost)
+	return lockCtx
+}
+
+func (w *watchDogs) stop(id string) {
+	w.mutex.Lock()
+	entry, ok := w.entries[id]
+	if ok {
+		entry.stop()
+		entry.lost(nil)
+		delete(w.entries, id)
+	}
+	w.mutex.Unlock()
+	if ok {
+		w.deleteMeta(entry.metaKey, entry.owner)
+	}
+}
+
+// saveMeta 记录持有者实例、加锁时间和等待时间，元数据只用于排查，写入失败不影响加锁
+func (w *watchDogs) saveMeta(parent context.Context, metaKey, owner string, ttl time.Duration) {
+	if w.client == nil {
+		return
+	}
+	var waitTime time.Duration
+	if start, ok := parent.Value(lockWaitStartKey{}).(time.Time); ok {
+		waitTime = time.Since(start)
+	}
+	meta, _ := json.Marshal(LockMeta{
+		Owner:       owner,
+		Instance:    InstanceId(),
+		AcquireTime: time.Now().UnixMilli(),
+		WaitTime:    waitTime.Milliseconds(),
+	})
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(parent), time.Second)
+	defer cancel()
+	_, err := w.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, metaKey, owner, string(meta), owner+lockMetaRenewSuffix, 0)
+		pipe.PExpire(ctx, metaKey, ttl)
+		return nil
+	})
+	if err != nil {
+		logrus.Debugf("save lock meta %s failed: %v", metaKey, err)
+	}
+}
+
+func (w *watchDogs) renewMeta(ctx context.Context, metaKey, owner string, ttl time.Duration) {
+	if w.client == nil {
+		return
+	}
+	_, err := w.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HIncrBy(ctx, metaKey, owner+lockMetaRenewSuffix, 1)
+		pipe.PExpire(ctx, metaKey, ttl)
+		return nil
+	})
+	if err != nil {
+		logrus.Debugf("renew lock meta %s failed: %v", metaKey, err)
+	}
+}
+
+// deleteMeta 只删除自己的字段，同一个锁的其他持有者(例如读锁)的元数据保留
+func (w *watchDogs) deleteMeta(metaKey, owner string) {
+	if w.client == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := w.client.HDel(ctx, metaKey, owner, owner+lockMetaRenewSuffix).Err(); err != nil {
+		logrus.Debugf("delete lock meta %s failed: %v", metaKey, err)
+	}
+}
+
+// lockContext 没有持有时返回一个已经取消的上下文
+func (w *watchDogs) lockContext(id, key string) context.Context {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if entry, ok := w.entries[id]; ok {
+		return entry.lockCtx
+	}
+	ctx, cancel := context.WithCancelCause(context.Background())
+	cancel(fmt.Errorf("%w: %s is not held", ErrLockLost, key))
+	return ctx
+}
+
+// watchDog 自动续期的看门狗实现
+// 续期失败或者锁已经不属于当前持有者时通过 lost 通知临界区
+func watchDog(ctx context.Context, key string, ttl time.Duration, renew renewFunc, lost context.CancelCauseFunc) {
+	ticker := time.NewTicker(ttl / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			// 续期时验证令牌
+			result, err := renew(ctx)
+			if ctx.Err() != nil {
+				// 已经解锁
+				return
+			}
+			if err != nil {
+				lockMetricsOf(key).lost.Add(1)
+				logrus.Warnf("锁续期失败: key=%s, err=%v", key, err)
+				lost(fmt.Errorf("%w: renew %s failed: %v", ErrLockLost, key, err))
+				return
+			}
+			if result == 0 {
+				lockMetricsOf(key).lost.Add(1)
+				logrus.Warnf("锁已丢失: key=%s", key)
+				lost(fmt.Errorf("%w: %s is no longer owned", ErrLockLost, key))
+				return
+			}
+
+		case <-ctx.Done():
+			return
+		}
+	}
+}